@@ -1,74 +1,89 @@
 package main
 
 import (
-	"fmt"
+	"context"
 	"log"
+	"log/slog"
 	"os"
 	"os/signal"
-	"path/filepath"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
+	"backend/internal/auth"
+	"backend/internal/config"
 	"backend/internal/database"
+	"backend/internal/handlers"
+	"backend/internal/logging"
+	"backend/internal/middleware"
 	"backend/internal/server"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
-	"github.com/joho/godotenv"
 )
 
 func main() {
-	cwd, _ := os.Getwd()
-	fmt.Println("Current working directory:", cwd)
-
-	// Load environment variables
-	envPath := filepath.Join(cwd, ".env")
-	fmt.Printf("Loading .env from: %s\n", envPath)
-	if err := godotenv.Load(envPath); err != nil {
-		log.Printf("Error loading .env file: %v", err)
+	// Load configuration from the environment, .env and the config file
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-	}
+	// Log structured records; log.Printf output goes through the same logger
+	slog.SetDefault(logging.New(os.Stderr, cfg.Logging))
+	slog.Info("Loaded configuration", "profile", cfg.Profile)
+
+	auth.Configure(cfg.Auth)
 
 	// Initialize database
-	dbURL := os.Getenv("DATABASE_URL")
-	if dbURL == "" {
-		log.Fatal("DATABASE_URL environment variable is not set")
-	}
-	db := database.New(dbURL)
+	db := database.New(cfg.Database)
 
 	// Create Fiber app
 	app := fiber.New(fiber.Config{
-		AppName: "Code Generation Copilot v1.0.0",
+		AppName:               "Code Generation Copilot v1.0.0",
+		ErrorHandler:          handlers.ErrorHandler,
+		DisableStartupMessage: true,
 	})
 
+	// Tag every request with an ID, returned in X-Request-ID, in errors and
+	// in logs, then log and count the request once it is handled
+	app.Use(middleware.RequestID())
+	app.Use(middleware.Logger())
+	app.Use(middleware.Metrics())
+
 	// Configure CORS
 	app.Use(cors.New(cors.Config{
-		AllowOrigins: "http://localhost:3000, https://code-genration-copilot.vercel.app",
-		AllowHeaders: "Origin, Content-Type, Accept, Authorization",
-		AllowMethods: "GET, POST, HEAD, PUT, DELETE, PATCH",
+		AllowOrigins:  strings.Join(cfg.Server.CORSOrigins, ", "),
+		AllowHeaders:  "Origin, Content-Type, Accept, Authorization, X-Request-ID",
+		AllowMethods:  "GET, POST, HEAD, PUT, DELETE, PATCH",
+		ExposeHeaders: fiber.HeaderXRequestID,
 	}))
 
-	srv := server.NewServer(db)
+	srv := server.NewServer(db, cfg)
 	srv.RegisterRoutes(app)
 
+	// Chats in the trash are purged after the configured retention
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.PurgeTrash(ctx, cfg.Server.TrashRetention, time.Hour)
+
 	// Create a channel to listen for OS signals
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 
 	// Run server in a goroutine
 	go func() {
-		fmt.Printf("Server starting on port %s...\n", port)
-		if err := app.Listen(":" + port); err != nil {
+		slog.Info("Server starting", "port", cfg.Server.Port)
+		if err := app.Listen(":" + strconv.Itoa(cfg.Server.Port)); err != nil {
 			log.Fatalf("Could not start server: %v", err)
 		}
 	}()
 
 	// Wait for signal
 	<-stop
-	fmt.Println("\nShutting down server...")
+	slog.Info("Shutting down server")
+	cancel()
 
 	// Shutdown Fiber app
 	if err := app.Shutdown(); err != nil {
@@ -80,5 +95,5 @@ func main() {
 		log.Fatalf("Error closing database connection: %v", err)
 	}
 
-	fmt.Println("Server exited properly")
+	slog.Info("Server exited properly")
 }
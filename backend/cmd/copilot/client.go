@@ -0,0 +1,39 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"backend/pkg/client"
+)
+
+// errUnauthorized is returned when the API rejects the stored token
+var errUnauthorized = errors.New("not logged in or the session expired, run `copilot login`")
+
+func newClient(cfg *config) *client.Client {
+	return client.New(cfg.APIURL,
+		client.WithToken(cfg.Token),
+		client.WithHTTPClient(&http.Client{Timeout: 5 * time.Minute}), // generations can take a while
+		// Refreshed session tokens are kept for the next run, unless the
+		// session came from the environment
+		client.WithTokenCallback(func(token string) {
+			cfg.Token = token
+			if !cfg.tokenFromEnv {
+				_ = cfg.save()
+			}
+		}),
+	)
+}
+
+// loggedInClient returns a client using the stored session
+func loggedInClient() (*client.Client, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Token == "" {
+		return nil, errUnauthorized
+	}
+	return newClient(cfg), nil
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"backend/pkg/client"
+)
+
+// languages maps file extensions to the language sent to the API when no
+// language is given
+var languages = map[string]string{
+	".go":    "go",
+	".py":    "python",
+	".js":    "javascript",
+	".jsx":   "javascript",
+	".ts":    "typescript",
+	".tsx":   "typescript",
+	".java":  "java",
+	".kt":    "kotlin",
+	".rs":    "rust",
+	".rb":    "ruby",
+	".php":   "php",
+	".c":     "c",
+	".h":     "c",
+	".cpp":   "cpp",
+	".cc":    "cpp",
+	".cs":    "csharp",
+	".swift": "swift",
+	".sh":    "bash",
+	".sql":   "sql",
+	".html":  "html",
+	".css":   "css",
+}
+
+func login(ctx context.Context, args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	flags := flag.NewFlagSet("login", flag.ContinueOnError)
+	apiURL := flags.String("api", cfg.APIURL, "URL of the copilot API")
+	email := flags.String("email", cfg.Email, "email to log in with")
+	token := flags.String("token", "", "store a personal access token instead of logging in with a password")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	cfg.APIURL = *apiURL
+
+	if *token != "" {
+		cfg.Token = *token
+		if err := cfg.save(); err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stderr, "Token saved")
+		return nil
+	}
+
+	if *email == "" {
+		if *email, err = readLine("Email: "); err != nil {
+			return err
+		}
+	}
+	password, err := readPassword("Password: ")
+	if err != nil {
+		return err
+	}
+
+	// The session of the new login is saved, whatever COPILOT_TOKEN holds
+	cfg.tokenFromEnv = false
+	resp, err := newClient(cfg).Login(ctx, *email, password)
+	if err != nil {
+		return err
+	}
+
+	cfg.Email = resp.User.Email
+	if err := cfg.save(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Logged in as %s\n", resp.User.Email)
+	return nil
+}
+
+func logout() error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	cfg.Token = ""
+	return cfg.save()
+}
+
+// gen sends a prompt, to a new chat or to the chat with ID chatID. Code
+// piped to stdin or read with -f is sent along with it.
+func gen(ctx context.Context, args []string, chatID *int) error {
+	flags := flag.NewFlagSet("gen", flag.ContinueOnError)
+	language := flags.String("l", "", "language of the code, guessed from -o or -f when not given")
+	mode := flags.String("m", "generate", "generate, explain, refactor, review, tests, translate or edit")
+	input := flags.String("f", "", "read the code to work on from this file instead of stdin")
+	output := flags.String("o", "", "write the generated code to this file")
+	target := flags.String("to", "", "target language in translate mode")
+	continueID := flags.Int("c", 0, "continue the chat with this ID")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *continueID != 0 {
+		chatID = continueID
+	}
+
+	cl, err := loggedInClient()
+	if err != nil {
+		return err
+	}
+
+	req := client.GenerateRequest{
+		ChatID:         chatID,
+		Mode:           *mode,
+		Prompt:         strings.Join(flags.Args(), " "),
+		Language:       *language,
+		TargetLanguage: *target,
+	}
+
+	switch {
+	case *input != "":
+		data, err := os.ReadFile(*input)
+		if err != nil {
+			return err
+		}
+		req.Code = string(data)
+	case !isTerminal(os.Stdin):
+		data, err := io.ReadAll(stdin)
+		if err != nil {
+			return err
+		}
+		req.Code = string(data)
+	}
+
+	if req.Language == "" {
+		req.Language = languageOf(*input, *output)
+	}
+	if req.Language == "" && chatID != nil {
+		// A continued chat keeps the language it was using
+		if req.Language, err = chatLanguage(ctx, cl, *chatID); err != nil {
+			return err
+		}
+	}
+	if req.Language == "" && req.Mode == client.ModeGenerate {
+		return usageError("the language is required, use -l")
+	}
+
+	resp, err := cl.Generate(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	code := strings.TrimRight(resp.Code, "\n") + "\n"
+	if *output != "" {
+		if err := os.WriteFile(*output, []byte(code), 0o644); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Wrote %s (chat %d)\n", *output, resp.ChatID)
+		return nil
+	}
+
+	fmt.Print(code)
+	if isTerminal(os.Stdout) {
+		fmt.Fprintf(os.Stderr, "\nChat %d, continue with: copilot chat continue %d PROMPT\n", resp.ChatID, resp.ChatID)
+	}
+	return nil
+}
+
+func listChats(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("chats ls", flag.ContinueOnError)
+	limit := flags.Int("n", 20, "number of chats to list")
+	archived := flags.Bool("archived", false, "list archived chats")
+	pinned := flags.Bool("pinned", false, "list pinned chats only")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	cl, err := loggedInClient()
+	if err != nil {
+		return err
+	}
+
+	opts := client.ListChatsOptions{Limit: *limit}
+	if *archived {
+		opts.Archived = archived
+	}
+	if *pinned {
+		opts.Pinned = pinned
+	}
+	list, err := cl.ListChats(ctx, opts)
+	if err != nil {
+		return err
+	}
+	if len(list.Chats) == 0 {
+		fmt.Fprintln(os.Stderr, "No chats")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tUPDATED\tTITLE")
+	for _, chat := range list.Chats {
+		title := chat.Title
+		if chat.Pinned {
+			title = "* " + title
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", chat.ID, formatTime(chat.UpdatedAt), title)
+	}
+	return w.Flush()
+}
+
+func showChat(ctx context.Context, id int) error {
+	cl, err := loggedInClient()
+	if err != nil {
+		return err
+	}
+
+	resp, err := cl.GetChatMessages(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("# %s\n", resp.Chat.Title)
+	for _, msg := range resp.Messages {
+		heading := msg.Role
+		if msg.Mode != "" && msg.Mode != "generate" {
+			heading += ", " + msg.Mode
+		}
+		fmt.Printf("\n## %s (%s)\n\n", heading, formatTime(msg.CreatedAt))
+
+		// Replies hold raw code, prompts and markdown replies are printed as they are
+		if msg.Role == "assistant" && msg.Mode == "generate" {
+			fmt.Printf("```%s\n%s\n```\n", msg.Language, strings.TrimRight(msg.Content, "\n"))
+		} else {
+			fmt.Println(strings.TrimRight(msg.Content, "\n"))
+		}
+	}
+	return nil
+}
+
+// chatLanguage returns the language of the latest message of a chat
+func chatLanguage(ctx context.Context, cl *client.Client, id int) (string, error) {
+	resp, err := cl.GetChatMessages(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	for i := len(resp.Messages) - 1; i >= 0; i-- {
+		if resp.Messages[i].Language != "" {
+			return resp.Messages[i].Language, nil
+		}
+	}
+	return "", nil
+}
+
+// languageOf guesses the language from the first file name with a known extension
+func languageOf(paths ...string) string {
+	for _, path := range paths {
+		if language, ok := languages[strings.ToLower(filepath.Ext(path))]; ok {
+			return language
+		}
+	}
+	return ""
+}
+
+func parseChatID(s string) (int, error) {
+	id, err := strconv.Atoi(s)
+	if err != nil || id <= 0 {
+		return 0, errors.New("invalid chat ID " + s)
+	}
+	return id, nil
+}
+
+func formatTime(s string) string {
+	t, err := time.Parse("2006-01-02T15:04:05Z07:00", s)
+	if err != nil {
+		return s
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
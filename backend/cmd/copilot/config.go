@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+const defaultAPIURL = "http://localhost:8080"
+
+// config is what the CLI remembers between runs. It holds a credential, so
+// it is only readable by the user.
+type config struct {
+	APIURL string `json:"apiUrl"`
+	Token  string `json:"token,omitempty"`
+	Email  string `json:"email,omitempty"`
+
+	tokenFromEnv bool // Token is COPILOT_TOKEN, which is never written to the file
+}
+
+// configPath returns $COPILOT_CONFIG, or copilot/config.json in the user's
+// config directory
+func configPath() (string, error) {
+	if path := os.Getenv("COPILOT_CONFIG"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "copilot", "config.json"), nil
+}
+
+// loadConfig reads the config file, which doesn't exist before the first
+// login. COPILOT_API_URL and COPILOT_TOKEN take precedence over the file.
+func loadConfig() (*config, error) {
+	cfg := &config{APIURL: defaultAPIURL}
+
+	path, err := configPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, cfg); err != nil {
+			return nil, errors.New("invalid config file " + path + ": " + err.Error())
+		}
+	}
+
+	if url := os.Getenv("COPILOT_API_URL"); url != "" {
+		cfg.APIURL = url
+	}
+	if token := os.Getenv("COPILOT_TOKEN"); token != "" {
+		cfg.Token = token
+		cfg.tokenFromEnv = true
+	}
+	return cfg, nil
+}
+
+func (cfg *config) save() error {
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o600)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+
+	"backend/pkg/client"
+)
+
+// copilot is a terminal client for the copilot API:
+//
+//	copilot login -api https://copilot.example.com
+//	copilot gen -l go "parse a CSV file into structs"
+//	cat main.go | copilot gen -m review
+//	copilot chats ls
+//	copilot chat show 42
+//	copilot chat continue 42 "now add tests"
+const usage = `Usage: copilot <command> [flags] [arguments]
+
+Commands:
+  login                 log in and remember the session
+  logout                forget the session
+  gen PROMPT            generate code, or explain, review... code piped to stdin
+  chats ls              list your chats
+  chat show ID          print the messages of a chat
+  chat continue ID PROMPT
+                        add a prompt to a chat
+
+Run copilot <command> -h for the flags of a command. The config file is
+kept in your config directory, or at $COPILOT_CONFIG. COPILOT_API_URL and
+COPILOT_TOKEN override the API URL and token stored in it.
+`
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := run(ctx, os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		var uerr usageError
+		if errors.As(err, &uerr) {
+			fmt.Fprintf(os.Stderr, "copilot: %v\n\n%s", err, usage)
+			os.Exit(2)
+		}
+		fmt.Fprintf(os.Stderr, "copilot: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// usageError reports a command line the CLI doesn't understand
+type usageError string
+
+func (e usageError) Error() string { return string(e) }
+
+func run(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return usageError("no command given")
+	}
+
+	err := dispatch(ctx, args[0], args[1:])
+	if args[0] != "login" && client.StatusCode(err) == http.StatusUnauthorized {
+		return errUnauthorized
+	}
+	return err
+}
+
+func dispatch(ctx context.Context, command string, args []string) error {
+	switch command {
+	case "login":
+		return login(ctx, args)
+	case "logout":
+		return logout()
+	case "gen", "generate":
+		return gen(ctx, args, nil)
+	case "chats":
+		if len(args) > 0 && (args[0] == "ls" || args[0] == "list") {
+			return listChats(ctx, args[1:])
+		}
+		return usageError("usage: copilot chats ls")
+	case "chat":
+		if len(args) < 2 {
+			return usageError("usage: copilot chat show|continue ID")
+		}
+		id, err := parseChatID(args[1])
+		if err != nil {
+			return err
+		}
+		switch args[0] {
+		case "show":
+			return showChat(ctx, id)
+		case "continue":
+			return gen(ctx, args[2:], &id)
+		}
+		return usageError("unknown chat command " + args[0])
+	case "help", "-h", "-help", "--help":
+		fmt.Print(usage)
+		return nil
+	}
+	return usageError("unknown command " + command)
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// stdin is shared by everything reading input, so nothing is lost in the
+// buffer of another reader
+var stdin = bufio.NewReader(os.Stdin)
+
+// isTerminal reports whether f is an interactive terminal rather than a
+// pipe or a file
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// readLine prompts for a line on stderr and reads it from stdin
+func readLine(prompt string) (string, error) {
+	if isTerminal(os.Stdin) {
+		fmt.Fprint(os.Stderr, prompt)
+	}
+	line, err := stdin.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// readPassword is readLine without echoing the input. Turning echo off
+// relies on stty, where it isn't available the input is echoed.
+func readPassword(prompt string) (string, error) {
+	if !isTerminal(os.Stdin) {
+		return readLine(prompt)
+	}
+
+	stty := func(args ...string) error {
+		cmd := exec.Command("stty", args...)
+		cmd.Stdin = os.Stdin
+		return cmd.Run()
+	}
+	if err := stty("-echo"); err == nil {
+		defer func() {
+			_ = stty("echo")
+			fmt.Fprintln(os.Stderr)
+		}()
+	}
+	return readLine(prompt)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"backend/internal/lsp"
+)
+
+// lsp runs the language server over stdio. Editors start it with a
+// personal access token created in the web app:
+//
+//	COPILOT_TOKEN=cgc_pat_... go run ./cmd/lsp -api https://copilot.example.com
+func main() {
+	apiURL := flag.String("api", envOr("COPILOT_API_URL", "http://localhost:8080"), "URL of the copilot backend")
+	token := flag.String("token", os.Getenv("COPILOT_TOKEN"), "personal access token, defaults to $COPILOT_TOKEN")
+	flag.Parse()
+
+	// stdout carries the protocol, so logs go to stderr, which editors
+	// show in their language server output
+	logger := log.New(os.Stderr, "copilot-lsp: ", log.LstdFlags)
+	if *token == "" {
+		logger.Fatal("a personal access token is required, set COPILOT_TOKEN or -token")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	server := lsp.NewServer(os.Stdin, os.Stdout, *apiURL, *token, logger)
+	if err := server.Run(ctx); err != nil {
+		logger.Fatal(err)
+	}
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+
+	"backend/internal/auth"
+	"backend/internal/config"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// setrole assigns a role to an existing user, e.g. to bootstrap the first admin:
+//
+//	go run ./cmd/setrole -email admin@example.com -role admin
+func main() {
+	email := flag.String("email", "", "email of the user to update")
+	roleName := flag.String("role", string(auth.RoleAdmin), "role to assign (user, admin, support)")
+	flag.Parse()
+
+	if *email == "" {
+		log.Fatal("-email is required")
+	}
+	role, err := auth.ParseRole(*roleName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Load configuration the way the server does, so the same database is used
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Connect to database
+	db, err := sql.Open("pgx", cfg.Database.URL)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	// Changing the role revokes existing tokens, which still carry the old role
+	res, err := db.Exec(`UPDATE users SET role = $1, token_version = token_version + 1 WHERE email = $2`, string(role), *email)
+	if err != nil {
+		log.Fatalf("Failed to update role: %v", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		log.Fatalf("No user found with email %s", *email)
+	}
+
+	fmt.Printf("✅ %s is now %s\n", *email, role)
+}
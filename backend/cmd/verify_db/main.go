@@ -34,7 +34,8 @@ func main() {
 		log.Fatalf("Could not connect to database: %v", err)
 	}
 
-	fmt.Println("✅ Connected to database successfully!\n")
+	fmt.Println("✅ Connected to database successfully!")
+	fmt.Println()
 
 	// Verify tables exist
 	tables := []string{"users", "languages", "generations"}
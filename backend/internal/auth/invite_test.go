@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"backend/internal/config"
+	"testing"
+	"time"
+)
+
+func TestInviteToken(t *testing.T) {
+	Configure(config.Auth{JWTSecret: "test-secret"})
+	t.Cleanup(func() { Configure(config.Auth{}) })
+
+	token, claims, err := GenerateInviteToken(3, "editor", "ada@example.com", 7, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(claims.ID) != 32 {
+		t.Errorf("ID = %q, want 16 random bytes in hex", claims.ID)
+	}
+
+	parsed, err := ValidateInviteToken(token)
+	if err != nil {
+		t.Fatalf("ValidateInviteToken() error = %v", err)
+	}
+	if parsed.ID != claims.ID || parsed.WorkspaceID != 3 || parsed.Role != "editor" ||
+		parsed.Email != "ada@example.com" || parsed.InvitedBy != 7 {
+		t.Errorf("ValidateInviteToken() = %+v, want %+v", parsed, claims)
+	}
+
+	// Every invite is stored under its own ID
+	_, other, err := GenerateInviteToken(3, "editor", "ada@example.com", 7, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.ID == claims.ID {
+		t.Errorf("two invites share the ID %q", other.ID)
+	}
+
+	expired, _, err := GenerateInviteToken(3, "editor", "", 7, -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateInviteToken(expired); err == nil {
+		t.Error("ValidateInviteToken() accepted an expired invite")
+	}
+
+	session, err := GenerateToken(7, "ada@example.com", RoleUser, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateInviteToken(session); err == nil {
+		t.Error("ValidateInviteToken() accepted a session token")
+	}
+}
@@ -1,33 +1,59 @@
 package auth
 
 import (
+	"backend/internal/config"
 	"errors"
-	"os"
+	"slices"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// settings signs and checks tokens. It is set once by Configure at startup.
+var settings config.Auth
+
+// errNotConfigured is returned when tokens are used before Configure
+var errNotConfigured = errors.New("auth is not configured")
+
+// Configure sets the secret and lifetime of tokens
+func Configure(cfg config.Auth) {
+	settings = cfg
+}
+
+// secret returns the key tokens are signed with
+func secret() ([]byte, error) {
+	if settings.JWTSecret == "" {
+		return nil, errNotConfigured
+	}
+	return []byte(settings.JWTSecret), nil
+}
+
 // Claims represents the JWT claims
 type Claims struct {
-	UserID int    `json:"user_id"`
-	Email  string `json:"email"`
+	UserID       int    `json:"user_id"`
+	Email        string `json:"email"`
+	Role         Role   `json:"role"`
+	TokenVersion int    `json:"tv"`
 	jwt.RegisteredClaims
 }
 
-// GenerateToken generates a new JWT token for a user
-func GenerateToken(userID int, email string) (string, error) {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		return "", errors.New("JWT_SECRET environment variable is not set")
+// GenerateToken generates a new JWT token for a user.
+// tokenVersion must match the user's current token version for the token
+// to be accepted; bumping it in the database revokes all issued tokens.
+func GenerateToken(userID int, email string, role Role, tokenVersion int) (string, error) {
+	key, err := secret()
+	if err != nil {
+		return "", err
 	}
 
 	// Create claims with user data and expiration
 	claims := Claims{
-		UserID: userID,
-		Email:  email,
+		UserID:       userID,
+		Email:        email,
+		Role:         role,
+		TokenVersion: tokenVersion,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(settings.TokenTTL)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			NotBefore: jwt.NewNumericDate(time.Now()),
 		},
@@ -37,7 +63,7 @@ func GenerateToken(userID int, email string) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
 	// Sign token with secret
-	tokenString, err := token.SignedString([]byte(secret))
+	tokenString, err := token.SignedString(key)
 	if err != nil {
 		return "", err
 	}
@@ -47,9 +73,9 @@ func GenerateToken(userID int, email string) (string, error) {
 
 // ValidateToken validates a JWT token and returns the claims
 func ValidateToken(tokenString string) (*Claims, error) {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		return nil, errors.New("JWT_SECRET environment variable is not set")
+	key, err := secret()
+	if err != nil {
+		return nil, err
 	}
 
 	// Parse token
@@ -58,7 +84,7 @@ func ValidateToken(tokenString string) (*Claims, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, errors.New("invalid signing method")
 		}
-		return []byte(secret), nil
+		return key, nil
 	})
 
 	if err != nil {
@@ -67,6 +93,14 @@ func ValidateToken(tokenString string) (*Claims, error) {
 
 	// Extract claims
 	if claims, ok := token.Claims.(*Claims); ok && token.Valid {
+		// Invite tokens share the secret but must not work as sessions
+		if slices.Contains(claims.Audience, inviteAudience) {
+			return nil, errors.New("invalid token")
+		}
+		// Tokens issued before roles existed carry no role
+		if claims.Role == "" {
+			claims.Role = RoleUser
+		}
 		return claims, nil
 	}
 
@@ -0,0 +1,19 @@
+package auth
+
+// Principal is the authenticated identity a request acts on behalf of
+type Principal struct {
+	UserID  int
+	Email   string
+	Role    Role
+	TokenID int // personal access token the request was made with, 0 for sessions
+}
+
+// HasRole reports whether the principal has any of the given roles
+func (p *Principal) HasRole(roles ...Role) bool {
+	for _, r := range roles {
+		if p.Role == r {
+			return true
+		}
+	}
+	return false
+}
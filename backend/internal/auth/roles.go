@@ -0,0 +1,30 @@
+package auth
+
+import "fmt"
+
+// Role represents an application-wide user role
+type Role string
+
+const (
+	RoleUser    Role = "user"
+	RoleAdmin   Role = "admin"
+	RoleSupport Role = "support"
+)
+
+// Valid reports whether r is one of the known roles
+func (r Role) Valid() bool {
+	switch r {
+	case RoleUser, RoleAdmin, RoleSupport:
+		return true
+	}
+	return false
+}
+
+// ParseRole converts a string into a Role, rejecting unknown values
+func ParseRole(s string) (Role, error) {
+	r := Role(s)
+	if !r.Valid() {
+		return "", fmt.Errorf("invalid role %q", s)
+	}
+	return r, nil
+}
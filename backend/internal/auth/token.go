@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// AccessTokenPrefix starts every personal access token, which tells them
+// apart from session JWTs and makes leaked tokens easy to scan for
+const AccessTokenPrefix = "cgc_pat_"
+
+// accessTokenDisplayLength is how much of a token is kept to identify it
+const accessTokenDisplayLength = len(AccessTokenPrefix) + 6
+
+// GenerateAccessToken creates a random personal access token. Only its hash
+// is stored; display is the start of the token, to tell tokens apart.
+func GenerateAccessToken() (token, hash, display string, err error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", "", err
+	}
+
+	token = AccessTokenPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	return token, HashAccessToken(token), token[:accessTokenDisplayLength], nil
+}
+
+// HashAccessToken returns the value stored for a personal access token
+func HashAccessToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsAccessToken reports whether a bearer token is a personal access token
+func IsAccessToken(token string) bool {
+	return strings.HasPrefix(token, AccessTokenPrefix)
+}
@@ -0,0 +1,95 @@
+package authz
+
+import (
+	"context"
+	"errors"
+
+	"backend/internal/auth"
+	"backend/internal/database"
+)
+
+// Action is something a principal wants to do with a resource
+type Action string
+
+const (
+	ActionRead   Action = "read"
+	ActionWrite  Action = "write"
+	ActionDelete Action = "delete"
+	ActionManage Action = "manage"
+	ActionShare  Action = "share"
+)
+
+// ErrForbidden is returned when a principal may not perform an action
+var ErrForbidden = errors.New("access denied")
+
+// Policy answers whether a principal can perform an action on a resource.
+// Every handler goes through it instead of comparing user IDs itself.
+type Policy struct {
+	db database.Service
+}
+
+func New(db database.Service) *Policy {
+	return &Policy{
+		db: db,
+	}
+}
+
+// Chat checks whether principal may perform action on chat.
+// Personal chats are only accessible to their creator. Workspace chats can
+// be read by any member and written or shared by editors; deleting one requires the
+// workspace owner or the editor who created it.
+func (p *Policy) Chat(ctx context.Context, principal *auth.Principal, action Action, chat *database.Chat) error {
+	if principal == nil || chat == nil {
+		return ErrForbidden
+	}
+
+	if chat.WorkspaceID != nil {
+		return p.workspaceChat(ctx, principal, action, chat)
+	}
+
+	switch action {
+	case ActionRead, ActionWrite, ActionDelete, ActionShare:
+		if chat.UserID == principal.UserID {
+			return nil
+		}
+	}
+
+	return ErrForbidden
+}
+
+func (p *Policy) workspaceChat(ctx context.Context, principal *auth.Principal, action Action, chat *database.Chat) error {
+	role, err := p.workspaceRole(ctx, principal, *chat.WorkspaceID)
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case ActionRead:
+		return nil
+	case ActionWrite, ActionShare:
+		if role == WorkspaceOwner || role == WorkspaceEditor {
+			return nil
+		}
+	case ActionDelete:
+		if role == WorkspaceOwner || (role == WorkspaceEditor && chat.UserID == principal.UserID) {
+			return nil
+		}
+	}
+
+	return ErrForbidden
+}
+
+// Message checks whether principal may perform action on message.
+// Messages inherit the permissions of the chat they belong to.
+func (p *Policy) Message(ctx context.Context, principal *auth.Principal, action Action, message *database.Message) error {
+	if principal == nil || message == nil {
+		return ErrForbidden
+	}
+
+	chat, err := p.db.GetChatByID(ctx, message.ChatID)
+	if err != nil {
+		return err
+	}
+
+	return p.Chat(ctx, principal, action, chat)
+}
@@ -0,0 +1,25 @@
+package authz
+
+import (
+	"context"
+
+	"backend/internal/auth"
+	"backend/internal/database"
+)
+
+// Snippet checks whether principal may perform action on a snippet.
+// Snippets are personal, so only their owner can access them.
+func (p *Policy) Snippet(ctx context.Context, principal *auth.Principal, action Action, snippet *database.Snippet) error {
+	if principal == nil || snippet == nil {
+		return ErrForbidden
+	}
+
+	switch action {
+	case ActionRead, ActionWrite, ActionDelete:
+		if snippet.UserID == principal.UserID {
+			return nil
+		}
+	}
+
+	return ErrForbidden
+}
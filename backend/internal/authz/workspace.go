@@ -0,0 +1,70 @@
+package authz
+
+import (
+	"context"
+	"errors"
+
+	"backend/internal/auth"
+	"backend/internal/database"
+)
+
+// WorkspaceRole is a member's role within a workspace
+type WorkspaceRole string
+
+const (
+	WorkspaceOwner  WorkspaceRole = "owner"
+	WorkspaceEditor WorkspaceRole = "editor"
+	WorkspaceViewer WorkspaceRole = "viewer"
+)
+
+// Valid reports whether r is one of the known workspace roles
+func (r WorkspaceRole) Valid() bool {
+	switch r {
+	case WorkspaceOwner, WorkspaceEditor, WorkspaceViewer:
+		return true
+	}
+	return false
+}
+
+// Workspace checks whether principal may perform action on a workspace.
+// Viewers can read, editors can also add content, and only owners can
+// manage the workspace itself (rename, members, invites, deletion).
+func (p *Policy) Workspace(ctx context.Context, principal *auth.Principal, action Action, workspaceID int) error {
+	role, err := p.workspaceRole(ctx, principal, workspaceID)
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case ActionRead:
+		return nil
+	case ActionWrite:
+		if role == WorkspaceOwner || role == WorkspaceEditor {
+			return nil
+		}
+	case ActionManage, ActionDelete:
+		if role == WorkspaceOwner {
+			return nil
+		}
+	}
+
+	return ErrForbidden
+}
+
+// workspaceRole returns the principal's role in the workspace, or
+// ErrForbidden if they are not a member
+func (p *Policy) workspaceRole(ctx context.Context, principal *auth.Principal, workspaceID int) (WorkspaceRole, error) {
+	if principal == nil {
+		return "", ErrForbidden
+	}
+
+	member, err := p.db.GetWorkspaceMember(ctx, workspaceID, principal.UserID)
+	if errors.Is(err, database.ErrNotFound) {
+		return "", ErrForbidden
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return WorkspaceRole(member.Role), nil
+}
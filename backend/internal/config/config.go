@@ -0,0 +1,430 @@
+// Package config loads the API server's configuration once at startup.
+//
+// Settings come from, in increasing order of precedence:
+//
+//  1. defaults, some of which depend on the profile
+//  2. the config file: $CONFIG_FILE, or config.toml, config.yaml or
+//     config.yml in the working directory if one exists. Settings under
+//     profiles.<profile> override the others in the file.
+//  3. .env, then .env.<profile>
+//  4. environment variables
+//
+// The profile is selected with APP_ENV: development (the default), staging
+// or production. Everything is validated by Load, so a misconfigured server
+// fails to start instead of failing requests.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+)
+
+// Profiles
+const (
+	Development = "development"
+	Staging     = "staging"
+	Production  = "production"
+)
+
+// Log formats
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// minSecretLength is the shortest JWT secret accepted outside development
+const minSecretLength = 32
+
+// configFiles are looked for in the working directory when CONFIG_FILE is not set
+var configFiles = []string{"config.toml", "config.yaml", "config.yml"}
+
+type Config struct {
+	Profile  string
+	Server   Server
+	Database Database
+	Auth     Auth
+	Provider Provider
+	Limits   Limits
+	Logging  Logging
+}
+
+type Server struct {
+	Port           int
+	AppURL         string        // frontend URL share and invite links point to, none if empty
+	CORSOrigins    []string      // origins allowed to call the API
+	TrashRetention time.Duration // how long deleted chats stay in the trash
+	MetricsToken   string        // bearer token /metrics requires, open if empty
+}
+
+type Database struct {
+	URL             string
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+type Auth struct {
+	JWTSecret string
+	TokenTTL  time.Duration // lifetime of session tokens
+}
+
+type Provider struct {
+	GeminiAPIKey    string
+	GenerationModel string // used for code generation
+	CompletionModel string // faster model used for inline completions
+}
+
+type Logging struct {
+	Level      slog.Level
+	Format     string // LogFormatText or LogFormatJSON
+	LogPrompts bool   // log prompts and code instead of redacting them
+}
+
+// Limits bound what requests may contain
+type Limits struct {
+	MaxPromptLength int      // characters of a prompt or edited message
+	MaxCodeLength   int      // characters of code sent with a task
+	Languages       []string // allowed language values, any language name when empty
+}
+
+// Load reads and validates the configuration. Its error lists every
+// invalid setting.
+func Load() (*Config, error) {
+	l := &loader{used: make(map[string]bool)}
+	if err := l.readDotEnv(); err != nil {
+		return nil, err
+	}
+	if err := l.readFile(); err != nil {
+		return nil, err
+	}
+
+	cfg := defaults(l.profile)
+	l.int(&cfg.Server.Port, "server.port", "PORT")
+	l.string(&cfg.Server.AppURL, "server.app_url", "APP_URL")
+	l.list(&cfg.Server.CORSOrigins, "server.cors_origins", "CORS_ORIGINS")
+	retentionDays := int(cfg.Server.TrashRetention / (24 * time.Hour))
+	l.int(&retentionDays, "server.trash_retention_days", "TRASH_RETENTION_DAYS")
+	cfg.Server.TrashRetention = time.Duration(retentionDays) * 24 * time.Hour
+	l.string(&cfg.Server.MetricsToken, "server.metrics_token", "METRICS_TOKEN")
+
+	l.string(&cfg.Database.URL, "database.url", "DATABASE_URL")
+	l.int(&cfg.Database.MaxOpenConns, "database.max_open_conns", "DB_MAX_OPEN_CONNS")
+	l.int(&cfg.Database.MaxIdleConns, "database.max_idle_conns", "DB_MAX_IDLE_CONNS")
+	l.duration(&cfg.Database.ConnMaxLifetime, "database.conn_max_lifetime", "DB_CONN_MAX_LIFETIME")
+
+	l.string(&cfg.Auth.JWTSecret, "auth.jwt_secret", "JWT_SECRET")
+	l.duration(&cfg.Auth.TokenTTL, "auth.token_ttl", "JWT_TTL")
+
+	l.string(&cfg.Provider.GeminiAPIKey, "provider.gemini_api_key", "GEMINI_API_KEY")
+	l.string(&cfg.Provider.GenerationModel, "provider.generation_model", "GENERATION_MODEL")
+	l.string(&cfg.Provider.CompletionModel, "provider.completion_model", "COMPLETION_MODEL")
+
+	l.int(&cfg.Limits.MaxPromptLength, "limits.max_prompt_length", "MAX_PROMPT_LENGTH")
+	l.int(&cfg.Limits.MaxCodeLength, "limits.max_code_length", "MAX_CODE_LENGTH")
+	l.list(&cfg.Limits.Languages, "limits.languages", "ALLOWED_LANGUAGES")
+	for i, language := range cfg.Limits.Languages {
+		cfg.Limits.Languages[i] = strings.ToLower(language)
+	}
+
+	l.level(&cfg.Logging.Level, "logging.level", "LOG_LEVEL")
+	l.string(&cfg.Logging.Format, "logging.format", "LOG_FORMAT")
+	l.bool(&cfg.Logging.LogPrompts, "logging.log_prompts", "LOG_PROMPTS")
+
+	for _, key := range slices.Sorted(maps.Keys(l.file)) {
+		if !l.used[key] {
+			l.errs = append(l.errs, fmt.Errorf("%s: unknown setting %s", l.fileName, key))
+		}
+	}
+
+	errs := append(l.errs, cfg.validate()...)
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid configuration (profile %s):\n%w", cfg.Profile, errors.Join(errs...))
+	}
+	return cfg, nil
+}
+
+func defaults(profile string) *Config {
+	cfg := &Config{
+		Profile: profile,
+		Server: Server{
+			Port:           8080,
+			CORSOrigins:    []string{"https://code-genration-copilot.vercel.app"},
+			TrashRetention: 30 * 24 * time.Hour,
+		},
+		Database: Database{
+			MaxOpenConns:    10,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: time.Hour,
+		},
+		Auth: Auth{
+			TokenTTL: 24 * time.Hour,
+		},
+		Provider: Provider{
+			GenerationModel: "gemini-2.5-flash",
+			CompletionModel: "gemini-2.5-flash-lite",
+		},
+		Limits: Limits{
+			MaxPromptLength: 20000,
+			MaxCodeLength:   100000,
+		},
+		Logging: Logging{
+			Level:  slog.LevelInfo,
+			Format: LogFormatJSON,
+		},
+	}
+	if profile == Development {
+		cfg.Server.CORSOrigins = append([]string{"http://localhost:3000"}, cfg.Server.CORSOrigins...)
+		cfg.Logging.Format = LogFormatText
+	}
+	return cfg
+}
+
+// validate checks the settings against each other and the profile
+func (cfg *Config) validate() []error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(slices.Contains([]string{Development, Staging, Production}, cfg.Profile),
+		"APP_ENV must be one of: development, staging, production")
+	strict := cfg.Profile != Development
+
+	check(cfg.Server.Port > 0 && cfg.Server.Port < 65536, "PORT must be between 1 and 65535")
+	if cfg.Server.AppURL != "" {
+		check(isHTTPURL(cfg.Server.AppURL), "APP_URL must be an http(s) URL")
+	}
+	check(len(cfg.Server.CORSOrigins) > 0, "CORS_ORIGINS is required")
+	for _, origin := range cfg.Server.CORSOrigins {
+		if origin == "*" {
+			check(!strict, "CORS_ORIGINS cannot allow every origin outside development")
+			continue
+		}
+		check(isHTTPURL(origin), "CORS_ORIGINS: %q is not an http(s) origin", origin)
+	}
+	check(cfg.Server.TrashRetention > 0, "TRASH_RETENTION_DAYS must be positive")
+
+	check(cfg.Database.URL != "", "DATABASE_URL is required")
+	check(cfg.Database.MaxOpenConns > 0, "DB_MAX_OPEN_CONNS must be positive")
+	check(cfg.Database.MaxIdleConns >= 0 && cfg.Database.MaxIdleConns <= cfg.Database.MaxOpenConns,
+		"DB_MAX_IDLE_CONNS must be between 0 and DB_MAX_OPEN_CONNS")
+	check(cfg.Database.ConnMaxLifetime > 0, "DB_CONN_MAX_LIFETIME must be positive")
+
+	check(cfg.Auth.JWTSecret != "", "JWT_SECRET is required")
+	if cfg.Auth.JWTSecret != "" && strict {
+		check(len(cfg.Auth.JWTSecret) >= minSecretLength, "JWT_SECRET must be at least %d bytes outside development", minSecretLength)
+	}
+	check(cfg.Auth.TokenTTL >= time.Minute, "JWT_TTL must be at least 1m")
+
+	// Development can run without a key; generation fails until one is set
+	if strict {
+		check(cfg.Provider.GeminiAPIKey != "", "GEMINI_API_KEY is required outside development")
+	}
+	check(cfg.Provider.GenerationModel != "", "GENERATION_MODEL is required")
+	check(cfg.Provider.CompletionModel != "", "COMPLETION_MODEL is required")
+
+	check(cfg.Limits.MaxPromptLength > 0, "MAX_PROMPT_LENGTH must be positive")
+	check(cfg.Limits.MaxCodeLength > 0, "MAX_CODE_LENGTH must be positive")
+
+	check(cfg.Logging.Format == LogFormatText || cfg.Logging.Format == LogFormatJSON, "LOG_FORMAT must be text or json")
+	check(!cfg.Logging.LogPrompts || cfg.Profile != Production, "LOG_PROMPTS cannot be enabled in production")
+
+	return errs
+}
+
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// loader looks settings up by precedence and collects what is wrong with them
+type loader struct {
+	profile  string
+	dotEnv   []map[string]string // .env.<profile> first
+	file     map[string]string   // config file settings, the profile applied
+	fileName string
+	used     map[string]bool // config file settings that were read
+	errs     []error
+}
+
+// readDotEnv reads .env and .env.<profile>, which may not exist. Unlike
+// godotenv.Load it leaves the process environment alone.
+func (l *loader) readDotEnv() error {
+	base, err := readDotEnvFile(".env")
+	if err != nil {
+		return err
+	}
+
+	// The profile itself can be chosen in .env
+	l.profile = os.Getenv("APP_ENV")
+	if l.profile == "" {
+		l.profile = base["APP_ENV"]
+	}
+	if l.profile == "" {
+		l.profile = Development
+	}
+
+	profile, err := readDotEnvFile(".env." + l.profile)
+	if err != nil {
+		return err
+	}
+	l.dotEnv = []map[string]string{profile, base}
+	return nil
+}
+
+func readDotEnvFile(path string) (map[string]string, error) {
+	values, err := godotenv.Read(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return values, nil
+}
+
+// readFile reads the config file, if any, and applies the profile's
+// overrides in it
+func (l *loader) readFile() error {
+	path, explicit := l.env("CONFIG_FILE")
+	if !explicit {
+		for _, name := range configFiles {
+			if _, err := os.Stat(name); err == nil {
+				path = name
+				break
+			}
+		}
+	}
+	if path == "" {
+		return nil
+	}
+
+	values, err := readFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	l.fileName = path
+	l.file = make(map[string]string)
+	override := "profiles." + l.profile + "."
+	for key, value := range values {
+		if !strings.HasPrefix(key, "profiles.") {
+			l.file[key] = value
+		}
+	}
+	for key, value := range values {
+		if name, ok := strings.CutPrefix(key, override); ok {
+			l.file[name] = value
+		}
+	}
+	return nil
+}
+
+// env looks a variable up in the environment, then in the .env files
+func (l *loader) env(name string) (string, bool) {
+	if value, ok := os.LookupEnv(name); ok {
+		return value, true
+	}
+	for _, values := range l.dotEnv {
+		if value, ok := values[name]; ok {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// lookup returns the value of a setting and where it comes from, for errors
+func (l *loader) lookup(key, env string) (value, source string, ok bool) {
+	l.used[key] = true
+	if value, ok := l.env(env); ok {
+		return value, env, true
+	}
+	if value, ok := l.file[key]; ok {
+		return value, l.fileName + " " + key, true
+	}
+	return "", "", false
+}
+
+func (l *loader) string(dst *string, key, env string) {
+	if value, _, ok := l.lookup(key, env); ok {
+		*dst = strings.TrimSpace(value)
+	}
+}
+
+func (l *loader) int(dst *int, key, env string) {
+	value, source, ok := l.lookup(key, env)
+	if !ok {
+		return
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s: %q is not a whole number", source, value))
+		return
+	}
+	*dst = n
+}
+
+func (l *loader) duration(dst *time.Duration, key, env string) {
+	value, source, ok := l.lookup(key, env)
+	if !ok {
+		return
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(value))
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s: %q is not a duration like 30m or 24h", source, value))
+		return
+	}
+	*dst = d
+}
+
+func (l *loader) bool(dst *bool, key, env string) {
+	value, source, ok := l.lookup(key, env)
+	if !ok {
+		return
+	}
+	b, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s: %q is not true or false", source, value))
+		return
+	}
+	*dst = b
+}
+
+// level reads a log level: debug, info, warn or error
+func (l *loader) level(dst *slog.Level, key, env string) {
+	value, source, ok := l.lookup(key, env)
+	if !ok {
+		return
+	}
+	if err := dst.UnmarshalText([]byte(strings.TrimSpace(value))); err != nil {
+		l.errs = append(l.errs, fmt.Errorf("%s: %q is not a log level (debug, info, warn or error)", source, value))
+	}
+}
+
+// list reads a comma-separated list; empty items are dropped
+func (l *loader) list(dst *[]string, key, env string) {
+	value, _, ok := l.lookup(key, env)
+	if !ok {
+		return
+	}
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	*dst = items
+}
@@ -0,0 +1,244 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// readFile parses a TOML or YAML config file, chosen by its extension,
+// into settings keyed by their dotted path, e.g. "server.port". Lists are
+// joined with commas, like list settings in the environment.
+//
+// Only the subset of both formats configuration needs is supported: tables
+// or nested mappings, strings, numbers, booleans and lists of scalars.
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var values map[string]string
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".toml":
+		values, err = parseTOML(string(data))
+	case ".yaml", ".yml":
+		values, err = parseYAML(string(data))
+	default:
+		return nil, fmt.Errorf("%s: unsupported config format %q, use .toml, .yaml or .yml", path, ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return values, nil
+}
+
+func parseTOML(data string) (map[string]string, error) {
+	values := make(map[string]string)
+	table := ""
+
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(stripComment(scanner.Text()))
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if strings.HasPrefix(line, "[[") || !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("line %d: invalid table header %q", n, line)
+			}
+			table = strings.TrimSpace(line[1 : len(line)-1])
+			if !validKey(table) {
+				return nil, fmt.Errorf("line %d: invalid table name %q", n, table)
+			}
+			continue
+		}
+
+		key, raw, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || !validKey(key) {
+			return nil, fmt.Errorf("line %d: expected key = value", n)
+		}
+		if table != "" {
+			key = table + "." + key
+		}
+		if _, ok := values[key]; ok {
+			return nil, fmt.Errorf("line %d: %s is set twice", n, key)
+		}
+
+		value, err := parseValue(strings.TrimSpace(raw))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		values[key] = value
+	}
+	return values, scanner.Err()
+}
+
+func parseYAML(data string) (map[string]string, error) {
+	type level struct {
+		indent int
+		prefix string
+	}
+
+	values := make(map[string]string)
+	var parents []level
+	// listKey and listIndent track the key whose "- item" lines follow
+	listKey, listIndent := "", -1
+
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		text := strings.TrimRight(stripComment(scanner.Text()), " \r")
+		line := strings.TrimLeft(text, " ")
+		if line == "" || line == "---" {
+			continue
+		}
+		if strings.HasPrefix(line, "\t") {
+			return nil, fmt.Errorf("line %d: indent with spaces, not tabs", n)
+		}
+		indent := len(text) - len(line)
+
+		if line == "-" || strings.HasPrefix(line, "- ") {
+			if listKey == "" || indent < listIndent {
+				return nil, fmt.Errorf("line %d: list item without a key", n)
+			}
+			item, err := parseScalar(strings.TrimSpace(line[1:]))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			if values[listKey] != "" {
+				item = values[listKey] + "," + item
+			}
+			values[listKey] = item
+			continue
+		}
+
+		key, raw, ok := strings.Cut(line, ":")
+		key = strings.TrimSpace(key)
+		if !ok || !validKey(key) {
+			return nil, fmt.Errorf("line %d: expected key: value", n)
+		}
+
+		for len(parents) > 0 && parents[len(parents)-1].indent >= indent {
+			parents = parents[:len(parents)-1]
+		}
+		if len(parents) > 0 {
+			key = parents[len(parents)-1].prefix + key
+		}
+		if _, ok := values[key]; ok {
+			return nil, fmt.Errorf("line %d: %s is set twice", n, key)
+		}
+		listKey, listIndent = "", -1
+
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			// A mapping or a list follows
+			parents = append(parents, level{indent: indent, prefix: key + "."})
+			listKey, listIndent = key, indent
+			continue
+		}
+
+		value, err := parseValue(raw)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		values[key] = value
+	}
+	return values, scanner.Err()
+}
+
+// parseValue parses a scalar or a single-line list like ["a", "b"]
+func parseValue(raw string) (string, error) {
+	if !strings.HasPrefix(raw, "[") {
+		return parseScalar(raw)
+	}
+	if !strings.HasSuffix(raw, "]") {
+		return "", fmt.Errorf("lists must be written on one line: %s", raw)
+	}
+
+	var items []string
+	for _, item := range splitList(raw[1 : len(raw)-1]) {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		value, err := parseScalar(item)
+		if err != nil {
+			return "", err
+		}
+		items = append(items, value)
+	}
+	return strings.Join(items, ","), nil
+}
+
+func parseScalar(raw string) (string, error) {
+	switch {
+	case strings.HasPrefix(raw, `"`):
+		value, err := strconv.Unquote(raw)
+		if err != nil {
+			return "", fmt.Errorf("invalid string %s", raw)
+		}
+		return value, nil
+	case strings.HasPrefix(raw, "'"):
+		if len(raw) < 2 || !strings.HasSuffix(raw, "'") {
+			return "", fmt.Errorf("invalid string %s", raw)
+		}
+		return raw[1 : len(raw)-1], nil
+	}
+	return raw, nil
+}
+
+// splitList splits list items at commas outside quotes
+func splitList(s string) []string {
+	var items []string
+	var quote rune
+	start := 0
+	for i, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == ',':
+			items = append(items, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(items, s[start:])
+}
+
+// stripComment removes a # comment that is not inside quotes
+func stripComment(line string) string {
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func validKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, part := range strings.Split(key, ".") {
+		if part == "" || strings.ContainsAny(part, " \t\"'[]") {
+			return false
+		}
+	}
+	return true
+}
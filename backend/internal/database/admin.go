@@ -0,0 +1,210 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// UserFilter narrows down the users returned by ListUsers
+type UserFilter struct {
+	Query  string // matched against name and email
+	Role   string
+	Limit  int
+	Offset int
+}
+
+// UserUsage summarizes how much a single user has used the copilot
+type UserUsage struct {
+	UserID       int
+	ChatCount    int
+	MessageCount int
+	PromptCount  int
+	LastActiveAt *time.Time
+}
+
+// UsageStats summarizes usage across all users
+type UsageStats struct {
+	TotalUsers    int
+	DisabledUsers int
+	TotalChats    int
+	TotalMessages int
+	Prompts24h    int
+	Prompts7d     int
+	ActiveUsers7d int
+}
+
+func (s *service) ListUsers(ctx context.Context, filter UserFilter) ([]*User, int, error) {
+	where := `
+		WHERE ($1 = '' OR name ILIKE '%' || $1 || '%' OR email ILIKE '%' || $1 || '%')
+		AND ($2 = '' OR role = $2)
+	`
+
+	var total int
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM users`+where, filter.Query, filter.Role).Scan(&total)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count users: %w", err)
+	}
+
+	query := `
+		SELECT ` + userColumns + `
+		FROM users` + where + `
+		ORDER BY id ASC
+		LIMIT $3 OFFSET $4
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, filter.Query, filter.Role, filter.Limit, filter.Offset)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []*User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to list users: %w", err)
+	}
+
+	return users, total, nil
+}
+
+// UpdateUserRole changes a user's role. Existing tokens embed the old role,
+// so they are revoked as part of the update.
+func (s *service) UpdateUserRole(ctx context.Context, userId int, role string) error {
+	query := `
+		UPDATE users
+		SET role = $1, token_version = token_version + 1
+		WHERE id = $2
+	`
+
+	res, err := s.db.ExecContext(ctx, query, role, userId)
+	if err != nil {
+		return fmt.Errorf("failed to update user role: %w", err)
+	}
+
+	return requireRowAffected(res, "user")
+}
+
+// SetUserDisabled disables or re-enables an account. Disabling also revokes
+// its sessions and deletes its personal access tokens, so enabling it again
+// doesn't bring them back.
+func (s *service) SetUserDisabled(ctx context.Context, userId int, disabled bool) error {
+	query := `
+		WITH revoked AS (
+			DELETE FROM personal_access_tokens WHERE user_id = $2 AND $1
+		)
+		UPDATE users
+		SET disabled_at = CASE WHEN $1 THEN COALESCE(disabled_at, NOW()) ELSE NULL END,
+			token_version = token_version + CASE WHEN $1 THEN 1 ELSE 0 END
+		WHERE id = $2
+	`
+
+	res, err := s.db.ExecContext(ctx, query, disabled, userId)
+	if err != nil {
+		return fmt.Errorf("failed to update user status: %w", err)
+	}
+
+	return requireRowAffected(res, "user")
+}
+
+// RevokeUserSessions invalidates every session token issued to the user so
+// far and deletes their personal access tokens
+func (s *service) RevokeUserSessions(ctx context.Context, userId int) error {
+	query := `
+		WITH revoked AS (
+			DELETE FROM personal_access_tokens WHERE user_id = $1
+		)
+		UPDATE users
+		SET token_version = token_version + 1
+		WHERE id = $1
+	`
+
+	res, err := s.db.ExecContext(ctx, query, userId)
+	if err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	return requireRowAffected(res, "user")
+}
+
+func (s *service) GetUserUsage(ctx context.Context, userId int) (*UserUsage, error) {
+	query := `
+		SELECT
+			(SELECT COUNT(*) FROM chats WHERE user_id = $1),
+			COUNT(m.id),
+			COUNT(m.id) FILTER (WHERE m.role = 'user'),
+			MAX(m.created_at)
+		FROM chats c
+		LEFT JOIN messages m ON m.chat_id = c.id
+		WHERE c.user_id = $1
+	`
+
+	usage := UserUsage{UserID: userId}
+	var lastActive sql.NullTime
+	err := s.db.QueryRowContext(ctx, query, userId).Scan(
+		&usage.ChatCount,
+		&usage.MessageCount,
+		&usage.PromptCount,
+		&lastActive,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user usage: %w", err)
+	}
+
+	if lastActive.Valid {
+		usage.LastActiveAt = &lastActive.Time
+	}
+
+	return &usage, nil
+}
+
+func (s *service) GetUsageStats(ctx context.Context) (*UsageStats, error) {
+	query := `
+		SELECT
+			(SELECT COUNT(*) FROM users),
+			(SELECT COUNT(*) FROM users WHERE disabled_at IS NOT NULL),
+			(SELECT COUNT(*) FROM chats),
+			(SELECT COUNT(*) FROM messages),
+			(SELECT COUNT(*) FROM messages WHERE role = 'user' AND created_at > NOW() - INTERVAL '1 day'),
+			(SELECT COUNT(*) FROM messages WHERE role = 'user' AND created_at > NOW() - INTERVAL '7 days'),
+			(SELECT COUNT(DISTINCT c.user_id)
+				FROM messages m JOIN chats c ON c.id = m.chat_id
+				WHERE m.created_at > NOW() - INTERVAL '7 days')
+	`
+
+	var stats UsageStats
+	err := s.db.QueryRowContext(ctx, query).Scan(
+		&stats.TotalUsers,
+		&stats.DisabledUsers,
+		&stats.TotalChats,
+		&stats.TotalMessages,
+		&stats.Prompts24h,
+		&stats.Prompts7d,
+		&stats.ActiveUsers7d,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get usage stats: %w", err)
+	}
+
+	return &stats, nil
+}
+
+// requireRowAffected turns an UPDATE/DELETE that matched nothing into
+// ErrNotFound for the named resource
+func requireRowAffected(res sql.Result, resource string) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to read affected rows: %w", err)
+	}
+	if n == 0 {
+		return notFound(resource)
+	}
+	return nil
+}
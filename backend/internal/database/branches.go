@@ -0,0 +1,151 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Messages form a tree through parent_id: editing a prompt adds a sibling of
+// the original message, and every path from the root to a leaf is a branch.
+// chats.active_message_id points at the leaf of the branch being shown.
+
+// GetBranch returns the messages on the path from the root of the chat down
+// to leafId, in chronological order
+func (s *service) GetBranch(ctx context.Context, chatId, leafId int) ([]*Message, error) {
+	return s.queryBranch(ctx, chatId, "id = $2", leafId, 0)
+}
+
+// GetBranchPage returns the newest messages of the branch ending at leafId,
+// in chronological order, together with the cursor for loading the next
+// (older) page, which is nil once the root of the branch is reached
+func (s *service) GetBranchPage(ctx context.Context, chatId, leafId int, page Page) ([]*Message, *Cursor, error) {
+	start, startId := "id = $2", leafId
+	if page.After != nil {
+		// The cursor is the oldest message already loaded, continue with its parent
+		start = "id = (SELECT parent_id FROM messages WHERE id = $2)"
+		startId = page.After.ID
+	}
+
+	// One extra row is requested to find out whether older messages exist
+	messages, err := s.queryBranch(ctx, chatId, start, startId, page.Limit+1)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var next *Cursor
+	if len(messages) > page.Limit {
+		messages = messages[1:]
+		oldest := messages[0]
+		next = &Cursor{Time: oldest.CreatedAt, ID: oldest.ID}
+	}
+
+	return messages, next, nil
+}
+
+// queryBranch walks parent pointers upwards from the message matching start,
+// returning at most limit messages (0 means no limit) oldest first
+func (s *service) queryBranch(ctx context.Context, chatId int, start string, startId, limit int) ([]*Message, error) {
+	query := `
+		WITH RECURSIVE branch AS (
+			SELECT ` + messageColumns + `, 1 AS depth
+			FROM messages
+			WHERE chat_id = $1 AND ` + start + `
+			UNION ALL
+			SELECT ` + prefixColumns("m", messageColumns) + `, b.depth + 1
+			FROM messages m
+			JOIN branch b ON m.id = b.parent_id
+			WHERE $3 = 0 OR b.depth < $3
+		)
+		SELECT ` + messageColumns + `
+		FROM branch
+		ORDER BY depth DESC
+	`
+
+	return s.queryMessages(ctx, query, chatId, startId, limit)
+}
+
+// GetMessageSiblings maps each of the given messages to the IDs of all
+// messages sharing its parent (itself included), oldest first
+func (s *service) GetMessageSiblings(ctx context.Context, messageIds []int) (map[int][]int, error) {
+	query := `
+		SELECT m.id, s.id
+		FROM messages m
+		JOIN messages s ON s.chat_id = m.chat_id AND s.parent_id IS NOT DISTINCT FROM m.parent_id
+		WHERE m.id = ANY($1)
+		ORDER BY s.created_at ASC, s.id ASC
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, messageIds)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message siblings: %w", err)
+	}
+	defer rows.Close()
+
+	siblings := make(map[int][]int, len(messageIds))
+	for rows.Next() {
+		var messageId, siblingId int
+		if err := rows.Scan(&messageId, &siblingId); err != nil {
+			return nil, fmt.Errorf("failed to scan message sibling: %w", err)
+		}
+		siblings[messageId] = append(siblings[messageId], siblingId)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get message siblings: %w", err)
+	}
+
+	return siblings, nil
+}
+
+// GetLatestLeaf follows the most recent reply from messageId downwards and
+// returns the leaf it ends at, so that selecting a message in the middle of a
+// tree shows the latest conversation that continued from it
+func (s *service) GetLatestLeaf(ctx context.Context, chatId, messageId int) (int, error) {
+	query := `
+		WITH RECURSIVE path AS (
+			SELECT id, 1 AS depth
+			FROM messages
+			WHERE chat_id = $1 AND id = $2
+			UNION ALL
+			SELECT child.id, p.depth + 1
+			FROM path p
+			CROSS JOIN LATERAL (
+				SELECT id FROM messages
+				WHERE parent_id = p.id
+				ORDER BY created_at DESC, id DESC
+				LIMIT 1
+			) child
+		)
+		SELECT id FROM path
+		ORDER BY depth DESC
+		LIMIT 1
+	`
+
+	var leafId int
+	err := s.db.QueryRowContext(ctx, query, chatId, messageId).Scan(&leafId)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, notFound("message")
+		}
+		return 0, fmt.Errorf("failed to get latest leaf: %w", err)
+	}
+
+	return leafId, nil
+}
+
+// SetActiveMessage switches the branch shown for a chat. It does not count
+// as activity, so updated_at is left alone.
+func (s *service) SetActiveMessage(ctx context.Context, chatId, messageId int) error {
+	query := `
+		UPDATE chats
+		SET active_message_id = $2
+		WHERE id = $1
+	`
+
+	res, err := s.db.ExecContext(ctx, query, chatId, messageId)
+	if err != nil {
+		return fmt.Errorf("failed to set active message: %w", err)
+	}
+
+	return requireRowAffected(res, "chat")
+}
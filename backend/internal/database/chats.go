@@ -0,0 +1,128 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// ChatFilter narrows down chat listings. A nil pointer means "don't filter".
+type ChatFilter struct {
+	Archived *bool
+	Pinned   *bool
+	Trashed  bool // list chats in the trash instead of live chats
+}
+
+// ChatUpdate holds the chat fields to change. Nil fields are left as is.
+type ChatUpdate struct {
+	Title    *string
+	Pinned   *bool
+	Archived *bool
+}
+
+// conditions renders the filter as extra WHERE conditions, appending
+// their parameters to args
+func (f ChatFilter) conditions(args []any) (string, []any) {
+	clause := ""
+	if f.Trashed {
+		clause += " AND deleted_at IS NOT NULL"
+	} else {
+		clause += " AND deleted_at IS NULL"
+	}
+	if f.Archived != nil {
+		args = append(args, *f.Archived)
+		clause += " AND (archived_at IS NOT NULL) = $" + strconv.Itoa(len(args))
+	}
+	if f.Pinned != nil {
+		args = append(args, *f.Pinned)
+		clause += " AND pinned = $" + strconv.Itoa(len(args))
+	}
+	return clause, args
+}
+
+// UpdateChat changes a chat's title, pin and archive state. Only a new title
+// counts as an update: pinning and archiving keep the chat's place in
+// listings, which are ordered by updated_at.
+func (s *service) UpdateChat(ctx context.Context, chatId int, update ChatUpdate) (*Chat, error) {
+	query := `
+		UPDATE chats
+		SET title = COALESCE($2, title),
+			pinned = COALESCE($3, pinned),
+			archived_at = CASE
+				WHEN $4::boolean IS NULL THEN archived_at
+				WHEN $4::boolean THEN COALESCE(archived_at, NOW())
+				ELSE NULL
+			END,
+			updated_at = CASE
+				WHEN $2::text IS NOT NULL AND $2::text IS DISTINCT FROM title THEN NOW()
+				ELSE updated_at
+			END
+		WHERE id = $1
+		RETURNING ` + chatColumns + `
+	`
+
+	chat, err := scanChat(s.db.QueryRowContext(ctx, query, chatId, update.Title, update.Pinned, update.Archived))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("chat")
+		}
+		return nil, fmt.Errorf("failed to update chat: %w", err)
+	}
+
+	return chat, nil
+}
+
+// SoftDeleteChat moves a chat to the trash
+func (s *service) SoftDeleteChat(ctx context.Context, chatId int) error {
+	query := `
+		UPDATE chats
+		SET deleted_at = COALESCE(deleted_at, NOW())
+		WHERE id = $1
+	`
+
+	res, err := s.db.ExecContext(ctx, query, chatId)
+	if err != nil {
+		return fmt.Errorf("failed to delete chat: %w", err)
+	}
+
+	return requireRowAffected(res, "chat")
+}
+
+// RestoreChat takes a chat out of the trash
+func (s *service) RestoreChat(ctx context.Context, chatId int) error {
+	query := `
+		UPDATE chats
+		SET deleted_at = NULL
+		WHERE id = $1
+	`
+
+	res, err := s.db.ExecContext(ctx, query, chatId)
+	if err != nil {
+		return fmt.Errorf("failed to restore chat: %w", err)
+	}
+
+	return requireRowAffected(res, "chat")
+}
+
+// PurgeChat permanently deletes a chat and its messages
+func (s *service) PurgeChat(ctx context.Context, chatId int) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM chats WHERE id = $1`, chatId)
+	if err != nil {
+		return fmt.Errorf("failed to purge chat: %w", err)
+	}
+
+	return requireRowAffected(res, "chat")
+}
+
+// PurgeDeletedChats permanently deletes chats that were moved to the trash
+// before deletedBefore and returns how many were removed
+func (s *service) PurgeDeletedChats(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM chats WHERE deleted_at IS NOT NULL AND deleted_at < $1`, deletedBefore)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge deleted chats: %w", err)
+	}
+
+	return res.RowsAffected()
+}
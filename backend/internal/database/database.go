@@ -1,13 +1,17 @@
 package database
 
 import (
+	"backend/internal/config"
 	"context"
 	"database/sql"
 	"fmt"
 	"log"
+	"log/slog"
+	"strconv"
 	"time"
 
-	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
 )
 
 type Service interface {
@@ -16,36 +20,103 @@ type Service interface {
 	CreateUser(ctx context.Context, name, email, password string) (*User, error)
 	CheckEmailExists(ctx context.Context, email string) (bool, error)
 	GetUserByEmail(ctx context.Context, email string) (*User, error)
-	CreateChat(ctx context.Context, userId int, title string) (*Chat, error)
-	GetChatsByUser(ctx context.Context, userId int) ([]*Chat, error)
+	GetUserByID(ctx context.Context, userId int) (*User, error)
+	ListUsers(ctx context.Context, filter UserFilter) ([]*User, int, error)
+	UpdateUserRole(ctx context.Context, userId int, role string) error
+	SetUserDisabled(ctx context.Context, userId int, disabled bool) error
+	RevokeUserSessions(ctx context.Context, userId int) error
+	CreateAccessToken(ctx context.Context, userId int, name, tokenHash, prefix string, expiresAt *time.Time) (*AccessToken, error)
+	GetAccessTokensByUser(ctx context.Context, userId int) ([]*AccessToken, error)
+	UseAccessToken(ctx context.Context, tokenHash string) (*AccessToken, error)
+	DeleteAccessToken(ctx context.Context, userId, tokenId int) error
+	GetUserUsage(ctx context.Context, userId int) (*UserUsage, error)
+	GetUsageStats(ctx context.Context) (*UsageStats, error)
+	CreateChat(ctx context.Context, userId int, workspaceId *int, title string) (*Chat, error)
+	GetChatsByUser(ctx context.Context, userId int, filter ChatFilter, page Page) ([]*Chat, *Cursor, error)
+	GetChatsByWorkspace(ctx context.Context, workspaceId int, filter ChatFilter, page Page) ([]*Chat, *Cursor, error)
 	GetChatByID(ctx context.Context, chatId int) (*Chat, error)
 	UpdateChatTitle(ctx context.Context, chatId int, title string) error
-	CreateMessage(ctx context.Context, chatId int, role, content, language string) (*Message, error)
+	UpdateChat(ctx context.Context, chatId int, update ChatUpdate) (*Chat, error)
+	SoftDeleteChat(ctx context.Context, chatId int) error
+	RestoreChat(ctx context.Context, chatId int) error
+	PurgeChat(ctx context.Context, chatId int) error
+	PurgeDeletedChats(ctx context.Context, deletedBefore time.Time) (int64, error)
+	ImportChat(ctx context.Context, userId int, workspaceId *int, title string, messages []ImportedMessage) (*Chat, error)
+	CreateMessage(ctx context.Context, params CreateMessageParams) (*Message, error)
+	GetMessageByID(ctx context.Context, messageId int) (*Message, error)
 	GetMessagesByChat(ctx context.Context, chatId int) ([]*Message, error)
+	GetBranch(ctx context.Context, chatId, leafId int) ([]*Message, error)
+	GetBranchPage(ctx context.Context, chatId, leafId int, page Page) ([]*Message, *Cursor, error)
+	GetMessageSiblings(ctx context.Context, messageIds []int) (map[int][]int, error)
+	GetLatestLeaf(ctx context.Context, chatId, messageId int) (int, error)
+	SetActiveMessage(ctx context.Context, chatId, messageId int) error
+	SetMessageFeedback(ctx context.Context, messageId, userId, rating int, category, comment string) (*MessageFeedback, error)
+	DeleteMessageFeedback(ctx context.Context, messageId, userId int) error
+	GetMessageFeedbackByUser(ctx context.Context, userId int, messageIds []int) (map[int]*MessageFeedback, error)
+	GetFeedbackStats(ctx context.Context, filter FeedbackFilter) ([]*FeedbackStats, error)
+	ExportFeedback(ctx context.Context, filter FeedbackFilter, fn func(*FeedbackExample) error) error
+	Search(ctx context.Context, filter SearchFilter) ([]*SearchResult, error)
+	CreateSnippet(ctx context.Context, params CreateSnippetParams) (*Snippet, error)
+	GetSnippetByID(ctx context.Context, snippetId int) (*Snippet, error)
+	GetSnippetsByUser(ctx context.Context, userId int, filter SnippetFilter, page Page) ([]*Snippet, *Cursor, error)
+	UpdateSnippet(ctx context.Context, snippetId int, update SnippetUpdate) (*Snippet, error)
+	DeleteSnippet(ctx context.Context, snippetId int) error
+	GetSnippetVersions(ctx context.Context, snippetId int) ([]*SnippetVersion, error)
+	GetSnippetVersion(ctx context.Context, snippetId, version int) (*SnippetVersion, error)
+	CreateWorkspace(ctx context.Context, ownerId int, name string) (*Workspace, error)
+	GetWorkspaceByID(ctx context.Context, workspaceId int) (*Workspace, error)
+	GetWorkspacesByUser(ctx context.Context, userId int) ([]*Workspace, error)
+	UpdateWorkspaceName(ctx context.Context, workspaceId int, name string) error
+	DeleteWorkspace(ctx context.Context, workspaceId int) error
+	GetWorkspaceMember(ctx context.Context, workspaceId, userId int) (*WorkspaceMember, error)
+	GetWorkspaceMembers(ctx context.Context, workspaceId int) ([]*WorkspaceMember, error)
+	UpdateWorkspaceMemberRole(ctx context.Context, workspaceId, userId int, role string) error
+	RemoveWorkspaceMember(ctx context.Context, workspaceId, userId int) error
+	CreateWorkspaceInvite(ctx context.Context, invite *WorkspaceInvite) (*WorkspaceInvite, error)
+	GetWorkspaceInviteByJTI(ctx context.Context, jti string) (*WorkspaceInvite, error)
+	GetWorkspaceInvites(ctx context.Context, workspaceId int) ([]*WorkspaceInvite, error)
+	DeleteWorkspaceInvite(ctx context.Context, workspaceId, inviteId int) error
+	AcceptWorkspaceInvite(ctx context.Context, inviteId, userId int) (*WorkspaceMember, error)
+	CreateChatShare(ctx context.Context, chatId, createdBy int, tokenHash, prefix string, expiresAt *time.Time) (*ChatShare, error)
+	GetChatSharesByChat(ctx context.Context, chatId int) ([]*ChatShare, error)
+	GetChatShareByTokenHash(ctx context.Context, tokenHash string) (*ChatShare, error)
+	RevokeChatShare(ctx context.Context, chatId, shareId int) error
 }
 
 type User struct {
-	ID        int
-	Name      string
-	Email     string
-	Password  string
-	CreatedAt time.Time
+	ID           int
+	Name         string
+	Email        string
+	Password     string
+	Role         string
+	DisabledAt   *time.Time
+	TokenVersion int
+	CreatedAt    time.Time
 }
 
 type Chat struct {
-	ID        int
-	Title     string
-	UserID    int
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID              int
+	Title           string
+	UserID          int
+	WorkspaceID     *int
+	ActiveMessageID *int // leaf of the branch currently shown
+	Pinned          bool
+	ArchivedAt      *time.Time
+	DeletedAt       *time.Time
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
 }
 
 type Message struct {
 	ID        int
 	ChatID    int
+	ParentID  *int // previous message in the branch, nil for the first prompt
 	Role      string
 	Content   string
 	Language  string
+	Model     string // model that generated an assistant message
+	Mode      string // task mode, "generate" unless set otherwise
+	Metadata  []byte // JSON task input of a prompt or structured result of a reply, nil if none
 	CreatedAt time.Time
 }
 
@@ -55,21 +126,24 @@ type service struct {
 
 var _ Service = (*service)(nil)
 
-func New(connectionString string) Service {
-	db, err := sql.Open("pgx", connectionString)
+func New(cfg config.Database) Service {
+	connConfig, err := pgx.ParseConfig(cfg.URL)
 	if err != nil {
-		log.Fatal(err)
+		log.Fatalf("Invalid DATABASE_URL: %v", err)
 	}
+	connConfig.Tracer = queryTracer{}
+	db := stdlib.OpenDB(*connConfig)
 
-	db.SetMaxIdleConns(5)
-	db.SetMaxOpenConns(10)
-	db.SetConnMaxLifetime(1 * time.Hour)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
 
 	if err := db.Ping(); err != nil {
 		log.Fatalf("Could not connect to database: %v", err)
 	}
 
-	fmt.Println("Connected to PostgreSQL database successfully!")
+	slog.Info("Connected to PostgreSQL database")
+	registerPoolMetrics(db)
 
 	return &service{
 		db: db,
@@ -87,7 +161,7 @@ func (s *service) Health() map[string]string {
 	if err != nil {
 		stats["status"] = "down"
 		stats["error"] = fmt.Sprintf("db down: %v", err)
-		log.Fatalf("db down: %v", err) // Log fatal error if db is down
+		slog.ErrorContext(ctx, "Database is down", "error", err)
 		return stats
 	}
 
@@ -126,7 +200,7 @@ func (s *service) Health() map[string]string {
 }
 
 func (s *service) Close() error {
-	fmt.Println("Closing database connection...")
+	slog.Info("Closing database connection")
 	return s.db.Close()
 }
 
@@ -134,23 +208,15 @@ func (s *service) CreateUser(ctx context.Context, name, email, password string)
 	query := `
 		INSERT INTO users (name, email, password, created_at)
 		VALUES ($1, $2, $3, NOW())
-		RETURNING id, name, email, password, created_at
+		RETURNING ` + userColumns + `
 	`
 
-	var user User
-	err := s.db.QueryRowContext(ctx, query, name, email, password).Scan(
-		&user.ID,
-		&user.Name,
-		&user.Email,
-		&user.Password,
-		&user.CreatedAt,
-	)
-
+	user, err := scanUser(s.db.QueryRowContext(ctx, query, name, email, password))
 	if err != nil {
-		return nil, fmt.Errorf("failed to create user: %w", err)
+		return nil, conflict(err, "email", "failed to create user")
 	}
 
-	return &user, nil
+	return user, nil
 }
 
 func (s *service) CheckEmailExists(ctx context.Context, email string) (bool, error) {
@@ -167,62 +233,134 @@ func (s *service) CheckEmailExists(ctx context.Context, email string) (bool, err
 
 func (s *service) GetUserByEmail(ctx context.Context, email string) (*User, error) {
 	query := `
-		SELECT id, name, email, password, created_at
+		SELECT ` + userColumns + `
 		FROM users
 		WHERE email = $1
 	`
 
+	user, err := scanUser(s.db.QueryRowContext(ctx, query, email))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("user")
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return user, nil
+}
+
+func (s *service) GetUserByID(ctx context.Context, userId int) (*User, error) {
+	query := `
+		SELECT ` + userColumns + `
+		FROM users
+		WHERE id = $1
+	`
+
+	user, err := scanUser(s.db.QueryRowContext(ctx, query, userId))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("user")
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return user, nil
+}
+
+// userColumns lists the users columns in the order expected by scanUser
+const userColumns = `id, name, email, password, role, disabled_at, token_version, created_at`
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanUser(row rowScanner) (*User, error) {
 	var user User
-	err := s.db.QueryRowContext(ctx, query, email).Scan(
+	var disabledAt sql.NullTime
+	err := row.Scan(
 		&user.ID,
 		&user.Name,
 		&user.Email,
 		&user.Password,
+		&user.Role,
+		&disabledAt,
+		&user.TokenVersion,
 		&user.CreatedAt,
 	)
-
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("user not found")
-		}
-		return nil, fmt.Errorf("failed to get user: %w", err)
+		return nil, err
+	}
+
+	if disabledAt.Valid {
+		user.DisabledAt = &disabledAt.Time
 	}
 
 	return &user, nil
 }
 
-func (s *service) CreateChat(ctx context.Context, userId int, title string) (*Chat, error) {
+func (s *service) CreateChat(ctx context.Context, userId int, workspaceId *int, title string) (*Chat, error) {
 	query := `
-		INSERT INTO chats (user_id, title, created_at, updated_at)
-		VALUES ($1, $2, NOW(), NOW())
-		RETURNING id, user_id, title, created_at, updated_at
+		INSERT INTO chats (user_id, workspace_id, title, created_at, updated_at)
+		VALUES ($1, $2, $3, NOW(), NOW())
+		RETURNING ` + chatColumns + `
 	`
 
-	var chat Chat
-	err := s.db.QueryRowContext(ctx, query, userId, title).Scan(
-		&chat.ID,
-		&chat.UserID,
-		&chat.Title,
-		&chat.CreatedAt,
-		&chat.UpdatedAt,
-	)
-
+	chat, err := scanChat(s.db.QueryRowContext(ctx, query, userId, workspaceId, title))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create chat: %w", err)
 	}
 
-	return &chat, nil
+	return chat, nil
+}
+
+// GetChatsByUser returns a page of the user's personal chats, most recently
+// updated first, and the cursor of the next page (nil on the last page)
+func (s *service) GetChatsByUser(ctx context.Context, userId int, filter ChatFilter, page Page) ([]*Chat, *Cursor, error) {
+	return s.queryChatPage(ctx, "user_id = $1 AND workspace_id IS NULL", []any{userId}, filter, page)
 }
 
-func (s *service) GetChatsByUser(ctx context.Context, userId int) ([]*Chat, error) {
+// GetChatsByWorkspace returns a page of a workspace's chats, most recently
+// updated first, and the cursor of the next page (nil on the last page)
+func (s *service) GetChatsByWorkspace(ctx context.Context, workspaceId int, filter ChatFilter, page Page) ([]*Chat, *Cursor, error) {
+	return s.queryChatPage(ctx, "workspace_id = $1", []any{workspaceId}, filter, page)
+}
+
+// queryChatPage runs a keyset-paginated chat listing ordered by (updated_at, id)
+func (s *service) queryChatPage(ctx context.Context, where string, args []any, filter ChatFilter, page Page) ([]*Chat, *Cursor, error) {
+	conditions, args := filter.conditions(args)
+	if page.After != nil {
+		args = append(args, page.After.Time, page.After.ID)
+		conditions += fmt.Sprintf(" AND (updated_at, id) < ($%d::timestamp, $%d)", len(args)-1, len(args))
+	}
+	args = append(args, page.Limit+1)
+
 	query := `
-		SELECT id, user_id, title, created_at, updated_at
+		SELECT ` + chatColumns + `
 		FROM chats
-		WHERE user_id = $1
-		ORDER BY updated_at DESC
+		WHERE ` + where + conditions + `
+		ORDER BY updated_at DESC, id DESC
+		LIMIT $` + strconv.Itoa(len(args)) + `
 	`
 
-	rows, err := s.db.QueryContext(ctx, query, userId)
+	chats, err := s.queryChats(ctx, query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// One extra row was requested to find out whether another page exists
+	var next *Cursor
+	if len(chats) > page.Limit {
+		chats = chats[:page.Limit]
+		last := chats[len(chats)-1]
+		next = &Cursor{Time: last.UpdatedAt, ID: last.ID}
+	}
+
+	return chats, next, nil
+}
+
+func (s *service) queryChats(ctx context.Context, query string, args ...any) ([]*Chat, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get chats: %w", err)
 	}
@@ -230,18 +368,14 @@ func (s *service) GetChatsByUser(ctx context.Context, userId int) ([]*Chat, erro
 
 	var chats []*Chat
 	for rows.Next() {
-		var chat Chat
-		err := rows.Scan(
-			&chat.ID,
-			&chat.UserID,
-			&chat.Title,
-			&chat.CreatedAt,
-			&chat.UpdatedAt,
-		)
+		chat, err := scanChat(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan chat: %w", err)
 		}
-		chats = append(chats, &chat)
+		chats = append(chats, chat)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get chats: %w", err)
 	}
 
 	return chats, nil
@@ -249,28 +383,75 @@ func (s *service) GetChatsByUser(ctx context.Context, userId int) ([]*Chat, erro
 
 func (s *service) GetChatByID(ctx context.Context, chatId int) (*Chat, error) {
 	query := `
-		SELECT id, user_id, title, created_at, updated_at
+		SELECT ` + chatColumns + `
 		FROM chats
 		WHERE id = $1
 	`
 
-	var chat Chat
-	err := s.db.QueryRowContext(ctx, query, chatId).Scan(
-		&chat.ID,
-		&chat.UserID,
-		&chat.Title,
-		&chat.CreatedAt,
-		&chat.UpdatedAt,
-	)
-
+	chat, err := scanChat(s.db.QueryRowContext(ctx, query, chatId))
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("chat not found")
+			return nil, notFound("chat")
 		}
 		return nil, fmt.Errorf("failed to get chat: %w", err)
 	}
 
-	return &chat, nil
+	return chat, nil
+}
+
+// chatColumns lists the chats columns in the order expected by scanChat
+const chatColumns = `id, user_id, workspace_id, active_message_id, title, pinned, archived_at, deleted_at, created_at, updated_at`
+
+func scanChat(row rowScanner) (*Chat, error) {
+	var cs chatScan
+	if err := row.Scan(cs.dest()...); err != nil {
+		return nil, err
+	}
+	return cs.result(), nil
+}
+
+// chatScan holds the scan destinations for chatColumns, so that queries
+// selecting extra columns next to a chat can reuse them
+type chatScan struct {
+	chat            Chat
+	workspaceId     sql.NullInt64
+	activeMessageId sql.NullInt64
+	archivedAt      sql.NullTime
+	deletedAt       sql.NullTime
+}
+
+func (cs *chatScan) dest() []any {
+	return []any{
+		&cs.chat.ID,
+		&cs.chat.UserID,
+		&cs.workspaceId,
+		&cs.activeMessageId,
+		&cs.chat.Title,
+		&cs.chat.Pinned,
+		&cs.archivedAt,
+		&cs.deletedAt,
+		&cs.chat.CreatedAt,
+		&cs.chat.UpdatedAt,
+	}
+}
+
+func (cs *chatScan) result() *Chat {
+	chat := cs.chat
+	if cs.workspaceId.Valid {
+		id := int(cs.workspaceId.Int64)
+		chat.WorkspaceID = &id
+	}
+	if cs.activeMessageId.Valid {
+		id := int(cs.activeMessageId.Int64)
+		chat.ActiveMessageID = &id
+	}
+	if cs.archivedAt.Valid {
+		chat.ArchivedAt = &cs.archivedAt.Time
+	}
+	if cs.deletedAt.Valid {
+		chat.DeletedAt = &cs.deletedAt.Time
+	}
+	return &chat
 }
 
 func (s *service) UpdateChatTitle(ctx context.Context, chatId int, title string) error {
@@ -288,47 +469,75 @@ func (s *service) UpdateChatTitle(ctx context.Context, chatId int, title string)
 	return nil
 }
 
-func (s *service) CreateMessage(ctx context.Context, chatId int, role, content, language string) (*Message, error) {
+// CreateMessageParams describes a new message. ParentID is the message it
+// replies to or follows, and nil only for the first prompt of a branch.
+type CreateMessageParams struct {
+	ChatID   int
+	ParentID *int
+	Role     string
+	Content  string
+	Language string
+	Model    string
+	Mode     string // defaults to "generate"
+	Metadata []byte // JSON, optional
+}
+
+// CreateMessage stores a message and makes it the end of the chat's active branch
+func (s *service) CreateMessage(ctx context.Context, params CreateMessageParams) (*Message, error) {
 	query := `
-		INSERT INTO messages (chat_id, role, content, language, created_at)
-		VALUES ($1, $2, $3, $4, NOW())
-		RETURNING id, chat_id, role, content, language, created_at
+		WITH inserted AS (
+			INSERT INTO messages (chat_id, parent_id, role, content, language, model, mode, metadata, created_at)
+			VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), COALESCE(NULLIF($7, ''), 'generate'), $8::jsonb, NOW())
+			RETURNING ` + messageColumns + `
+		), touched AS (
+			UPDATE chats
+			SET active_message_id = (SELECT id FROM inserted), updated_at = NOW()
+			WHERE id = $1
+		)
+		SELECT ` + messageColumns + ` FROM inserted
 	`
 
-	var message Message
-	var lang sql.NullString
-	err := s.db.QueryRowContext(ctx, query, chatId, role, content, language).Scan(
-		&message.ID,
-		&message.ChatID,
-		&message.Role,
-		&message.Content,
-		&lang,
-		&message.CreatedAt,
-	)
-
+	row := s.db.QueryRowContext(ctx, query, params.ChatID, params.ParentID, params.Role, params.Content, params.Language, params.Model, params.Mode, nullJSON(params.Metadata))
+	message, err := scanMessage(row)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create message: %w", err)
 	}
 
-	if lang.Valid {
-		message.Language = lang.String
-	}
+	return message, nil
+}
 
-	// Update chat's updated_at timestamp
-	_, _ = s.db.ExecContext(ctx, "UPDATE chats SET updated_at = NOW() WHERE id = $1", chatId)
+func (s *service) GetMessageByID(ctx context.Context, messageId int) (*Message, error) {
+	query := `
+		SELECT ` + messageColumns + `
+		FROM messages
+		WHERE id = $1
+	`
 
-	return &message, nil
+	message, err := scanMessage(s.db.QueryRowContext(ctx, query, messageId))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("message")
+		}
+		return nil, fmt.Errorf("failed to get message: %w", err)
+	}
+
+	return message, nil
 }
 
+// GetMessagesByChat returns every message of a chat across all branches
 func (s *service) GetMessagesByChat(ctx context.Context, chatId int) ([]*Message, error) {
 	query := `
-		SELECT id, chat_id, role, content, language, created_at
+		SELECT ` + messageColumns + `
 		FROM messages
 		WHERE chat_id = $1
-		ORDER BY created_at ASC
+		ORDER BY created_at ASC, id ASC
 	`
 
-	rows, err := s.db.QueryContext(ctx, query, chatId)
+	return s.queryMessages(ctx, query, chatId)
+}
+
+func (s *service) queryMessages(ctx context.Context, query string, args ...any) ([]*Message, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get messages: %w", err)
 	}
@@ -336,24 +545,58 @@ func (s *service) GetMessagesByChat(ctx context.Context, chatId int) ([]*Message
 
 	var messages []*Message
 	for rows.Next() {
-		var message Message
-		var lang sql.NullString
-		err := rows.Scan(
-			&message.ID,
-			&message.ChatID,
-			&message.Role,
-			&message.Content,
-			&lang,
-			&message.CreatedAt,
-		)
+		message, err := scanMessage(rows)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan message: %w", err)
 		}
-		if lang.Valid {
-			message.Language = lang.String
-		}
-		messages = append(messages, &message)
+		messages = append(messages, message)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get messages: %w", err)
 	}
 
 	return messages, nil
 }
+
+// messageColumns lists the messages columns in the order expected by scanMessage
+const messageColumns = `id, chat_id, parent_id, role, content, language, model, mode, metadata, created_at`
+
+func scanMessage(row rowScanner) (*Message, error) {
+	var message Message
+	var parentId sql.NullInt64
+	var lang, model sql.NullString
+	err := row.Scan(
+		&message.ID,
+		&message.ChatID,
+		&parentId,
+		&message.Role,
+		&message.Content,
+		&lang,
+		&model,
+		&message.Mode,
+		&message.Metadata,
+		&message.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if parentId.Valid {
+		id := int(parentId.Int64)
+		message.ParentID = &id
+	}
+	if lang.Valid {
+		message.Language = lang.String
+	}
+	message.Model = model.String
+
+	return &message, nil
+}
+
+// nullJSON passes empty JSON documents to the database as NULL
+func nullJSON(data []byte) any {
+	if len(data) == 0 {
+		return nil
+	}
+	return string(data)
+}
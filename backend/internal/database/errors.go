@@ -0,0 +1,33 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Errors returned by the Service, wrapped with the name of the resource
+// involved, e.g. "chat not found". Match them with errors.Is.
+var (
+	ErrNotFound = errors.New("not found")
+	ErrConflict = errors.New("already exists")
+)
+
+// uniqueViolation is the Postgres error code of a unique constraint violation
+const uniqueViolation = "23505"
+
+// notFound reports that the named resource doesn't exist
+func notFound(resource string) error {
+	return fmt.Errorf("%s %w", resource, ErrNotFound)
+}
+
+// conflict turns a unique constraint violation into ErrConflict for the named
+// resource and wraps any other error with op
+func conflict(err error, resource, op string) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+		return fmt.Errorf("%s %w", resource, ErrConflict)
+	}
+	return fmt.Errorf("%s: %w", op, err)
+}
@@ -0,0 +1,251 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// MessageFeedback is a user's rating of an assistant message
+type MessageFeedback struct {
+	ID        int
+	MessageID int
+	UserID    int
+	Rating    int // 1 for thumbs up, -1 for thumbs down
+	Category  string
+	Comment   string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// FeedbackStats aggregates the ratings of messages with one language and model
+type FeedbackStats struct {
+	Language   string
+	Model      string
+	Up         int
+	Down       int
+	Categories map[string]int // thumbs down per category
+}
+
+// FeedbackFilter narrows down the feedback used for stats and exports
+type FeedbackFilter struct {
+	Rating int // 1 or -1, 0 for both
+	From   *time.Time
+	To     *time.Time
+}
+
+// FeedbackExample is a rated prompt/response pair
+type FeedbackExample struct {
+	MessageID int
+	Prompt    string
+	Response  string
+	Language  string
+	Model     string
+	Rating    int
+	Category  string
+	Comment   string
+	CreatedAt time.Time
+}
+
+// SetMessageFeedback creates or replaces the user's feedback on a message
+func (s *service) SetMessageFeedback(ctx context.Context, messageId, userId, rating int, category, comment string) (*MessageFeedback, error) {
+	query := `
+		INSERT INTO message_feedback (message_id, user_id, rating, category, comment, created_at, updated_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), NOW(), NOW())
+		ON CONFLICT (message_id, user_id) DO UPDATE
+		SET rating = EXCLUDED.rating,
+			category = EXCLUDED.category,
+			comment = EXCLUDED.comment,
+			updated_at = NOW()
+		RETURNING ` + feedbackColumns
+
+	feedback, err := scanFeedback(s.db.QueryRowContext(ctx, query, messageId, userId, rating, category, comment))
+	if err != nil {
+		return nil, fmt.Errorf("failed to save feedback: %w", err)
+	}
+
+	return feedback, nil
+}
+
+func (s *service) DeleteMessageFeedback(ctx context.Context, messageId, userId int) error {
+	query := `
+		DELETE FROM message_feedback
+		WHERE message_id = $1 AND user_id = $2
+	`
+
+	res, err := s.db.ExecContext(ctx, query, messageId, userId)
+	if err != nil {
+		return fmt.Errorf("failed to delete feedback: %w", err)
+	}
+
+	return requireRowAffected(res, "feedback")
+}
+
+// GetMessageFeedbackByUser maps the given messages to the user's feedback
+// on them, leaving out messages the user hasn't rated
+func (s *service) GetMessageFeedbackByUser(ctx context.Context, userId int, messageIds []int) (map[int]*MessageFeedback, error) {
+	query := `
+		SELECT ` + feedbackColumns + `
+		FROM message_feedback
+		WHERE user_id = $1 AND message_id = ANY($2)
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, userId, messageIds)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get feedback: %w", err)
+	}
+	defer rows.Close()
+
+	feedback := make(map[int]*MessageFeedback)
+	for rows.Next() {
+		f, err := scanFeedback(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan feedback: %w", err)
+		}
+		feedback[f.MessageID] = f
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get feedback: %w", err)
+	}
+
+	return feedback, nil
+}
+
+// GetFeedbackStats aggregates ratings per message language and model
+func (s *service) GetFeedbackStats(ctx context.Context, filter FeedbackFilter) ([]*FeedbackStats, error) {
+	conditions, args := filter.conditions(nil)
+	query := `
+		SELECT COALESCE(m.language, ''), COALESCE(m.model, ''), f.rating, COALESCE(f.category, ''), COUNT(*)
+		FROM message_feedback f
+		JOIN messages m ON m.id = f.message_id
+		WHERE TRUE` + conditions + `
+		GROUP BY 1, 2, 3, 4
+		ORDER BY 1, 2
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get feedback stats: %w", err)
+	}
+	defer rows.Close()
+
+	var stats []*FeedbackStats
+	for rows.Next() {
+		var language, model, category string
+		var rating, count int
+		if err := rows.Scan(&language, &model, &rating, &category, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan feedback stats: %w", err)
+		}
+
+		// Rows are ordered by language and model, so each group is contiguous
+		if len(stats) == 0 || stats[len(stats)-1].Language != language || stats[len(stats)-1].Model != model {
+			stats = append(stats, &FeedbackStats{Language: language, Model: model, Categories: map[string]int{}})
+		}
+		group := stats[len(stats)-1]
+
+		if rating > 0 {
+			group.Up += count
+		} else {
+			group.Down += count
+			if category != "" {
+				group.Categories[category] += count
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get feedback stats: %w", err)
+	}
+
+	return stats, nil
+}
+
+// ExportFeedback calls fn with every rated prompt/response pair matching
+// filter, oldest first, without loading them all into memory
+func (s *service) ExportFeedback(ctx context.Context, filter FeedbackFilter, fn func(*FeedbackExample) error) error {
+	conditions, args := filter.conditions(nil)
+	query := `
+		SELECT m.id, p.content, m.content, COALESCE(m.language, ''), COALESCE(m.model, ''),
+			f.rating, COALESCE(f.category, ''), COALESCE(f.comment, ''), f.created_at
+		FROM message_feedback f
+		JOIN messages m ON m.id = f.message_id
+		JOIN messages p ON p.id = m.parent_id
+		WHERE TRUE` + conditions + `
+		ORDER BY f.created_at ASC, f.id ASC
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to export feedback: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var example FeedbackExample
+		err := rows.Scan(
+			&example.MessageID,
+			&example.Prompt,
+			&example.Response,
+			&example.Language,
+			&example.Model,
+			&example.Rating,
+			&example.Category,
+			&example.Comment,
+			&example.CreatedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to scan feedback: %w", err)
+		}
+		if err := fn(&example); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// conditions returns the SQL conditions for the filter, appending their
+// arguments to args. The feedback table is expected to be aliased as f.
+func (f FeedbackFilter) conditions(args []any) (string, []any) {
+	conditions := ""
+	if f.Rating != 0 {
+		args = append(args, f.Rating)
+		conditions += " AND f.rating = $" + strconv.Itoa(len(args))
+	}
+	if f.From != nil {
+		args = append(args, *f.From)
+		conditions += " AND f.created_at >= $" + strconv.Itoa(len(args)) + "::timestamp"
+	}
+	if f.To != nil {
+		args = append(args, *f.To)
+		conditions += " AND f.created_at < $" + strconv.Itoa(len(args)) + "::timestamp"
+	}
+	return conditions, args
+}
+
+// feedbackColumns lists the columns expected by scanFeedback
+const feedbackColumns = `id, message_id, user_id, rating, category, comment, created_at, updated_at`
+
+func scanFeedback(row rowScanner) (*MessageFeedback, error) {
+	var feedback MessageFeedback
+	var category, comment sql.NullString
+	err := row.Scan(
+		&feedback.ID,
+		&feedback.MessageID,
+		&feedback.UserID,
+		&feedback.Rating,
+		&category,
+		&comment,
+		&feedback.CreatedAt,
+		&feedback.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	feedback.Category = category.String
+	feedback.Comment = comment.String
+
+	return &feedback, nil
+}
@@ -0,0 +1,70 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ImportedMessage is a message of a chat being imported
+type ImportedMessage struct {
+	Role      string
+	Content   string
+	Language  string
+	CreatedAt *time.Time // defaults to the import time
+}
+
+// ImportChat recreates a chat from an export in a single transaction. The
+// messages form one branch in the given order, which becomes the active one.
+func (s *service) ImportChat(ctx context.Context, userId int, workspaceId *int, title string, messages []ImportedMessage) (*Chat, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to import chat: %w", err)
+	}
+	defer tx.Rollback()
+
+	var chatId int
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO chats (user_id, workspace_id, title, created_at, updated_at)
+		VALUES ($1, $2, $3, NOW(), NOW())
+		RETURNING id
+	`, userId, workspaceId, title).Scan(&chatId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to import chat: %w", err)
+	}
+
+	var parentId *int
+	for _, message := range messages {
+		var id int
+		err := tx.QueryRowContext(ctx, `
+			INSERT INTO messages (chat_id, parent_id, role, content, language, created_at)
+			VALUES ($1, $2, $3, $4, $5, COALESCE($6, NOW()))
+			RETURNING id
+		`, chatId, parentId, message.Role, message.Content, message.Language, message.CreatedAt).Scan(&id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to import message: %w", err)
+		}
+		parentId = &id
+	}
+
+	// Keep the original timeline: the chat starts with its first message and
+	// was last updated with its last one
+	query := `
+		UPDATE chats
+		SET active_message_id = $2,
+			created_at = COALESCE((SELECT MIN(created_at) FROM messages WHERE chat_id = $1), created_at),
+			updated_at = COALESCE((SELECT MAX(created_at) FROM messages WHERE chat_id = $1), updated_at)
+		WHERE id = $1
+		RETURNING ` + chatColumns
+
+	chat, err := scanChat(tx.QueryRowContext(ctx, query, chatId, parentId))
+	if err != nil {
+		return nil, fmt.Errorf("failed to import chat: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to import chat: %w", err)
+	}
+
+	return chat, nil
+}
@@ -0,0 +1,35 @@
+package database
+
+import (
+	"backend/internal/metrics"
+	"database/sql"
+)
+
+// registerPoolMetrics exposes the connection pool statistics of db. It is
+// called once, by New.
+func registerPoolMetrics(db *sql.DB) {
+	gauge := func(name, help string, value func(sql.DBStats) int) {
+		metrics.NewGaugeFunc(name, help, func() float64 { return float64(value(db.Stats())) })
+	}
+	counter := func(name, help string, value func(sql.DBStats) float64) {
+		metrics.NewCounterFunc(name, help, func() float64 { return value(db.Stats()) })
+	}
+
+	gauge("copilot_db_open_connections", "Open database connections, in use or idle.",
+		func(s sql.DBStats) int { return s.OpenConnections })
+	gauge("copilot_db_in_use_connections", "Database connections in use.",
+		func(s sql.DBStats) int { return s.InUse })
+	gauge("copilot_db_idle_connections", "Idle database connections.",
+		func(s sql.DBStats) int { return s.Idle })
+	gauge("copilot_db_max_open_connections", "Maximum number of open database connections.",
+		func(s sql.DBStats) int { return s.MaxOpenConnections })
+
+	counter("copilot_db_wait_count_total", "Connections waited for because the pool was exhausted.",
+		func(s sql.DBStats) float64 { return float64(s.WaitCount) })
+	counter("copilot_db_wait_duration_seconds_total", "Time spent waiting for a connection.",
+		func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() })
+	counter("copilot_db_max_idle_closed_total", "Connections closed because of the idle connection limit.",
+		func(s sql.DBStats) float64 { return float64(s.MaxIdleClosed) })
+	counter("copilot_db_max_lifetime_closed_total", "Connections closed because they reached their maximum lifetime.",
+		func(s sql.DBStats) float64 { return float64(s.MaxLifetimeClosed) })
+}
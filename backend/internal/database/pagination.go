@@ -0,0 +1,54 @@
+package database
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Cursor marks a position in a keyset-paginated listing: the sort timestamp
+// and ID of the last row of the previous page
+type Cursor struct {
+	Time time.Time
+	ID   int
+}
+
+// Page requests up to Limit rows after the given cursor (nil for the first page)
+type Page struct {
+	Limit int
+	After *Cursor
+}
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// Encode returns an opaque, URL-safe representation of the cursor
+func (c Cursor) Encode() string {
+	raw := strconv.FormatInt(c.Time.UnixNano(), 10) + ":" + strconv.Itoa(c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeCursor parses a cursor produced by Cursor.Encode
+func DecodeCursor(s string) (*Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	nanos, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return nil, errInvalidCursor
+	}
+
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	i, err := strconv.Atoi(id)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	return &Cursor{Time: time.Unix(0, n).UTC(), ID: i}, nil
+}
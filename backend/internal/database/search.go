@@ -0,0 +1,158 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Snippets returned by Search wrap matched terms in these markers
+const (
+	HighlightStart = "\x02"
+	HighlightStop  = "\x03"
+)
+
+// SearchFilter describes a full-text search over a user's chats and messages
+type SearchFilter struct {
+	Query       string
+	UserID      int
+	WorkspaceID *int   // restrict to one workspace
+	Language    string // only messages in this language
+	Role        string // only messages with this role
+	From        *time.Time
+	To          *time.Time
+	Limit       int
+}
+
+// SearchResult is a single search hit. Message is nil when the chat title matched.
+type SearchResult struct {
+	Chat    *Chat
+	Message *Message
+	Snippet string
+	Rank    float64
+}
+
+// Search runs a full-text search over message contents and chat titles.
+// Only chats the user can read are searched: their own personal chats and
+// chats of workspaces they are a member of. Trashed chats are excluded.
+func (s *service) Search(ctx context.Context, filter SearchFilter) ([]*SearchResult, error) {
+	args := []any{filter.Query, filter.UserID}
+	headline := fmt.Sprintf(
+		"'StartSel=%s, StopSel=%s, MaxFragments=2, MaxWords=30, MinWords=10'",
+		HighlightStart, HighlightStop,
+	)
+
+	chatConditions := ""
+	if filter.WorkspaceID != nil {
+		args = append(args, *filter.WorkspaceID)
+		chatConditions += " AND c.workspace_id = $" + strconv.Itoa(len(args))
+	}
+
+	messageConditions := ""
+	if filter.Language != "" {
+		args = append(args, filter.Language)
+		messageConditions += " AND m.language = $" + strconv.Itoa(len(args))
+	}
+	if filter.Role != "" {
+		args = append(args, filter.Role)
+		messageConditions += " AND m.role = $" + strconv.Itoa(len(args))
+	}
+
+	titleConditions := ""
+	if filter.From != nil {
+		args = append(args, *filter.From)
+		messageConditions += " AND m.created_at >= $" + strconv.Itoa(len(args)) + "::timestamp"
+		titleConditions += " AND c.updated_at >= $" + strconv.Itoa(len(args)) + "::timestamp"
+	}
+	if filter.To != nil {
+		args = append(args, *filter.To)
+		messageConditions += " AND m.created_at < $" + strconv.Itoa(len(args)) + "::timestamp"
+		titleConditions += " AND c.updated_at < $" + strconv.Itoa(len(args)) + "::timestamp"
+	}
+
+	// Chat titles have no language or role, so they only match unfiltered searches
+	titleBranch := ""
+	if filter.Language == "" && filter.Role == "" {
+		titleBranch = `
+		UNION ALL
+		SELECT ` + prefixColumns("c", chatColumns) + `,
+			NULL, NULL, NULL, NULL,
+			ts_headline('simple', c.title, q.query, ` + headline + `),
+			ts_rank(c.search_vector, q.query)
+		FROM accessible c, q
+		WHERE c.search_vector @@ q.query` + titleConditions
+	}
+
+	args = append(args, filter.Limit)
+	query := `
+		WITH q AS (
+			SELECT websearch_to_tsquery('simple', $1) AS query
+		),
+		accessible AS (
+			SELECT * FROM chats c
+			WHERE c.deleted_at IS NULL
+			AND (
+				(c.workspace_id IS NULL AND c.user_id = $2)
+				OR c.workspace_id IN (SELECT workspace_id FROM workspace_members WHERE user_id = $2)
+			)` + chatConditions + `
+		)
+		SELECT ` + prefixColumns("c", chatColumns) + `,
+			m.id, m.role, m.language, m.created_at,
+			ts_headline('simple', m.content, q.query, ` + headline + `),
+			ts_rank(m.search_vector, q.query) AS rank
+		FROM messages m
+		JOIN accessible c ON c.id = m.chat_id, q
+		WHERE m.search_vector @@ q.query` + messageConditions + titleBranch + `
+		ORDER BY rank DESC
+		LIMIT $` + strconv.Itoa(len(args)) + `
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search: %w", err)
+	}
+	defer rows.Close()
+
+	var results []*SearchResult
+	for rows.Next() {
+		var result SearchResult
+		var cs chatScan
+		var messageId sql.NullInt64
+		var messageCreatedAt sql.NullTime
+		var role, language sql.NullString
+		dest := append(cs.dest(), &messageId, &role, &language, &messageCreatedAt, &result.Snippet, &result.Rank)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to scan search result: %w", err)
+		}
+		result.Chat = cs.result()
+
+		if messageId.Valid {
+			result.Message = &Message{
+				ID:        int(messageId.Int64),
+				ChatID:    result.Chat.ID,
+				Role:      role.String,
+				Language:  language.String,
+				CreatedAt: messageCreatedAt.Time,
+			}
+		}
+
+		results = append(results, &result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to search: %w", err)
+	}
+
+	return results, nil
+}
+
+// prefixColumns qualifies a comma separated column list with a table alias
+func prefixColumns(alias, columns string) string {
+	parts := strings.Split(columns, ", ")
+	for i, p := range parts {
+		parts[i] = alias + "." + p
+	}
+	return strings.Join(parts, ", ")
+}
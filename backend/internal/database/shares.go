@@ -0,0 +1,134 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// ChatShare is a public link to a chat. Like personal access tokens, the
+// token itself is never stored, only its hash.
+type ChatShare struct {
+	ID          int
+	ChatID      int
+	TokenPrefix string // start of the token, to tell links apart
+	CreatedBy   int
+	ExpiresAt   *time.Time
+	RevokedAt   *time.Time
+	CreatedAt   time.Time
+}
+
+// Active reports whether the share link can still be used
+func (s *ChatShare) Active(now time.Time) bool {
+	if s.RevokedAt != nil {
+		return false
+	}
+	return s.ExpiresAt == nil || now.Before(*s.ExpiresAt)
+}
+
+func (s *service) CreateChatShare(ctx context.Context, chatId, createdBy int, tokenHash, prefix string, expiresAt *time.Time) (*ChatShare, error) {
+	query := `
+		INSERT INTO chat_shares (chat_id, token_hash, token_prefix, created_by, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, NOW())
+		RETURNING ` + chatShareColumns + `
+	`
+
+	share, err := scanChatShare(s.db.QueryRowContext(ctx, query, chatId, tokenHash, prefix, createdBy, expiresAt))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create share link: %w", err)
+	}
+
+	return share, nil
+}
+
+func (s *service) GetChatSharesByChat(ctx context.Context, chatId int) ([]*ChatShare, error) {
+	query := `
+		SELECT ` + chatShareColumns + `
+		FROM chat_shares
+		WHERE chat_id = $1
+		ORDER BY created_at DESC
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, chatId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get share links: %w", err)
+	}
+	defer rows.Close()
+
+	var shares []*ChatShare
+	for rows.Next() {
+		share, err := scanChatShare(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan share link: %w", err)
+		}
+		shares = append(shares, share)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get share links: %w", err)
+	}
+
+	return shares, nil
+}
+
+func (s *service) GetChatShareByTokenHash(ctx context.Context, tokenHash string) (*ChatShare, error) {
+	query := `
+		SELECT ` + chatShareColumns + `
+		FROM chat_shares
+		WHERE token_hash = $1
+	`
+
+	share, err := scanChatShare(s.db.QueryRowContext(ctx, query, tokenHash))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("share link")
+		}
+		return nil, fmt.Errorf("failed to get share link: %w", err)
+	}
+
+	return share, nil
+}
+
+func (s *service) RevokeChatShare(ctx context.Context, chatId, shareId int) error {
+	query := `
+		UPDATE chat_shares
+		SET revoked_at = COALESCE(revoked_at, NOW())
+		WHERE id = $1 AND chat_id = $2
+	`
+
+	res, err := s.db.ExecContext(ctx, query, shareId, chatId)
+	if err != nil {
+		return fmt.Errorf("failed to revoke share link: %w", err)
+	}
+
+	return requireRowAffected(res, "share link")
+}
+
+// chatShareColumns lists the chat_shares columns in the order expected by scanChatShare
+const chatShareColumns = `id, chat_id, token_prefix, created_by, expires_at, revoked_at, created_at`
+
+func scanChatShare(row rowScanner) (*ChatShare, error) {
+	var share ChatShare
+	var expiresAt, revokedAt sql.NullTime
+	err := row.Scan(
+		&share.ID,
+		&share.ChatID,
+		&share.TokenPrefix,
+		&share.CreatedBy,
+		&expiresAt,
+		&revokedAt,
+		&share.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if expiresAt.Valid {
+		share.ExpiresAt = &expiresAt.Time
+	}
+	if revokedAt.Valid {
+		share.RevokedAt = &revokedAt.Time
+	}
+
+	return &share, nil
+}
@@ -0,0 +1,366 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Snippet is a piece of saved code together with its current version
+type Snippet struct {
+	ID        int
+	UserID    int
+	MessageID *int // message the snippet was saved from
+	Name      string
+	Language  string
+	Tags      []string
+	Version   int
+	Content   string // content of the current version
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type SnippetVersion struct {
+	ID        int
+	SnippetID int
+	Version   int
+	Content   string
+	MessageID *int // message this version was saved from
+	CreatedAt time.Time
+}
+
+type CreateSnippetParams struct {
+	UserID    int
+	MessageID *int
+	Name      string
+	Language  string
+	Tags      []string
+	Content   string
+}
+
+// SnippetUpdate lists the snippet fields to change, nil fields are kept.
+// A changed Content is saved as a new version.
+type SnippetUpdate struct {
+	Name      *string
+	Language  *string
+	Tags      []string // nil keeps the tags, an empty slice clears them
+	Content   *string
+	MessageID *int // origin of the new content
+}
+
+// SnippetFilter narrows down the snippets returned by GetSnippetsByUser
+type SnippetFilter struct {
+	Query    string // matched against the name and current content
+	Tag      string
+	Language string
+}
+
+// CreateSnippet saves a snippet with content as its first version
+func (s *service) CreateSnippet(ctx context.Context, params CreateSnippetParams) (*Snippet, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create snippet: %w", err)
+	}
+	defer tx.Rollback()
+
+	if params.Tags == nil {
+		params.Tags = []string{}
+	}
+
+	var snippetId int
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO snippets (user_id, message_id, name, language, tags, current_version, created_at, updated_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, 1, NOW(), NOW())
+		RETURNING id
+	`, params.UserID, params.MessageID, params.Name, params.Language, params.Tags).Scan(&snippetId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create snippet: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO snippet_versions (snippet_id, version, content, message_id, created_at)
+		VALUES ($1, 1, $2, $3, NOW())
+	`, snippetId, params.Content, params.MessageID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create snippet version: %w", err)
+	}
+
+	snippet, err := getSnippet(ctx, tx, snippetId, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create snippet: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to create snippet: %w", err)
+	}
+
+	return snippet, nil
+}
+
+func (s *service) GetSnippetByID(ctx context.Context, snippetId int) (*Snippet, error) {
+	snippet, err := getSnippet(ctx, s.db, snippetId, false)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("snippet")
+		}
+		return nil, fmt.Errorf("failed to get snippet: %w", err)
+	}
+
+	return snippet, nil
+}
+
+// GetSnippetsByUser returns a page of the user's snippets, most recently
+// updated first, and the cursor of the next page (nil on the last page)
+func (s *service) GetSnippetsByUser(ctx context.Context, userId int, filter SnippetFilter, page Page) ([]*Snippet, *Cursor, error) {
+	args := []any{userId}
+	conditions := ""
+	if filter.Query != "" {
+		args = append(args, filter.Query)
+		n := strconv.Itoa(len(args))
+		conditions += " AND (s.name ILIKE '%' || $" + n + " || '%' OR v.content ILIKE '%' || $" + n + " || '%')"
+	}
+	if filter.Tag != "" {
+		args = append(args, []string{filter.Tag})
+		conditions += " AND s.tags @> $" + strconv.Itoa(len(args))
+	}
+	if filter.Language != "" {
+		args = append(args, filter.Language)
+		conditions += " AND s.language = $" + strconv.Itoa(len(args))
+	}
+	if page.After != nil {
+		args = append(args, page.After.Time, page.After.ID)
+		conditions += fmt.Sprintf(" AND (s.updated_at, s.id) < ($%d::timestamp, $%d)", len(args)-1, len(args))
+	}
+	args = append(args, page.Limit+1)
+
+	query := snippetSelect + `
+		WHERE s.user_id = $1` + conditions + `
+		ORDER BY s.updated_at DESC, s.id DESC
+		LIMIT $` + strconv.Itoa(len(args))
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get snippets: %w", err)
+	}
+	defer rows.Close()
+
+	typeMap := pgtype.NewMap()
+	var snippets []*Snippet
+	for rows.Next() {
+		snippet, err := scanSnippet(rows, typeMap)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to scan snippet: %w", err)
+		}
+		snippets = append(snippets, snippet)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("failed to get snippets: %w", err)
+	}
+
+	// One extra row was requested to find out whether another page exists
+	var next *Cursor
+	if len(snippets) > page.Limit {
+		snippets = snippets[:page.Limit]
+		last := snippets[len(snippets)-1]
+		next = &Cursor{Time: last.UpdatedAt, ID: last.ID}
+	}
+
+	return snippets, next, nil
+}
+
+// UpdateSnippet changes a snippet's metadata and, when the content differs
+// from the current version, saves it as the next version
+func (s *service) UpdateSnippet(ctx context.Context, snippetId int, update SnippetUpdate) (*Snippet, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update snippet: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Lock the snippet so concurrent updates get consecutive versions
+	current, err := getSnippet(ctx, tx, snippetId, true)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("snippet")
+		}
+		return nil, fmt.Errorf("failed to update snippet: %w", err)
+	}
+
+	version := current.Version
+	if update.Content != nil && *update.Content != current.Content {
+		version++
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO snippet_versions (snippet_id, version, content, message_id, created_at)
+			VALUES ($1, $2, $3, $4, NOW())
+		`, snippetId, version, *update.Content, update.MessageID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create snippet version: %w", err)
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE snippets
+		SET name = COALESCE($2, name),
+			language = CASE WHEN $3::text IS NULL THEN language ELSE NULLIF($3, '') END,
+			tags = COALESCE($4, tags),
+			current_version = $5,
+			updated_at = NOW()
+		WHERE id = $1
+	`, snippetId, update.Name, update.Language, update.Tags, version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update snippet: %w", err)
+	}
+
+	snippet, err := getSnippet(ctx, tx, snippetId, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update snippet: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to update snippet: %w", err)
+	}
+
+	return snippet, nil
+}
+
+func (s *service) DeleteSnippet(ctx context.Context, snippetId int) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM snippets WHERE id = $1`, snippetId)
+	if err != nil {
+		return fmt.Errorf("failed to delete snippet: %w", err)
+	}
+
+	return requireRowAffected(res, "snippet")
+}
+
+// GetSnippetVersions returns all versions of a snippet, newest first
+func (s *service) GetSnippetVersions(ctx context.Context, snippetId int) ([]*SnippetVersion, error) {
+	query := `
+		SELECT ` + snippetVersionColumns + `
+		FROM snippet_versions
+		WHERE snippet_id = $1
+		ORDER BY version DESC
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, snippetId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get snippet versions: %w", err)
+	}
+	defer rows.Close()
+
+	var versions []*SnippetVersion
+	for rows.Next() {
+		version, err := scanSnippetVersion(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan snippet version: %w", err)
+		}
+		versions = append(versions, version)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get snippet versions: %w", err)
+	}
+
+	return versions, nil
+}
+
+func (s *service) GetSnippetVersion(ctx context.Context, snippetId, version int) (*SnippetVersion, error) {
+	query := `
+		SELECT ` + snippetVersionColumns + `
+		FROM snippet_versions
+		WHERE snippet_id = $1 AND version = $2
+	`
+
+	v, err := scanSnippetVersion(s.db.QueryRowContext(ctx, query, snippetId, version))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("snippet version")
+		}
+		return nil, fmt.Errorf("failed to get snippet version: %w", err)
+	}
+
+	return v, nil
+}
+
+// snippetSelect selects snippets joined with their current version, in the
+// column order expected by scanSnippet
+const snippetSelect = `
+	SELECT s.id, s.user_id, s.message_id, s.name, s.language, s.tags,
+		s.current_version, v.content, s.created_at, s.updated_at
+	FROM snippets s
+	JOIN snippet_versions v ON v.snippet_id = s.id AND v.version = s.current_version
+`
+
+// queryRower is implemented by both *sql.DB and *sql.Tx
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// getSnippet loads a snippet, locking it for the rest of the transaction
+// when forUpdate is set
+func getSnippet(ctx context.Context, q queryRower, snippetId int, forUpdate bool) (*Snippet, error) {
+	query := snippetSelect + ` WHERE s.id = $1`
+	if forUpdate {
+		query += ` FOR UPDATE OF s`
+	}
+	return scanSnippet(q.QueryRowContext(ctx, query, snippetId), pgtype.NewMap())
+}
+
+// scanSnippet scans a row of snippetSelect. typeMap decodes the tags array,
+// it is not safe for concurrent use.
+func scanSnippet(row rowScanner, typeMap *pgtype.Map) (*Snippet, error) {
+	var snippet Snippet
+	var messageId sql.NullInt64
+	var language sql.NullString
+	err := row.Scan(
+		&snippet.ID,
+		&snippet.UserID,
+		&messageId,
+		&snippet.Name,
+		&language,
+		typeMap.SQLScanner(&snippet.Tags),
+		&snippet.Version,
+		&snippet.Content,
+		&snippet.CreatedAt,
+		&snippet.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if messageId.Valid {
+		id := int(messageId.Int64)
+		snippet.MessageID = &id
+	}
+	snippet.Language = language.String
+
+	return &snippet, nil
+}
+
+// snippetVersionColumns lists the columns expected by scanSnippetVersion
+const snippetVersionColumns = `id, snippet_id, version, content, message_id, created_at`
+
+func scanSnippetVersion(row rowScanner) (*SnippetVersion, error) {
+	var version SnippetVersion
+	var messageId sql.NullInt64
+	err := row.Scan(
+		&version.ID,
+		&version.SnippetID,
+		&version.Version,
+		&version.Content,
+		&messageId,
+		&version.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if messageId.Valid {
+		id := int(messageId.Int64)
+		version.MessageID = &id
+	}
+
+	return &version, nil
+}
@@ -0,0 +1,123 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// AccessToken is a personal access token. The token itself is never stored,
+// only its hash.
+type AccessToken struct {
+	ID         int
+	UserID     int
+	Name       string
+	Prefix     string // start of the token, to tell tokens apart
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	CreatedAt  time.Time
+}
+
+func (s *service) CreateAccessToken(ctx context.Context, userId int, name, tokenHash, prefix string, expiresAt *time.Time) (*AccessToken, error) {
+	query := `
+		INSERT INTO personal_access_tokens (user_id, name, token_hash, token_prefix, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, NOW())
+		RETURNING ` + accessTokenColumns + `
+	`
+
+	token, err := scanAccessToken(s.db.QueryRowContext(ctx, query, userId, name, tokenHash, prefix, expiresAt))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create access token: %w", err)
+	}
+
+	return token, nil
+}
+
+func (s *service) GetAccessTokensByUser(ctx context.Context, userId int) ([]*AccessToken, error) {
+	query := `
+		SELECT ` + accessTokenColumns + `
+		FROM personal_access_tokens
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get access tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []*AccessToken
+	for rows.Next() {
+		token, err := scanAccessToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan access token: %w", err)
+		}
+		tokens = append(tokens, token)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get access tokens: %w", err)
+	}
+
+	return tokens, nil
+}
+
+// UseAccessToken looks up an unexpired token by its hash and records that
+// it was used
+func (s *service) UseAccessToken(ctx context.Context, tokenHash string) (*AccessToken, error) {
+	query := `
+		UPDATE personal_access_tokens
+		SET last_used_at = NOW()
+		WHERE token_hash = $1 AND (expires_at IS NULL OR expires_at > NOW())
+		RETURNING ` + accessTokenColumns + `
+	`
+
+	token, err := scanAccessToken(s.db.QueryRowContext(ctx, query, tokenHash))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("access token")
+		}
+		return nil, fmt.Errorf("failed to get access token: %w", err)
+	}
+
+	return token, nil
+}
+
+func (s *service) DeleteAccessToken(ctx context.Context, userId, tokenId int) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM personal_access_tokens WHERE id = $1 AND user_id = $2`, tokenId, userId)
+	if err != nil {
+		return fmt.Errorf("failed to delete access token: %w", err)
+	}
+
+	return requireRowAffected(res, "access token")
+}
+
+// accessTokenColumns lists the columns expected by scanAccessToken
+const accessTokenColumns = `id, user_id, name, token_prefix, expires_at, last_used_at, created_at`
+
+func scanAccessToken(row rowScanner) (*AccessToken, error) {
+	var token AccessToken
+	var expiresAt, lastUsedAt sql.NullTime
+	err := row.Scan(
+		&token.ID,
+		&token.UserID,
+		&token.Name,
+		&token.Prefix,
+		&expiresAt,
+		&lastUsedAt,
+		&token.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if expiresAt.Valid {
+		token.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		token.LastUsedAt = &lastUsedAt.Time
+	}
+
+	return &token, nil
+}
@@ -0,0 +1,51 @@
+package database
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// slowQueryThreshold is how long a query may take before it is logged as slow
+const slowQueryThreshold = 500 * time.Millisecond
+
+// queryTracer logs queries with the context they run in, which carries the
+// request ID of the request they serve. Only the SQL is logged, never the
+// arguments, which can hold prompts and credentials.
+type queryTracer struct{}
+
+type queryStartKey struct{}
+
+type queryStart struct {
+	sql string
+	at  time.Time
+}
+
+func (queryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	return context.WithValue(ctx, queryStartKey{}, queryStart{sql: data.SQL, at: time.Now()})
+}
+
+func (queryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	start, ok := ctx.Value(queryStartKey{}).(queryStart)
+	if !ok {
+		return
+	}
+
+	elapsed := time.Since(start.at)
+	attrs := []slog.Attr{
+		slog.String("sql", strings.Join(strings.Fields(start.sql), " ")),
+		slog.Duration("duration", elapsed),
+	}
+	if data.Err != nil {
+		attrs = append(attrs, slog.Any("error", data.Err))
+	}
+
+	if elapsed >= slowQueryThreshold {
+		slog.LogAttrs(ctx, slog.LevelWarn, "Slow query", attrs...)
+	} else {
+		slog.LogAttrs(ctx, slog.LevelDebug, "Query", attrs...)
+	}
+}
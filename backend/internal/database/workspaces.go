@@ -0,0 +1,413 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type Workspace struct {
+	ID        int
+	Name      string
+	Role      string // role of the requesting user, set by GetWorkspacesByUser
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type WorkspaceMember struct {
+	WorkspaceID int
+	UserID      int
+	Name        string
+	Email       string
+	Role        string
+	CreatedAt   time.Time
+}
+
+// CreateWorkspace creates a workspace and makes ownerId its first owner
+func (s *service) CreateWorkspace(ctx context.Context, ownerId int, name string) (*Workspace, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create workspace: %w", err)
+	}
+	defer tx.Rollback()
+
+	query := `
+		INSERT INTO workspaces (name, created_at, updated_at)
+		VALUES ($1, NOW(), NOW())
+		RETURNING id, name, created_at, updated_at
+	`
+
+	var workspace Workspace
+	err = tx.QueryRowContext(ctx, query, name).Scan(
+		&workspace.ID,
+		&workspace.Name,
+		&workspace.CreatedAt,
+		&workspace.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create workspace: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO workspace_members (workspace_id, user_id, role, created_at)
+		VALUES ($1, $2, 'owner', NOW())
+	`, workspace.ID, ownerId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add workspace owner: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to create workspace: %w", err)
+	}
+
+	workspace.Role = "owner"
+	return &workspace, nil
+}
+
+func (s *service) GetWorkspaceByID(ctx context.Context, workspaceId int) (*Workspace, error) {
+	query := `
+		SELECT id, name, created_at, updated_at
+		FROM workspaces
+		WHERE id = $1
+	`
+
+	var workspace Workspace
+	err := s.db.QueryRowContext(ctx, query, workspaceId).Scan(
+		&workspace.ID,
+		&workspace.Name,
+		&workspace.CreatedAt,
+		&workspace.UpdatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("workspace")
+		}
+		return nil, fmt.Errorf("failed to get workspace: %w", err)
+	}
+
+	return &workspace, nil
+}
+
+func (s *service) GetWorkspacesByUser(ctx context.Context, userId int) ([]*Workspace, error) {
+	query := `
+		SELECT w.id, w.name, m.role, w.created_at, w.updated_at
+		FROM workspaces w
+		JOIN workspace_members m ON m.workspace_id = w.id
+		WHERE m.user_id = $1
+		ORDER BY w.name ASC
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, userId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workspaces: %w", err)
+	}
+	defer rows.Close()
+
+	var workspaces []*Workspace
+	for rows.Next() {
+		var workspace Workspace
+		err := rows.Scan(
+			&workspace.ID,
+			&workspace.Name,
+			&workspace.Role,
+			&workspace.CreatedAt,
+			&workspace.UpdatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan workspace: %w", err)
+		}
+		workspaces = append(workspaces, &workspace)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get workspaces: %w", err)
+	}
+
+	return workspaces, nil
+}
+
+func (s *service) UpdateWorkspaceName(ctx context.Context, workspaceId int, name string) error {
+	query := `
+		UPDATE workspaces
+		SET name = $1, updated_at = NOW()
+		WHERE id = $2
+	`
+
+	res, err := s.db.ExecContext(ctx, query, name, workspaceId)
+	if err != nil {
+		return fmt.Errorf("failed to update workspace: %w", err)
+	}
+
+	return requireRowAffected(res, "workspace")
+}
+
+// DeleteWorkspace removes a workspace and its memberships. Its chats are
+// kept and fall back to being personal chats of their creators.
+func (s *service) DeleteWorkspace(ctx context.Context, workspaceId int) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM workspaces WHERE id = $1`, workspaceId)
+	if err != nil {
+		return fmt.Errorf("failed to delete workspace: %w", err)
+	}
+
+	return requireRowAffected(res, "workspace")
+}
+
+func (s *service) GetWorkspaceMember(ctx context.Context, workspaceId, userId int) (*WorkspaceMember, error) {
+	query := `
+		SELECT ` + workspaceMemberColumns + `
+		FROM workspace_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.workspace_id = $1 AND m.user_id = $2
+	`
+
+	member, err := scanWorkspaceMember(s.db.QueryRowContext(ctx, query, workspaceId, userId))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("workspace member")
+		}
+		return nil, fmt.Errorf("failed to get workspace member: %w", err)
+	}
+
+	return member, nil
+}
+
+func (s *service) GetWorkspaceMembers(ctx context.Context, workspaceId int) ([]*WorkspaceMember, error) {
+	query := `
+		SELECT ` + workspaceMemberColumns + `
+		FROM workspace_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.workspace_id = $1
+		ORDER BY m.created_at ASC
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, workspaceId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get workspace members: %w", err)
+	}
+	defer rows.Close()
+
+	var members []*WorkspaceMember
+	for rows.Next() {
+		member, err := scanWorkspaceMember(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan workspace member: %w", err)
+		}
+		members = append(members, member)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get workspace members: %w", err)
+	}
+
+	return members, nil
+}
+
+func (s *service) UpdateWorkspaceMemberRole(ctx context.Context, workspaceId, userId int, role string) error {
+	query := `
+		UPDATE workspace_members
+		SET role = $1
+		WHERE workspace_id = $2 AND user_id = $3
+	`
+
+	res, err := s.db.ExecContext(ctx, query, role, workspaceId, userId)
+	if err != nil {
+		return fmt.Errorf("failed to update workspace member: %w", err)
+	}
+
+	return requireRowAffected(res, "workspace member")
+}
+
+func (s *service) RemoveWorkspaceMember(ctx context.Context, workspaceId, userId int) error {
+	query := `
+		DELETE FROM workspace_members
+		WHERE workspace_id = $1 AND user_id = $2
+	`
+
+	res, err := s.db.ExecContext(ctx, query, workspaceId, userId)
+	if err != nil {
+		return fmt.Errorf("failed to remove workspace member: %w", err)
+	}
+
+	return requireRowAffected(res, "workspace member")
+}
+
+// workspaceMemberColumns lists the columns expected by scanWorkspaceMember
+const workspaceMemberColumns = `m.workspace_id, m.user_id, u.name, u.email, m.role, m.created_at`
+
+func scanWorkspaceMember(row rowScanner) (*WorkspaceMember, error) {
+	var member WorkspaceMember
+	err := row.Scan(
+		&member.WorkspaceID,
+		&member.UserID,
+		&member.Name,
+		&member.Email,
+		&member.Role,
+		&member.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// WorkspaceInvite is a pending invitation to a workspace, found by the jti
+// of the signed invite token. Accepting the invite deletes it.
+type WorkspaceInvite struct {
+	ID          int
+	JTI         string
+	WorkspaceID int
+	Role        string
+	Email       string // only this user may accept, if set
+	InvitedBy   int
+	ExpiresAt   time.Time
+	CreatedAt   time.Time
+}
+
+// CreateWorkspaceInvite stores an invite and deletes the workspace's expired ones
+func (s *service) CreateWorkspaceInvite(ctx context.Context, invite *WorkspaceInvite) (*WorkspaceInvite, error) {
+	query := `
+		WITH expired AS (
+			DELETE FROM workspace_invites
+			WHERE workspace_id = $2 AND expires_at <= NOW()
+		)
+		INSERT INTO workspace_invites (jti, workspace_id, role, email, invited_by, expires_at, created_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, NOW())
+		RETURNING ` + workspaceInviteColumns + `
+	`
+
+	created, err := scanWorkspaceInvite(s.db.QueryRowContext(ctx, query,
+		invite.JTI, invite.WorkspaceID, invite.Role, invite.Email, invite.InvitedBy, invite.ExpiresAt))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create invite: %w", err)
+	}
+
+	return created, nil
+}
+
+// GetWorkspaceInviteByJTI returns an unexpired invite
+func (s *service) GetWorkspaceInviteByJTI(ctx context.Context, jti string) (*WorkspaceInvite, error) {
+	query := `
+		SELECT ` + workspaceInviteColumns + `
+		FROM workspace_invites
+		WHERE jti = $1 AND expires_at > NOW()
+	`
+
+	invite, err := scanWorkspaceInvite(s.db.QueryRowContext(ctx, query, jti))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("invite")
+		}
+		return nil, fmt.Errorf("failed to get invite: %w", err)
+	}
+
+	return invite, nil
+}
+
+// GetWorkspaceInvites returns the unexpired invites of a workspace, newest first
+func (s *service) GetWorkspaceInvites(ctx context.Context, workspaceId int) ([]*WorkspaceInvite, error) {
+	query := `
+		SELECT ` + workspaceInviteColumns + `
+		FROM workspace_invites
+		WHERE workspace_id = $1 AND expires_at > NOW()
+		ORDER BY created_at DESC
+	`
+
+	rows, err := s.db.QueryContext(ctx, query, workspaceId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get invites: %w", err)
+	}
+	defer rows.Close()
+
+	var invites []*WorkspaceInvite
+	for rows.Next() {
+		invite, err := scanWorkspaceInvite(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan invite: %w", err)
+		}
+		invites = append(invites, invite)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get invites: %w", err)
+	}
+
+	return invites, nil
+}
+
+// DeleteWorkspaceInvite revokes an invite
+func (s *service) DeleteWorkspaceInvite(ctx context.Context, workspaceId, inviteId int) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM workspace_invites WHERE id = $1 AND workspace_id = $2`, inviteId, workspaceId)
+	if err != nil {
+		return fmt.Errorf("failed to delete invite: %w", err)
+	}
+
+	return requireRowAffected(res, "invite")
+}
+
+// AcceptWorkspaceInvite adds userId to the workspace of an unexpired invite
+// with the invite's role and deletes the invite, so it can only be used
+// once. A user who already is a member keeps their role and the invite.
+func (s *service) AcceptWorkspaceInvite(ctx context.Context, inviteId, userId int) (*WorkspaceMember, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to accept invite: %w", err)
+	}
+	defer tx.Rollback()
+
+	var workspaceId int
+	var role string
+	err = tx.QueryRowContext(ctx, `
+		DELETE FROM workspace_invites
+		WHERE id = $1 AND expires_at > NOW()
+		RETURNING workspace_id, role
+	`, inviteId).Scan(&workspaceId, &role)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound("invite")
+		}
+		return nil, fmt.Errorf("failed to accept invite: %w", err)
+	}
+
+	res, err := tx.ExecContext(ctx, `
+		INSERT INTO workspace_members (workspace_id, user_id, role, created_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (workspace_id, user_id) DO NOTHING
+	`, workspaceId, userId, role)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add workspace member: %w", err)
+	}
+
+	added, err := res.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("failed to add workspace member: %w", err)
+	}
+	if added > 0 {
+		if err := tx.Commit(); err != nil {
+			return nil, fmt.Errorf("failed to accept invite: %w", err)
+		}
+	}
+
+	return s.GetWorkspaceMember(ctx, workspaceId, userId)
+}
+
+// workspaceInviteColumns lists the columns expected by scanWorkspaceInvite
+const workspaceInviteColumns = `id, jti, workspace_id, role, email, invited_by, expires_at, created_at`
+
+func scanWorkspaceInvite(row rowScanner) (*WorkspaceInvite, error) {
+	var invite WorkspaceInvite
+	var email sql.NullString
+	err := row.Scan(
+		&invite.ID,
+		&invite.JTI,
+		&invite.WorkspaceID,
+		&invite.Role,
+		&email,
+		&invite.InvitedBy,
+		&invite.ExpiresAt,
+		&invite.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	invite.Email = email.String
+	return &invite, nil
+}
@@ -0,0 +1,381 @@
+// Package diff computes line-based differences between two texts, formats
+// them as unified diffs and applies unified diffs to texts.
+package diff
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ErrConflict is returned by Apply when a hunk doesn't match the text
+var ErrConflict = errors.New("patch does not apply")
+
+// contextLines is the number of unchanged lines shown around each change
+const contextLines = 3
+
+// maxCells bounds the size of the LCS table. Inputs whose changed regions
+// are larger are diffed as a full replacement of those regions.
+const maxCells = 4_000_000
+
+type OpKind int
+
+const (
+	Equal OpKind = iota
+	Delete
+	Insert
+)
+
+// Op is one line of an edit script. Line keeps its trailing newline, which is
+// missing only on the last line of a text that doesn't end with one.
+type Op struct {
+	Kind OpKind
+	Line string
+}
+
+// Lines computes the edit script turning from into to
+func Lines(from, to string) []Op {
+	a, b := splitLines(from), splitLines(to)
+
+	// Common prefix and suffix are cheap to find and usually most of the text
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var ops []Op
+	for _, line := range a[:prefix] {
+		ops = append(ops, Op{Equal, line})
+	}
+	ops = append(ops, lcs(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, Op{Equal, line})
+	}
+	return ops
+}
+
+// lcs diffs a and b through their longest common subsequence
+func lcs(a, b []string) []Op {
+	var ops []Op
+	if len(a)*len(b) > maxCells {
+		for _, line := range a {
+			ops = append(ops, Op{Delete, line})
+		}
+		for _, line := range b {
+			ops = append(ops, Op{Insert, line})
+		}
+		return ops
+	}
+
+	// table[i][j] is the LCS length of a[i:] and b[j:]
+	table := make([][]int32, len(a)+1)
+	for i := range table {
+		table[i] = make([]int32, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				table[i][j] = table[i+1][j+1] + 1
+			} else {
+				table[i][j] = max(table[i+1][j], table[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, Op{Equal, a[i]})
+			i++
+			j++
+		case table[i+1][j] >= table[i][j+1]:
+			ops = append(ops, Op{Delete, a[i]})
+			i++
+		default:
+			ops = append(ops, Op{Insert, b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, Op{Delete, a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, Op{Insert, b[j]})
+	}
+	return ops
+}
+
+// Unified returns the unified diff between from and to, labelled with the
+// given file names, or "" when the texts are equal
+func Unified(fromName, toName, from, to string) string {
+	ops := Lines(from, to)
+	hunks := hunksOf(ops)
+	if len(hunks) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", fromName, toName)
+	for _, h := range hunks {
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n", hunkRange(h.fromStart, h.fromCount), hunkRange(h.toStart, h.toCount))
+		for _, op := range h.ops {
+			switch op.Kind {
+			case Equal:
+				b.WriteByte(' ')
+			case Delete:
+				b.WriteByte('-')
+			case Insert:
+				b.WriteByte('+')
+			}
+			b.WriteString(op.Line)
+			if !strings.HasSuffix(op.Line, "\n") {
+				b.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+	}
+	return b.String()
+}
+
+// Apply applies a unified diff to text. Hunks are placed by their context
+// and removed lines, which must match the text apart from trailing
+// whitespace; the line numbers of hunk headers are only used as a hint, so
+// slightly wrong ones (as written by language models) are tolerated. A patch
+// without hunks leaves the text unchanged.
+func Apply(text, patch string) (string, error) {
+	hunks, err := parsePatch(patch)
+	if err != nil {
+		return "", err
+	}
+
+	lines := splitLines(text)
+	var out []string
+	pos := 0
+	for i, h := range hunks {
+		start, ok := locate(lines, h.old, pos, h.start)
+		if !ok {
+			return "", fmt.Errorf("%w: hunk %d does not match the text", ErrConflict, i+1)
+		}
+		out = append(out, lines[pos:start]...)
+		// Unchanged lines keep their exact original form
+		k := start
+		for _, op := range h.ops {
+			switch op.Kind {
+			case Equal:
+				out = append(out, lines[k])
+				k++
+			case Delete:
+				k++
+			case Insert:
+				out = append(out, op.Line)
+			}
+		}
+		pos = k
+	}
+	out = append(out, lines[pos:]...)
+
+	// Only the last line may lack a newline
+	for i := 0; i < len(out)-1; i++ {
+		if !strings.HasSuffix(out[i], "\n") {
+			out[i] += "\n"
+		}
+	}
+	return strings.Join(out, ""), nil
+}
+
+// patchHunk is a hunk parsed from a unified diff
+type patchHunk struct {
+	start int // 0-based line of the text where the hunk should begin
+	ops   []Op
+	old   []string // context and removed lines, in order
+}
+
+// parsePatch reads the hunks of a unified diff, ignoring file headers and
+// anything before the first hunk
+func parsePatch(patch string) ([]patchHunk, error) {
+	var hunks []patchHunk
+	var current *patchHunk
+	lines := splitLines(patch)
+	for i, line := range lines {
+		if !strings.HasSuffix(line, "\n") {
+			line += "\n"
+		}
+
+		if strings.HasPrefix(line, "@@") {
+			start, err := hunkStart(line)
+			if err != nil {
+				return nil, err
+			}
+			hunks = append(hunks, patchHunk{start: start})
+			current = &hunks[len(hunks)-1]
+			continue
+		}
+		if current == nil {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			// Headers of the next file
+			current = nil
+		case line[0] == ' ' || line == "\n":
+			// Editors and models often drop the space of blank context lines
+			l := strings.TrimPrefix(line, " ")
+			current.ops = append(current.ops, Op{Equal, l})
+			current.old = append(current.old, l)
+		case line[0] == '-':
+			current.ops = append(current.ops, Op{Delete, line[1:]})
+			current.old = append(current.old, line[1:])
+		case line[0] == '+':
+			current.ops = append(current.ops, Op{Insert, line[1:]})
+		case line[0] == '\\':
+			// "\ No newline at end of file" applies to the line before
+			if n := len(current.ops); n > 0 {
+				current.ops[n-1].Line = strings.TrimSuffix(current.ops[n-1].Line, "\n")
+			}
+		default:
+			return nil, fmt.Errorf("invalid line in hunk %d: %q", len(hunks), strings.TrimSuffix(line, "\n"))
+		}
+	}
+
+	if len(hunks) == 0 && strings.TrimSpace(patch) != "" {
+		return nil, errors.New("patch contains no hunks")
+	}
+	return hunks, nil
+}
+
+// hunkStart reads the 0-based start line of the text from a hunk header
+// such as "@@ -12,7 +12,8 @@"
+func hunkStart(header string) (int, error) {
+	fields := strings.Fields(header)
+	if len(fields) < 2 || !strings.HasPrefix(fields[1], "-") {
+		return 0, fmt.Errorf("invalid hunk header %q", strings.TrimSpace(header))
+	}
+	from, count, hasCount := strings.Cut(fields[1][1:], ",")
+	start, err := strconv.Atoi(from)
+	if err != nil {
+		return 0, fmt.Errorf("invalid hunk header %q", strings.TrimSpace(header))
+	}
+	// An empty range refers to the line before it
+	if hasCount && count == "0" {
+		return start, nil
+	}
+	return max(start-1, 0), nil
+}
+
+// locate finds where old occurs in lines at or after from, trying the
+// positions closest to hint first
+func locate(lines, old []string, from, hint int) (int, bool) {
+	last := len(lines) - len(old)
+	if last < from {
+		return 0, false
+	}
+	hint = min(max(from, hint), last)
+	for offset := 0; hint-offset >= from || hint+offset <= last; offset++ {
+		if at := hint + offset; at <= last && matches(lines[at:], old) {
+			return at, true
+		}
+		if at := hint - offset; offset > 0 && at >= from && matches(lines[at:], old) {
+			return at, true
+		}
+	}
+	return 0, false
+}
+
+func matches(lines, old []string) bool {
+	for i, line := range old {
+		if strings.TrimRight(lines[i], " \t\r\n") != strings.TrimRight(line, " \t\r\n") {
+			return false
+		}
+	}
+	return true
+}
+
+type hunk struct {
+	fromStart, fromCount int // 0-based
+	toStart, toCount     int
+	ops                  []Op
+}
+
+// hunksOf groups changes that are close together, with contextLines of
+// unchanged lines around them
+func hunksOf(ops []Op) []hunk {
+	// Line positions in both texts before each op
+	fromPos := make([]int, len(ops)+1)
+	toPos := make([]int, len(ops)+1)
+	for k, op := range ops {
+		fromPos[k+1], toPos[k+1] = fromPos[k], toPos[k]
+		if op.Kind != Insert {
+			fromPos[k+1]++
+		}
+		if op.Kind != Delete {
+			toPos[k+1]++
+		}
+	}
+
+	var hunks []hunk
+	for i := 0; i < len(ops); {
+		if ops[i].Kind == Equal {
+			i++
+			continue
+		}
+
+		start := max(0, i-contextLines)
+		end := i
+		for end < len(ops) {
+			if ops[end].Kind != Equal {
+				end++
+				continue
+			}
+			run := end
+			for run < len(ops) && ops[run].Kind == Equal {
+				run++
+			}
+			// Unchanged stretches too long to bridge end the hunk
+			if run == len(ops) || run-end > 2*contextLines {
+				end = min(end+contextLines, len(ops))
+				break
+			}
+			end = run
+		}
+
+		hunks = append(hunks, hunk{
+			fromStart: fromPos[start],
+			fromCount: fromPos[end] - fromPos[start],
+			toStart:   toPos[start],
+			toCount:   toPos[end] - toPos[start],
+			ops:       ops[start:end],
+		})
+		i = end
+	}
+	return hunks
+}
+
+// hunkRange formats the 1-based line range of a hunk header. An empty range
+// refers to the line before it.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// splitLines splits s into lines that keep their trailing newline
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
@@ -0,0 +1,280 @@
+package diff
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name       string
+		from, to   string
+		inserts    int
+		deletes    int
+		equalLines int
+	}{
+		{"equal", "a\nb\n", "a\nb\n", 0, 0, 2},
+		{"both empty", "", "", 0, 0, 0},
+		{"from empty", "", "a\nb\n", 2, 0, 0},
+		{"to empty", "a\nb\n", "", 0, 2, 0},
+		{"changed line", "a\nb\nc\n", "a\nx\nc\n", 1, 1, 2},
+		{"inserted line", "a\nc\n", "a\nb\nc\n", 1, 0, 2},
+		{"missing final newline", "a\nb", "a\nb\n", 1, 1, 1},
+		{"repeated lines", "x\nx\nx\n", "x\nx\n", 0, 1, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var inserts, deletes, equal int
+			for _, op := range Lines(tt.from, tt.to) {
+				switch op.Kind {
+				case Insert:
+					inserts++
+				case Delete:
+					deletes++
+				case Equal:
+					equal++
+				}
+			}
+			if inserts != tt.inserts || deletes != tt.deletes || equal != tt.equalLines {
+				t.Errorf("got %d inserts, %d deletes, %d equal; want %d, %d, %d",
+					inserts, deletes, equal, tt.inserts, tt.deletes, tt.equalLines)
+			}
+		})
+	}
+}
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+		want     string
+	}{
+		{
+			name: "equal texts",
+			from: "a\nb\n",
+			to:   "a\nb\n",
+			want: "",
+		},
+		{
+			name: "changed line",
+			from: "a\nb\nc\n",
+			to:   "a\nx\nc\n",
+			want: "--- a\n+++ b\n@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n",
+		},
+		{
+			name: "context is limited",
+			from: "1\n2\n3\n4\n5\n6\n7\n8\n9\n",
+			to:   "1\n2\n3\n4\nfive\n6\n7\n8\n9\n",
+			want: "--- a\n+++ b\n@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n",
+		},
+		{
+			name: "distant changes make separate hunks",
+			from: "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+			to:   "one\n2\n3\n4\n5\n6\n7\n8\n9\nten\n",
+			want: "--- a\n+++ b\n@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n 4\n@@ -7,4 +7,4 @@\n 7\n 8\n 9\n-10\n+ten\n",
+		},
+		{
+			name: "from empty",
+			from: "",
+			to:   "a\n",
+			want: "--- a\n+++ b\n@@ -0,0 +1 @@\n+a\n",
+		},
+		{
+			name: "no newline at end of file",
+			from: "a\nb",
+			to:   "a\nc",
+			want: "--- a\n+++ b\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n\\ No newline at end of file\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Unified("a", "b", tt.from, tt.to); got != tt.want {
+				t.Errorf("Unified() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		patch   string
+		want    string
+		wantErr error // error Apply must wrap
+		fails   bool  // Apply must fail with any error
+	}{
+		{
+			name:  "exact hunk",
+			text:  "a\nb\nc\n",
+			patch: "--- a/code\n+++ b/code\n@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n",
+			want:  "a\nx\nc\n",
+		},
+		{
+			name:  "empty patch leaves the text unchanged",
+			text:  "a\nb\n",
+			patch: "",
+			want:  "a\nb\n",
+		},
+		{
+			name:  "wrong line numbers are tolerated",
+			text:  "1\n2\n3\n4\n5\n6\n7\n8\n",
+			patch: "@@ -2,3 +2,3 @@\n 5\n-6\n+six\n 7\n",
+			want:  "1\n2\n3\n4\n5\nsix\n7\n8\n",
+		},
+		{
+			name:  "hunk header without line numbers",
+			text:  "a\nb\nc\n",
+			patch: "@@ @@\n a\n-b\n+x\n",
+			fails: true,
+		},
+		{
+			name:  "hint picks the closest match",
+			text:  "x\ny\nx\ny\n",
+			patch: "@@ -3,2 +3,2 @@\n x\n-y\n+z\n",
+			want:  "x\ny\nx\nz\n",
+		},
+		{
+			name:  "blank context line without its space",
+			text:  "a\n\nb\n",
+			patch: "@@ -1,3 +1,3 @@\n a\n\n-b\n+c\n",
+			want:  "a\n\nc\n",
+		},
+		{
+			name:  "trailing whitespace is ignored when matching",
+			text:  "a  \nb\n",
+			patch: "@@ -1,2 +1,2 @@\n a\n-b\n+c\n",
+			want:  "a  \nc\n",
+		},
+		{
+			name:  "removing the final newline",
+			text:  "a\nb\n",
+			patch: "@@ -1,2 +1,2 @@\n a\n-b\n+b\n\\ No newline at end of file\n",
+			want:  "a\nb",
+		},
+		{
+			name:  "text without final newline",
+			text:  "a\nb",
+			patch: "@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n\\ No newline at end of file\n",
+			want:  "a\nc",
+		},
+		{
+			name:  "appending after a line without newline",
+			text:  "a",
+			patch: "@@ -1 +1,2 @@\n-a\n\\ No newline at end of file\n+a\n+b\n",
+			want:  "a\nb\n",
+		},
+		{
+			name:  "insertion into an empty text",
+			text:  "",
+			patch: "@@ -0,0 +1,2 @@\n+a\n+b\n",
+			want:  "a\nb\n",
+		},
+		{
+			name:  "several hunks",
+			text:  "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+			patch: "@@ -1,2 +1,2 @@\n-1\n+one\n 2\n@@ -9,2 +9,2 @@\n 9\n-10\n+ten\n",
+			want:  "one\n2\n3\n4\n5\n6\n7\n8\n9\nten\n",
+		},
+		{
+			name:    "context that doesn't match",
+			text:    "a\nb\nc\n",
+			patch:   "@@ -1,3 +1,3 @@\n a\n-q\n+x\n c\n",
+			wantErr: ErrConflict,
+		},
+		{
+			name:    "hunks out of order",
+			text:    "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+			patch:   "@@ -9,2 +9,2 @@\n 9\n-10\n+ten\n@@ -1,2 +1,2 @@\n-1\n+one\n 2\n",
+			wantErr: ErrConflict,
+		},
+		{
+			name:    "hunk longer than the text",
+			text:    "a\n",
+			patch:   "@@ -1,2 +1,2 @@\n a\n-b\n",
+			wantErr: ErrConflict,
+		},
+		{
+			name:  "text without hunks",
+			text:  "a\n",
+			patch: "Here is the change you asked for.\n",
+			fails: true,
+		},
+		{
+			name:  "invalid line in a hunk",
+			text:  "a\nb\n",
+			patch: "@@ -1,2 +1,2 @@\n a\n*b\n",
+			fails: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Apply(tt.text, tt.patch)
+			switch {
+			case tt.wantErr != nil || tt.fails:
+				if err == nil {
+					t.Fatalf("Apply() = %q, want an error", got)
+				}
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Apply() error = %v, want %v", err, tt.wantErr)
+				}
+			case err != nil:
+				t.Fatalf("Apply() error = %v", err)
+			case got != tt.want:
+				t.Errorf("Apply() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyUnifiedRoundTrip(t *testing.T) {
+	pairs := [][2]string{
+		{"", ""},
+		{"", "a\nb\n"},
+		{"a\nb\n", ""},
+		{"a\nb", "a\nb\n"},
+		{"a\nb\n", "a\nb"},
+		{"a\n\n\nb\n", "a\n\nb\n\n"},
+		{"x\nx\nx\nx\n", "x\ny\nx\nx\nx\ny\n"},
+		{
+			"package main\n\nfunc main() {\n\tprintln(\"hi\")\n}\n",
+			"package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(\"hi\")\n}\n",
+		},
+	}
+
+	// Random edits of a text with many repeated lines, where hunks are
+	// easy to place at the wrong position
+	rng := rand.New(rand.NewSource(1))
+	words := []string{"a", "b", "c", "", "}", "return nil"}
+	text := func(n int) string {
+		lines := make([]string, n)
+		for i := range lines {
+			lines[i] = words[rng.Intn(len(words))]
+		}
+		s := strings.Join(lines, "\n")
+		if rng.Intn(2) == 0 {
+			s += "\n"
+		}
+		return s
+	}
+	for range 200 {
+		pairs = append(pairs, [2]string{text(rng.Intn(40)), text(rng.Intn(40))})
+	}
+
+	for i, pair := range pairs {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			from, to := pair[0], pair[1]
+			patch := Unified("a", "b", from, to)
+			got, err := Apply(from, patch)
+			if err != nil {
+				t.Fatalf("Apply(%q, Unified()) error = %v\npatch:\n%s", from, err, patch)
+			}
+			if got != to {
+				t.Fatalf("Apply(%q, Unified()) = %q, want %q\npatch:\n%s", from, got, to, patch)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"backend/internal/auth"
+	"backend/internal/authz"
+	"backend/internal/database"
+	"backend/internal/middleware"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// currentPrincipal returns the authenticated principal for the request.
+// It fails instead of panicking when a route is missing AuthMiddleware.
+func currentPrincipal(c *fiber.Ctx) (*auth.Principal, error) {
+	principal, ok := middleware.GetPrincipal(c)
+	if !ok {
+		return nil, fiber.NewError(fiber.StatusUnauthorized, "Authentication required")
+	}
+	return principal, nil
+}
+
+// authorizeChat loads a chat and checks that principal may perform action on it.
+// Chats in the trash are reported as not found.
+func (h *Handler) authorizeChat(c *fiber.Ctx, principal *auth.Principal, action authz.Action, chatID int) (*database.Chat, error) {
+	chat, ferr := h.authorizeChatInTrash(c, principal, action, chatID)
+	if ferr != nil {
+		return nil, ferr
+	}
+
+	if chat.DeletedAt != nil {
+		return nil, fiber.NewError(fiber.StatusNotFound, "Chat not found")
+	}
+
+	return chat, nil
+}
+
+// authorizeChatInTrash is like authorizeChat but also returns trashed chats
+func (h *Handler) authorizeChatInTrash(c *fiber.Ctx, principal *auth.Principal, action authz.Action, chatID int) (*database.Chat, error) {
+	chat, err := h.db.GetChatByID(c.UserContext(), chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.policy.Chat(c.UserContext(), principal, action, chat); err != nil {
+		return nil, err
+	}
+
+	return chat, nil
+}
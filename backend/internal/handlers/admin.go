@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"backend/internal/auth"
+	"backend/internal/database"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultAdminPageSize = 50
+	maxAdminPageSize     = 200
+)
+
+type AdminUserResponse struct {
+	ID         int    `json:"id"`
+	Name       string `json:"name"`
+	Email      string `json:"email"`
+	Role       string `json:"role"`
+	Disabled   bool   `json:"disabled"`
+	DisabledAt string `json:"disabledAt,omitempty"`
+	CreatedAt  string `json:"createdAt"`
+}
+
+type AdminUserListResponse struct {
+	Users []AdminUserResponse `json:"users"`
+	Total int                 `json:"total"`
+}
+
+type UserUsageResponse struct {
+	UserID       int    `json:"userId"`
+	ChatCount    int    `json:"chatCount"`
+	MessageCount int    `json:"messageCount"`
+	PromptCount  int    `json:"promptCount"`
+	LastActiveAt string `json:"lastActiveAt,omitempty"`
+}
+
+type AdminUserDetailResponse struct {
+	User  AdminUserResponse `json:"user"`
+	Usage UserUsageResponse `json:"usage"`
+}
+
+type UsageStatsResponse struct {
+	TotalUsers    int `json:"totalUsers"`
+	DisabledUsers int `json:"disabledUsers"`
+	TotalChats    int `json:"totalChats"`
+	TotalMessages int `json:"totalMessages"`
+	Prompts24h    int `json:"prompts24h"`
+	Prompts7d     int `json:"prompts7d"`
+	ActiveUsers7d int `json:"activeUsers7d"`
+}
+
+type UpdateUserRoleRequest struct {
+	Role string `json:"role" validate:"required,oneof=user admin support"`
+}
+
+// AdminListUsersHandler lists and searches users
+func (h *Handler) AdminListUsersHandler(c *fiber.Ctx) error {
+	limit := c.QueryInt("limit", defaultAdminPageSize)
+	if limit <= 0 || limit > maxAdminPageSize {
+		limit = defaultAdminPageSize
+	}
+	offset := c.QueryInt("offset", 0)
+	if offset < 0 {
+		offset = 0
+	}
+
+	users, total, err := h.db.ListUsers(c.UserContext(), database.UserFilter{
+		Query:  c.Query("q"),
+		Role:   c.Query("role"),
+		Limit:  limit,
+		Offset: offset,
+	})
+	if err != nil {
+		return internalError("Failed to list users", err)
+	}
+
+	resp := AdminUserListResponse{Users: []AdminUserResponse{}, Total: total}
+	for _, user := range users {
+		resp.Users = append(resp.Users, dbUserToAdminResponse(user))
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": resp})
+}
+
+// AdminGetUserHandler returns a single user together with their usage
+func (h *Handler) AdminGetUserHandler(c *fiber.Ctx) error {
+	userID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid user ID")
+	}
+
+	user, err := h.db.GetUserByID(c.UserContext(), userID)
+	if err != nil {
+		return err
+	}
+
+	usage, err := h.db.GetUserUsage(c.UserContext(), userID)
+	if err != nil {
+		return internalError("Failed to get usage", err)
+	}
+
+	resp := AdminUserDetailResponse{
+		User:  dbUserToAdminResponse(user),
+		Usage: dbUsageToResponse(usage),
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": resp})
+}
+
+// AdminUpdateUserRoleHandler changes a user's role and revokes their sessions
+func (h *Handler) AdminUpdateUserRoleHandler(c *fiber.Ctx) error {
+	user, ferr := h.managedUser(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	var req UpdateUserRoleRequest
+	if err := h.parseBody(c, &req); err != nil {
+		return err
+	}
+
+	role, err := auth.ParseRole(req.Role)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Role must be one of: user, admin, support")
+	}
+
+	if err := h.db.UpdateUserRole(c.UserContext(), user.ID, string(role)); err != nil {
+		return internalError("Failed to update role", err)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Role updated"})
+}
+
+// AdminDisableUserHandler blocks a user from signing in or using existing tokens
+func (h *Handler) AdminDisableUserHandler(c *fiber.Ctx) error {
+	return h.setUserDisabled(c, true)
+}
+
+// AdminEnableUserHandler re-enables a previously disabled account
+func (h *Handler) AdminEnableUserHandler(c *fiber.Ctx) error {
+	return h.setUserDisabled(c, false)
+}
+
+func (h *Handler) setUserDisabled(c *fiber.Ctx, disabled bool) error {
+	user, ferr := h.managedUser(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	if err := h.db.SetUserDisabled(c.UserContext(), user.ID, disabled); err != nil {
+		return internalError("Failed to update account status", err)
+	}
+
+	message := "Account enabled"
+	if disabled {
+		message = "Account disabled"
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": message})
+}
+
+// AdminRevokeSessionsHandler invalidates every session and personal access
+// token of a user
+func (h *Handler) AdminRevokeSessionsHandler(c *fiber.Ctx) error {
+	user, ferr := h.managedUser(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	if err := h.db.RevokeUserSessions(c.UserContext(), user.ID); err != nil {
+		return internalError("Failed to revoke sessions", err)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Sessions and access tokens revoked"})
+}
+
+// AdminUsageStatsHandler returns system-wide usage figures
+func (h *Handler) AdminUsageStatsHandler(c *fiber.Ctx) error {
+	stats, err := h.db.GetUsageStats(c.UserContext())
+	if err != nil {
+		return internalError("Failed to get usage stats", err)
+	}
+
+	resp := UsageStatsResponse{
+		TotalUsers:    stats.TotalUsers,
+		DisabledUsers: stats.DisabledUsers,
+		TotalChats:    stats.TotalChats,
+		TotalMessages: stats.TotalMessages,
+		Prompts24h:    stats.Prompts24h,
+		Prompts7d:     stats.Prompts7d,
+		ActiveUsers7d: stats.ActiveUsers7d,
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": resp})
+}
+
+// managedUser loads the user targeted by an admin action. Staff cannot act
+// on their own account, and only admins can act on other admins.
+func (h *Handler) managedUser(c *fiber.Ctx) (*database.User, error) {
+	principal, ferr := currentPrincipal(c)
+	if ferr != nil {
+		return nil, ferr
+	}
+
+	userID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid user ID")
+	}
+
+	if userID == principal.UserID {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "You cannot modify your own account")
+	}
+
+	user, err := h.db.GetUserByID(c.UserContext(), userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if auth.Role(user.Role) == auth.RoleAdmin && !principal.HasRole(auth.RoleAdmin) {
+		return nil, fiber.NewError(fiber.StatusForbidden, "Insufficient permissions")
+	}
+
+	return user, nil
+}
+
+func dbUserToAdminResponse(user *database.User) AdminUserResponse {
+	resp := AdminUserResponse{
+		ID:        user.ID,
+		Name:      user.Name,
+		Email:     user.Email,
+		Role:      user.Role,
+		Disabled:  user.DisabledAt != nil,
+		CreatedAt: user.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+	if user.DisabledAt != nil {
+		resp.DisabledAt = user.DisabledAt.Format("2006-01-02T15:04:05Z07:00")
+	}
+	return resp
+}
+
+func dbUsageToResponse(usage *database.UserUsage) UserUsageResponse {
+	resp := UserUsageResponse{
+		UserID:       usage.UserID,
+		ChatCount:    usage.ChatCount,
+		MessageCount: usage.MessageCount,
+		PromptCount:  usage.PromptCount,
+	}
+	if usage.LastActiveAt != nil {
+		resp.LastActiveAt = usage.LastActiveAt.Format("2006-01-02T15:04:05Z07:00")
+	}
+	return resp
+}
@@ -2,21 +2,23 @@ package handlers
 
 import (
 	"backend/internal/auth"
-	"strings"
+	"backend/internal/database"
+	"errors"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 type SignupRequest struct {
-	Name     string `json:"name"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Name     string `json:"name" validate:"required,min=2,max=100"`
+	Email    string `json:"email" validate:"required,email,max=254"`
+	Password string `json:"password" validate:"required,min=8,max=72,maxbytes=72"` // bcrypt takes at most 72 bytes
 }
 
 type UserResponse struct {
 	ID        int    `json:"id"`
 	Name      string `json:"name"`
 	Email     string `json:"email"`
+	Role      string `json:"role"`
 	CreatedAt string `json:"createdAt"`
 }
 
@@ -27,62 +29,40 @@ type SignupResponse struct {
 
 func (h *Handler) SignupHandler(c *fiber.Ctx) error {
 	var req SignupRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"success": false,
-			"message": "Invalid request body",
-		})
-	}
-
-	// Validate input
-	if err := validateSignupRequest(req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"success": false,
-			"message": err.Error(),
-		})
+	if err := h.parseBody(c, &req); err != nil {
+		return err
 	}
 
 	// Check if email already exists
-	existingUser, err := h.db.CheckEmailExists(c.Context(), req.Email)
+	existingUser, err := h.db.CheckEmailExists(c.UserContext(), req.Email)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"success": false,
-			"message": err.Error(),
-		})
+		return internalError("Failed to create user account", err)
 	}
 
 	if existingUser {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"success": false,
-			"message": "Email already registered",
-		})
+		return fiber.NewError(fiber.StatusConflict, "Email already registered")
 	}
 
 	// Hash password
 	hashedPassword, err := auth.HashPassword(req.Password)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"success": false,
-			"message": "Failed to process password",
-		})
+		return internalError("Failed to process password", err)
 	}
 
-	// Create user in database
-	user, err := h.db.CreateUser(c.Context(), req.Name, req.Email, hashedPassword)
+	// Create user in database; a concurrent signup may have taken the email
+	// since the check
+	user, err := h.db.CreateUser(c.UserContext(), req.Name, req.Email, hashedPassword)
+	if errors.Is(err, database.ErrConflict) {
+		return fiber.NewError(fiber.StatusConflict, "Email already registered")
+	}
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"success": false,
-			"message": "Failed to create user account",
-		})
+		return internalError("Failed to create user account", err)
 	}
 
 	// Generate JWT token
-	token, err := auth.GenerateToken(user.ID, user.Email)
+	token, err := auth.GenerateToken(user.ID, user.Email, auth.Role(user.Role), user.TokenVersion)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"success": false,
-			"message": "Failed to generate authentication token",
-		})
+		return internalError("Failed to generate authentication token", err)
 	}
 
 	// Prepare response
@@ -91,6 +71,7 @@ func (h *Handler) SignupHandler(c *fiber.Ctx) error {
 			ID:        user.ID,
 			Name:      user.Name,
 			Email:     user.Email,
+			Role:      user.Role,
 			CreatedAt: user.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
 		},
 		Token: token,
@@ -104,8 +85,8 @@ func (h *Handler) SignupHandler(c *fiber.Ctx) error {
 }
 
 type LoginRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
 }
 
 type LoginResponse struct {
@@ -115,45 +96,33 @@ type LoginResponse struct {
 
 func (h *Handler) LoginHandler(c *fiber.Ctx) error {
 	var req LoginRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"success": false,
-			"message": "Invalid request body",
-		})
-	}
-
-	// Validate input
-	if err := validateLoginRequest(req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"success": false,
-			"message": err.Error(),
-		})
+	if err := h.parseBody(c, &req); err != nil {
+		return err
 	}
 
 	// Get user by email
-	user, err := h.db.GetUserByEmail(c.Context(), req.Email)
+	user, err := h.db.GetUserByEmail(c.UserContext(), req.Email)
+	if errors.Is(err, database.ErrNotFound) {
+		return fiber.NewError(fiber.StatusUnauthorized, "Invalid email or password")
+	}
 	if err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"success": false,
-			"message": "Invalid email or password",
-		})
+		return internalError("Failed to log in", err)
 	}
 
 	// Verify password
 	if err := auth.CheckPassword(user.Password, req.Password); err != nil {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-			"success": false,
-			"message": "Invalid email or password",
-		})
+		return fiber.NewError(fiber.StatusUnauthorized, "Invalid email or password")
+	}
+
+	// Disabled accounts cannot sign in
+	if user.DisabledAt != nil {
+		return fiber.NewError(fiber.StatusForbidden, "Account is disabled")
 	}
 
 	// Generate JWT token
-	token, err := auth.GenerateToken(user.ID, user.Email)
+	token, err := auth.GenerateToken(user.ID, user.Email, auth.Role(user.Role), user.TokenVersion)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"success": false,
-			"message": "Failed to generate authentication token",
-		})
+		return internalError("Failed to generate authentication token", err)
 	}
 
 	// Prepare response
@@ -162,6 +131,7 @@ func (h *Handler) LoginHandler(c *fiber.Ctx) error {
 			ID:        user.ID,
 			Name:      user.Name,
 			Email:     user.Email,
+			Role:      user.Role,
 			CreatedAt: user.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
 		},
 		Token: token,
@@ -174,48 +144,47 @@ func (h *Handler) LoginHandler(c *fiber.Ctx) error {
 	})
 }
 
-func validateLoginRequest(req LoginRequest) error {
-	// Validate email
-	if strings.TrimSpace(req.Email) == "" {
-		return fiber.NewError(fiber.StatusBadRequest, "Email is required")
-	}
-	if !strings.Contains(req.Email, "@") {
-		return fiber.NewError(fiber.StatusBadRequest, "Invalid email format")
+// RefreshTokenHandler issues a new session token for the authenticated
+// user, so clients can extend a session before its token expires. The new
+// token carries the user's current role.
+func (h *Handler) RefreshTokenHandler(c *fiber.Ctx) error {
+	principal, ferr := currentPrincipal(c)
+	if ferr != nil {
+		return ferr
 	}
 
-	// Validate password
-	if strings.TrimSpace(req.Password) == "" {
-		return fiber.NewError(fiber.StatusBadRequest, "Password is required")
+	// Personal access tokens don't expire like sessions and can't be
+	// exchanged for one
+	if principal.TokenID != 0 {
+		return fiber.NewError(fiber.StatusForbidden, "Personal access tokens cannot be refreshed")
 	}
 
-	return nil
-}
-
-func validateSignupRequest(req SignupRequest) error {
-
-	// Validate name
-	if strings.TrimSpace(req.Name) == "" {
-		return fiber.NewError(fiber.StatusBadRequest, "Name is required")
+	user, err := h.db.GetUserByID(c.UserContext(), principal.UserID)
+	if errors.Is(err, database.ErrNotFound) {
+		return fiber.NewError(fiber.StatusUnauthorized, "Invalid or expired token")
 	}
-	if len(req.Name) < 2 {
-		return fiber.NewError(fiber.StatusBadRequest, "Name must be at least 2 characters")
+	if err != nil {
+		return internalError("Failed to refresh token", err)
 	}
 
-	// Validate email
-	if strings.TrimSpace(req.Email) == "" {
-		return fiber.NewError(fiber.StatusBadRequest, "Email is required")
-	}
-	if !strings.Contains(req.Email, "@") {
-		return fiber.NewError(fiber.StatusBadRequest, "Invalid email format")
+	token, err := auth.GenerateToken(user.ID, user.Email, auth.Role(user.Role), user.TokenVersion)
+	if err != nil {
+		return internalError("Failed to generate authentication token", err)
 	}
 
-	// Validate password
-	if strings.TrimSpace(req.Password) == "" {
-		return fiber.NewError(fiber.StatusBadRequest, "Password is required")
-	}
-	if len(req.Password) < 8 {
-		return fiber.NewError(fiber.StatusBadRequest, "Password must be at least 8 characters")
+	response := LoginResponse{
+		User: UserResponse{
+			ID:        user.ID,
+			Name:      user.Name,
+			Email:     user.Email,
+			Role:      user.Role,
+			CreatedAt: user.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		},
+		Token: token,
 	}
 
-	return nil
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    response,
+	})
 }
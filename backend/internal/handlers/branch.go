@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"backend/internal/authz"
+	"backend/internal/database"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type EditMessageRequest struct {
+	Content    string  `json:"content" validate:"required,max=$maxPrompt"`
+	Language   *string `json:"language,omitempty" validate:"language"` // defaults to the edited message's language
+	Candidates int     `json:"candidates,omitempty" validate:"min=1,max=$maxCandidates"`
+}
+
+type RegenerateRequest struct {
+	Candidates int `json:"candidates,omitempty" validate:"min=1,max=$maxCandidates"`
+}
+
+type SelectBranchRequest struct {
+	MessageID int `json:"messageId" validate:"required"`
+}
+
+// EditMessageHandler edits a prompt without losing the original: the new
+// content is saved as a sibling of the edited message, starting a new branch
+// that becomes active, and the model answers it with the messages before
+// the edited one as context.
+func (h *Handler) EditMessageHandler(c *fiber.Ctx) error {
+	principal, ferr := currentPrincipal(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	messageID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid message ID")
+	}
+
+	message, err := h.db.GetMessageByID(c.UserContext(), messageID)
+	if err != nil {
+		return err
+	}
+
+	chat, ferr := h.authorizeChat(c, principal, authz.ActionWrite, message.ChatID)
+	if ferr != nil {
+		return ferr
+	}
+
+	if message.Role != "user" {
+		return fiber.NewError(fiber.StatusBadRequest, "Only prompts can be edited")
+	}
+
+	var req EditMessageRequest
+	if err := h.parseBody(c, &req); err != nil {
+		return err
+	}
+	candidates := candidateCount(req.Candidates)
+
+	language := message.Language
+	if req.Language != nil {
+		language = *req.Language
+	}
+
+	var history []*database.Message
+	if message.ParentID != nil {
+		history, err = h.db.GetBranch(c.UserContext(), chat.ID, *message.ParentID)
+		if err != nil {
+			return internalError("Failed to get messages", err)
+		}
+	}
+
+	prompt, err := h.db.CreateMessage(c.UserContext(), database.CreateMessageParams{
+		ChatID:   chat.ID,
+		ParentID: message.ParentID,
+		Role:     "user",
+		Content:  req.Content,
+		Language: language,
+		Mode:     message.Mode,
+		Metadata: message.Metadata,
+	})
+	if err != nil {
+		return internalError("Failed to save message", err)
+	}
+
+	resp, ferr := h.reply(c.UserContext(), history, prompt, candidates, nil)
+	if ferr != nil {
+		return ferr
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": resp})
+}
+
+// RegenerateMessageHandler asks the model for another take on a reply. The
+// new replies are stored as alternatives of the given assistant message (or
+// as further replies when a prompt is given) and the first one becomes active.
+func (h *Handler) RegenerateMessageHandler(c *fiber.Ctx) error {
+	principal, ferr := currentPrincipal(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	messageID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid message ID")
+	}
+
+	message, err := h.db.GetMessageByID(c.UserContext(), messageID)
+	if err != nil {
+		return err
+	}
+
+	chat, ferr := h.authorizeChat(c, principal, authz.ActionWrite, message.ChatID)
+	if ferr != nil {
+		return ferr
+	}
+
+	// The body is optional
+	var req RegenerateRequest
+	if len(c.Body()) > 0 {
+		if err := h.parseBody(c, &req); err != nil {
+			return err
+		}
+	}
+	candidates := candidateCount(req.Candidates)
+
+	prompt := message
+	if message.Role != "user" {
+		if message.ParentID == nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Message has no prompt to regenerate from")
+		}
+		prompt, err = h.db.GetMessageByID(c.UserContext(), *message.ParentID)
+		if err != nil {
+			return internalError("Failed to get messages", err)
+		}
+	}
+
+	var history []*database.Message
+	if prompt.ParentID != nil {
+		history, err = h.db.GetBranch(c.UserContext(), chat.ID, *prompt.ParentID)
+		if err != nil {
+			return internalError("Failed to get messages", err)
+		}
+	}
+
+	resp, ferr := h.reply(c.UserContext(), history, prompt, candidates, nil)
+	if ferr != nil {
+		return ferr
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": resp})
+}
+
+// SelectMessageHandler makes a message, typically one of several candidate
+// replies, part of the active branch so that later prompts continue from it
+func (h *Handler) SelectMessageHandler(c *fiber.Ctx) error {
+	principal, ferr := currentPrincipal(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	messageID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid message ID")
+	}
+
+	message, err := h.db.GetMessageByID(c.UserContext(), messageID)
+	if err != nil {
+		return err
+	}
+
+	chat, ferr := h.authorizeChat(c, principal, authz.ActionWrite, message.ChatID)
+	if ferr != nil {
+		return ferr
+	}
+
+	return h.selectBranch(c, chat, message.ID)
+}
+
+// SelectBranchHandler switches the active branch of a chat to the one going
+// through the given message. When the message has replies, the most recent
+// conversation that continued from it is selected.
+func (h *Handler) SelectBranchHandler(c *fiber.Ctx) error {
+	principal, ferr := currentPrincipal(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	chatID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid chat ID")
+	}
+
+	chat, ferr := h.authorizeChat(c, principal, authz.ActionWrite, chatID)
+	if ferr != nil {
+		return ferr
+	}
+
+	var req SelectBranchRequest
+	if err := h.parseBody(c, &req); err != nil {
+		return err
+	}
+
+	return h.selectBranch(c, chat, req.MessageID)
+}
+
+// selectBranch activates the latest branch going through messageID
+func (h *Handler) selectBranch(c *fiber.Ctx, chat *database.Chat, messageID int) error {
+	leafID, err := h.db.GetLatestLeaf(c.UserContext(), chat.ID, messageID)
+	if err != nil {
+		return err
+	}
+
+	if err := h.db.SetActiveMessage(c.UserContext(), chat.ID, leafID); err != nil {
+		return internalError("Failed to select branch", err)
+	}
+
+	chat.ActiveMessageID = &leafID
+	return c.JSON(fiber.Map{"success": true, "data": dbChatToResponse(chat)})
+}
+
+// withBranchInfo adds sibling navigation to messages that have alternatives
+func (h *Handler) withBranchInfo(c *fiber.Ctx, messages []MessageResponse) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	ids := make([]int, len(messages))
+	for i, msg := range messages {
+		ids[i] = msg.ID
+	}
+
+	siblings, err := h.db.GetMessageSiblings(c.UserContext(), ids)
+	if err != nil {
+		return internalError("Failed to get messages", err)
+	}
+
+	for i := range messages {
+		ids := siblings[messages[i].ID]
+		if len(ids) < 2 {
+			continue
+		}
+		messages[i].Branch = &BranchInfo{SiblingIDs: ids}
+		for j, id := range ids {
+			if id == messages[i].ID {
+				messages[i].Branch.Index = j
+			}
+		}
+	}
+
+	return nil
+}
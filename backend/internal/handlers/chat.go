@@ -1,148 +1,366 @@
 package handlers
 
 import (
+	"backend/internal/authz"
 	"backend/internal/database"
+	"encoding/json"
 	"strconv"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 type CreateChatRequest struct {
-	Title string `json:"title"`
+	Title       string `json:"title" validate:"max=200"`
+	WorkspaceID *int   `json:"workspaceId,omitempty"`
+}
+
+type UpdateChatRequest struct {
+	Title    *string `json:"title,omitempty" validate:"notblank,max=200"`
+	Pinned   *bool   `json:"pinned,omitempty"`
+	Archived *bool   `json:"archived,omitempty"`
 }
 
 type ChatResponse struct {
-	ID        int    `json:"id"`
-	Title     string `json:"title"`
-	UserID    int    `json:"userId"`
-	CreatedAt string `json:"createdAt"`
-	UpdatedAt string `json:"updatedAt"`
+	ID              int    `json:"id"`
+	Title           string `json:"title"`
+	UserID          int    `json:"userId,omitempty"`
+	WorkspaceID     *int   `json:"workspaceId,omitempty"`
+	ActiveMessageID *int   `json:"activeMessageId,omitempty"`
+	Pinned          bool   `json:"pinned"`
+	ArchivedAt      string `json:"archivedAt,omitempty"`
+	DeletedAt       string `json:"deletedAt,omitempty"`
+	CreatedAt       string `json:"createdAt"`
+	UpdatedAt       string `json:"updatedAt"`
 }
 
 type MessageResponse struct {
-	ID        int    `json:"id"`
-	ChatID    int    `json:"chatId"`
-	Role      string `json:"role"`
-	Content   string `json:"content"`
-	Language  string `json:"language,omitempty"`
-	CreatedAt string `json:"createdAt"`
+	ID        int               `json:"id"`
+	ChatID    int               `json:"chatId"`
+	ParentID  *int              `json:"parentId,omitempty"`
+	Role      string            `json:"role"`
+	Content   string            `json:"content"`
+	Language  string            `json:"language,omitempty"`
+	Model     string            `json:"model,omitempty"`
+	Mode      string            `json:"mode"`
+	Metadata  json.RawMessage   `json:"metadata,omitempty"` // task input of a prompt, structured result of a reply
+	Branch    *BranchInfo       `json:"branch,omitempty"`   // set when the message has alternatives
+	Feedback  *FeedbackResponse `json:"feedback,omitempty"` // the current user's rating
+	CreatedAt string            `json:"createdAt"`
+}
+
+// BranchInfo lets clients page through the alternatives of a message
+type BranchInfo struct {
+	SiblingIDs []int `json:"siblingIds"` // oldest first, including the message itself
+	Index      int   `json:"index"`      // position of the message in SiblingIDs
 }
 
 type ChatWithMessagesResponse struct {
-	Chat     ChatResponse      `json:"chat"`
-	Messages []MessageResponse `json:"messages"`
+	Chat       ChatResponse      `json:"chat"`
+	Messages   []MessageResponse `json:"messages"`
+	NextCursor string            `json:"nextCursor,omitempty"` // loads older messages
 }
 
 // CreateChatHandler creates a new chat session
 func (h *Handler) CreateChatHandler(c *fiber.Ctx) error {
-	userID := c.Locals("userID").(int)
+	principal, ferr := currentPrincipal(c)
+	if ferr != nil {
+		return ferr
+	}
 
 	var req CreateChatRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "message": "Invalid request body"})
+	if err := h.parseBody(c, &req); err != nil {
+		return err
 	}
 
-	title := req.Title
+	title := strings.TrimSpace(req.Title)
 	if title == "" {
 		title = "New Chat"
 	}
 
-	chat, err := h.db.CreateChat(c.Context(), userID, title)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "message": "Failed to create chat"})
+	// Creating a chat inside a workspace requires editor access
+	if req.WorkspaceID != nil {
+		if err := h.policy.Workspace(c.UserContext(), principal, authz.ActionWrite, *req.WorkspaceID); err != nil {
+			return err
+		}
 	}
 
-	resp := ChatResponse{
-		ID:        chat.ID,
-		Title:     chat.Title,
-		UserID:    chat.UserID,
-		CreatedAt: chat.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-		UpdatedAt: chat.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	chat, err := h.db.CreateChat(c.UserContext(), principal.UserID, req.WorkspaceID, title)
+	if err != nil {
+		return internalError("Failed to create chat", err)
 	}
 
-	return c.JSON(fiber.Map{"success": true, "data": resp})
+	return c.JSON(fiber.Map{"success": true, "data": dbChatToResponse(chat)})
 }
 
-// GetChatsHandler returns all chats for the authenticated user
+// GetChatsHandler returns the authenticated user's personal chats, or the
+// chats of a workspace when ?workspaceId= is given. Archived chats are
+// hidden unless ?archived=true|all; ?pinned= and ?trashed=true also filter.
+// Results are paginated with ?limit= and ?cursor=.
 func (h *Handler) GetChatsHandler(c *fiber.Ctx) error {
-	userID := c.Locals("userID").(int)
+	principal, ferr := currentPrincipal(c)
+	if ferr != nil {
+		return ferr
+	}
 
-	chats, err := h.db.GetChatsByUser(c.Context(), userID)
+	filter, ferr := chatFilterFromQuery(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	page, ferr := pageFromQuery(c, defaultChatPageSize, maxChatPageSize)
+	if ferr != nil {
+		return ferr
+	}
+
+	var chats []*database.Chat
+	var next *database.Cursor
+	var err error
+	if workspaceIDStr := c.Query("workspaceId"); workspaceIDStr != "" {
+		workspaceID, convErr := strconv.Atoi(workspaceIDStr)
+		if convErr != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid workspace ID")
+		}
+		if err := h.policy.Workspace(c.UserContext(), principal, authz.ActionRead, workspaceID); err != nil {
+			return err
+		}
+		chats, next, err = h.db.GetChatsByWorkspace(c.UserContext(), workspaceID, filter, page)
+	} else {
+		chats, next, err = h.db.GetChatsByUser(c.UserContext(), principal.UserID, filter, page)
+	}
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "message": "Failed to get chats"})
+		return internalError("Failed to get chats", err)
 	}
 
 	var chatResponses []ChatResponse
 	for _, chat := range chats {
-		chatResponses = append(chatResponses, ChatResponse{
-			ID:        chat.ID,
-			Title:     chat.Title,
-			UserID:    chat.UserID,
-			CreatedAt: chat.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-			UpdatedAt: chat.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
-		})
+		chatResponses = append(chatResponses, dbChatToResponse(chat))
 	}
 
-	return c.JSON(fiber.Map{"success": true, "data": chatResponses})
+	return c.JSON(fiber.Map{"success": true, "data": chatResponses, "nextCursor": encodeCursor(next)})
 }
 
-// GetChatHandler returns a specific chat with its messages
+// GetChatHandler returns a specific chat with the most recent messages of its
+// active branch. Older messages are loaded by passing the returned nextCursor
+// as ?cursor=.
 func (h *Handler) GetChatHandler(c *fiber.Ctx) error {
-	userID := c.Locals("userID").(int)
-	chatIDStr := c.Params("id")
+	principal, ferr := currentPrincipal(c)
+	if ferr != nil {
+		return ferr
+	}
 
-	chatID, err := strconv.Atoi(chatIDStr)
+	chatID, err := strconv.Atoi(c.Params("id"))
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "message": "Invalid chat ID"})
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid chat ID")
 	}
 
-	chat, err := h.db.GetChatByID(c.Context(), chatID)
-	if err != nil {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"success": false, "message": "Chat not found"})
+	chat, ferr := h.authorizeChat(c, principal, authz.ActionRead, chatID)
+	if ferr != nil {
+		return ferr
 	}
 
-	// Verify ownership
-	if chat.UserID != userID {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"success": false, "message": "Access denied"})
+	page, ferr := pageFromQuery(c, defaultMessagePageSize, maxMessagePageSize)
+	if ferr != nil {
+		return ferr
 	}
 
-	messages, err := h.db.GetMessagesByChat(c.Context(), chatID)
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "message": "Failed to get messages"})
+	var messages []*database.Message
+	var next *database.Cursor
+	if chat.ActiveMessageID != nil {
+		messages, next, err = h.db.GetBranchPage(c.UserContext(), chat.ID, *chat.ActiveMessageID, page)
+		if err != nil {
+			return internalError("Failed to get messages", err)
+		}
 	}
 
 	var messageResponses []MessageResponse
 	for _, msg := range messages {
-		messageResponses = append(messageResponses, MessageResponse{
-			ID:        msg.ID,
-			ChatID:    msg.ChatID,
-			Role:      msg.Role,
-			Content:   msg.Content,
-			Language:  msg.Language,
-			CreatedAt: msg.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-		})
+		messageResponses = append(messageResponses, dbMessageToResponse(msg))
+	}
+
+	if ferr := h.withBranchInfo(c, messageResponses); ferr != nil {
+		return ferr
+	}
+
+	if ferr := h.withFeedback(c, principal.UserID, messageResponses); ferr != nil {
+		return ferr
 	}
 
 	resp := ChatWithMessagesResponse{
-		Chat: ChatResponse{
-			ID:        chat.ID,
-			Title:     chat.Title,
-			UserID:    chat.UserID,
-			CreatedAt: chat.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-			UpdatedAt: chat.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
-		},
-		Messages: messageResponses,
+		Chat:       dbChatToResponse(chat),
+		Messages:   messageResponses,
+		NextCursor: encodeCursor(next),
 	}
 
 	return c.JSON(fiber.Map{"success": true, "data": resp})
 }
 
+// UpdateChatHandler renames, pins/unpins or archives/unarchives a chat
+func (h *Handler) UpdateChatHandler(c *fiber.Ctx) error {
+	principal, ferr := currentPrincipal(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	chatID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid chat ID")
+	}
+
+	chat, ferr := h.authorizeChat(c, principal, authz.ActionWrite, chatID)
+	if ferr != nil {
+		return ferr
+	}
+
+	var req UpdateChatRequest
+	if err := h.parseBody(c, &req); err != nil {
+		return err
+	}
+
+	if req.Title != nil {
+		title := strings.TrimSpace(*req.Title)
+		req.Title = &title
+	}
+
+	chat, err = h.db.UpdateChat(c.UserContext(), chat.ID, database.ChatUpdate{
+		Title:    req.Title,
+		Pinned:   req.Pinned,
+		Archived: req.Archived,
+	})
+	if err != nil {
+		return internalError("Failed to update chat", err)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": dbChatToResponse(chat)})
+}
+
+// DeleteChatHandler moves a chat to the trash, or permanently deletes a
+// chat that is already in the trash when ?permanent=true
+func (h *Handler) DeleteChatHandler(c *fiber.Ctx) error {
+	principal, ferr := currentPrincipal(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	chatID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid chat ID")
+	}
+
+	chat, ferr := h.authorizeChatInTrash(c, principal, authz.ActionDelete, chatID)
+	if ferr != nil {
+		return ferr
+	}
+
+	if c.QueryBool("permanent") {
+		if chat.DeletedAt == nil {
+			return fiber.NewError(fiber.StatusConflict, "Move the chat to the trash before deleting it permanently")
+		}
+		if err := h.db.PurgeChat(c.UserContext(), chat.ID); err != nil {
+			return internalError("Failed to delete chat", err)
+		}
+		return c.JSON(fiber.Map{"success": true, "message": "Chat permanently deleted"})
+	}
+
+	if err := h.db.SoftDeleteChat(c.UserContext(), chat.ID); err != nil {
+		return internalError("Failed to delete chat", err)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Chat moved to trash"})
+}
+
+// RestoreChatHandler takes a chat out of the trash
+func (h *Handler) RestoreChatHandler(c *fiber.Ctx) error {
+	principal, ferr := currentPrincipal(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	chatID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid chat ID")
+	}
+
+	chat, ferr := h.authorizeChatInTrash(c, principal, authz.ActionDelete, chatID)
+	if ferr != nil {
+		return ferr
+	}
+
+	if chat.DeletedAt == nil {
+		return fiber.NewError(fiber.StatusConflict, "Chat is not in the trash")
+	}
+
+	if err := h.db.RestoreChat(c.UserContext(), chat.ID); err != nil {
+		return internalError("Failed to restore chat", err)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Chat restored"})
+}
+
+// chatFilterFromQuery builds a listing filter from the archived, pinned and
+// trashed query parameters
+func chatFilterFromQuery(c *fiber.Ctx) (database.ChatFilter, error) {
+	var filter database.ChatFilter
+	filter.Trashed = c.QueryBool("trashed")
+
+	switch c.Query("archived") {
+	case "":
+		// Archived chats are hidden from the default listing, but not from the trash
+		if !filter.Trashed {
+			archived := false
+			filter.Archived = &archived
+		}
+	case "all":
+	case "true", "false":
+		archived := c.QueryBool("archived")
+		filter.Archived = &archived
+	default:
+		return filter, fiber.NewError(fiber.StatusBadRequest, "archived must be true, false or all")
+	}
+
+	switch c.Query("pinned") {
+	case "":
+	case "true", "false":
+		pinned := c.QueryBool("pinned")
+		filter.Pinned = &pinned
+	default:
+		return filter, fiber.NewError(fiber.StatusBadRequest, "pinned must be true or false")
+	}
+
+	return filter, nil
+}
+
 func dbChatToResponse(chat *database.Chat) ChatResponse {
-	return ChatResponse{
-		ID:        chat.ID,
-		Title:     chat.Title,
-		UserID:    chat.UserID,
-		CreatedAt: chat.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
-		UpdatedAt: chat.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	resp := ChatResponse{
+		ID:              chat.ID,
+		Title:           chat.Title,
+		UserID:          chat.UserID,
+		WorkspaceID:     chat.WorkspaceID,
+		ActiveMessageID: chat.ActiveMessageID,
+		Pinned:          chat.Pinned,
+		CreatedAt:       chat.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		UpdatedAt:       chat.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+	if chat.ArchivedAt != nil {
+		resp.ArchivedAt = chat.ArchivedAt.Format("2006-01-02T15:04:05Z07:00")
+	}
+	if chat.DeletedAt != nil {
+		resp.DeletedAt = chat.DeletedAt.Format("2006-01-02T15:04:05Z07:00")
+	}
+	return resp
+}
+
+func dbMessageToResponse(msg *database.Message) MessageResponse {
+	return MessageResponse{
+		ID:        msg.ID,
+		ChatID:    msg.ChatID,
+		ParentID:  msg.ParentID,
+		Role:      msg.Role,
+		Content:   msg.Content,
+		Language:  msg.Language,
+		Model:     msg.Model,
+		Mode:      msg.Mode,
+		Metadata:  msg.Metadata,
+		CreatedAt: msg.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
 	}
 }
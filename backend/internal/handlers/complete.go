@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"backend/internal/prompts"
+	"backend/internal/provider"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// maxCompletionPrefix and maxCompletionSuffix cap how much code around
+	// the cursor is sent to the model, in bytes. Longer input is cut at the
+	// far end from the cursor.
+	maxCompletionPrefix = 8000
+	maxCompletionSuffix = 2000
+	// maxCompletionCandidates caps how many completions one request may ask for
+	maxCompletionCandidates = 3
+	// maxStopSequences is the most stop sequences the model accepts
+	maxStopSequences = 5
+	// defaultCompletionTokens and maxCompletionTokens bound completion length
+	defaultCompletionTokens = 128
+	maxCompletionTokens     = 512
+	// completionTimeout bounds a completion request; editors discard late
+	// completions anyway
+	completionTimeout = 3 * time.Second
+	// completionCacheSize and completionCacheTTL bound the completion cache
+	completionCacheSize = 4096
+	completionCacheTTL  = 5 * time.Minute
+)
+
+type CompleteRequest struct {
+	Prefix     string   `json:"prefix"`
+	Suffix     string   `json:"suffix,omitempty"`
+	Language   string   `json:"language,omitempty" validate:"language"`
+	FilePath   string   `json:"filePath,omitempty" validate:"max=1024"`
+	Candidates int      `json:"candidates,omitempty" validate:"min=1,max=$maxCompletionCandidates"` // completions to return, default 1
+	Stop       []string `json:"stop,omitempty" validate:"max=$maxStopSequences"`                    // the completion ends before the first of these
+	MaxTokens  int      `json:"maxTokens,omitempty" validate:"min=1,max=$maxCompletionTokens"`
+}
+
+type CompleteResponse struct {
+	Completions []CompletionResponse `json:"completions"` // best first, empty when there is nothing to suggest
+	Model       string               `json:"model,omitempty"`
+	Cached      bool                 `json:"cached"`
+}
+
+type CompletionResponse struct {
+	Text string `json:"text"` // to be inserted at the cursor
+	Rank int    `json:"rank"` // 1 for the best completion
+}
+
+// cachedCompletion is a completion result kept in the completion cache
+type cachedCompletion struct {
+	texts []string
+	model string
+}
+
+// CompleteHandler returns inline completions for the cursor position
+// between prefix and suffix. Nothing is saved; identical requests of the
+// same user are answered from a short-lived cache.
+func (h *Handler) CompleteHandler(c *fiber.Ctx) error {
+	principal, ferr := currentPrincipal(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	var req CompleteRequest
+	if err := h.parseBody(c, &req); err != nil {
+		return err
+	}
+
+	if strings.TrimSpace(req.Prefix) == "" && strings.TrimSpace(req.Suffix) == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "prefix or suffix is required")
+	}
+
+	candidates := candidateCount(req.Candidates)
+
+	for _, stop := range req.Stop {
+		if stop == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "Stop sequences cannot be empty")
+		}
+	}
+
+	maxTokens := req.MaxTokens
+	if maxTokens == 0 {
+		maxTokens = defaultCompletionTokens
+	}
+
+	input := prompts.CompletionInput{
+		Prefix:   tailBytes(req.Prefix, maxCompletionPrefix),
+		Suffix:   headBytes(req.Suffix, maxCompletionSuffix),
+		Language: req.Language,
+		FilePath: req.FilePath,
+	}
+
+	key := completionKey(principal.UserID, input, req.Stop, candidates, maxTokens)
+	if cached, ok := h.completions.Get(key); ok {
+		return c.JSON(fiber.Map{"success": true, "data": completeResponse(cached, true)})
+	}
+
+	ctx, cancel := context.WithTimeout(c.UserContext(), completionTimeout)
+	defer cancel()
+
+	template := prompts.Completion(input)
+	start := time.Now()
+	resp, err := provider.GenerateCandidates(ctx, h.completer, provider.Request{
+		System:     template.System,
+		Prompt:     template.Prompt,
+		Candidates: candidates,
+		Stop:       req.Stop,
+		MaxTokens:  maxTokens,
+	})
+	switch {
+	case errors.Is(err, provider.ErrNoContent):
+		resp = &provider.Response{}
+	case err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return fiber.NewError(fiber.StatusGatewayTimeout, "Completion timed out")
+	case err != nil:
+		return providerError("Completion failed", err)
+	default:
+		h.observeGeneration(resp, input.Language, time.Since(start))
+	}
+
+	// Candidates keep the model's order, duplicates and empty ones are dropped
+	result := cachedCompletion{texts: []string{}, model: resp.Model}
+	seen := make(map[string]bool)
+	for _, text := range resp.Candidates {
+		text = prompts.CleanCompletion(text, input, req.Stop)
+		if text == "" || seen[text] {
+			continue
+		}
+		seen[text] = true
+		result.texts = append(result.texts, text)
+	}
+
+	h.completions.Add(key, result)
+
+	return c.JSON(fiber.Map{"success": true, "data": completeResponse(result, false)})
+}
+
+func completeResponse(result cachedCompletion, cached bool) CompleteResponse {
+	resp := CompleteResponse{Completions: []CompletionResponse{}, Model: result.model, Cached: cached}
+	for i, text := range result.texts {
+		resp.Completions = append(resp.Completions, CompletionResponse{Text: text, Rank: i + 1})
+	}
+	return resp
+}
+
+// completionKey identifies a completion request of a user in the cache
+func completionKey(userID int, input prompts.CompletionInput, stop []string, candidates, maxTokens int) string {
+	hash := sha256.New()
+	for _, part := range append([]string{input.Prefix, input.Suffix, input.Language, input.FilePath, strconv.Itoa(candidates), strconv.Itoa(maxTokens)}, stop...) {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	return strconv.Itoa(userID) + ":" + hex.EncodeToString(hash.Sum(nil))
+}
+
+// tailBytes returns at most the last n bytes of s, not splitting characters
+func tailBytes(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	s = s[len(s)-n:]
+	for len(s) > 0 && !utf8.RuneStart(s[0]) {
+		s = s[1:]
+	}
+	return s
+}
+
+// headBytes returns at most the first n bytes of s, not splitting characters
+func headBytes(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
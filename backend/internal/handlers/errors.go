@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"backend/internal/authz"
+	"backend/internal/database"
+	"backend/internal/logging"
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+// APIError is an error with a machine-readable code and optional details,
+// such as the fields that failed validation. Handlers return it, or a
+// *fiber.Error when the code derived from the status is specific enough.
+type APIError struct {
+	Status  int
+	Code    string
+	Message string // shown to clients
+	Details any
+	Err     error // cause, logged but not shown
+}
+
+func (e *APIError) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// NewAPIError returns an APIError with the given status, code and message
+func NewAPIError(status int, code, message string) *APIError {
+	return &APIError{Status: status, Code: code, Message: message}
+}
+
+// internalError reports a server failure with a message safe for clients,
+// keeping err for the log
+func internalError(message string, err error) error {
+	return &APIError{Status: fiber.StatusInternalServerError, Code: "internal_error", Message: message, Err: err}
+}
+
+// providerError reports a failed model call. The provider's own message
+// stays in the log.
+func providerError(message string, err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return &APIError{Status: fiber.StatusGatewayTimeout, Code: "timeout", Message: message + ": the model timed out", Err: err}
+	}
+	return &APIError{Status: fiber.StatusBadGateway, Code: "provider_error", Message: message, Err: err}
+}
+
+// ErrorBody is the error member of a failure response:
+//
+//	{"success": false, "error": {"code", "message", "details", "requestId"}}
+type ErrorBody struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Details   any    `json:"details,omitempty"`
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// ErrorHandler is the app's fiber.ErrorHandler. It writes every error
+// returned by a handler or middleware in the failure envelope. Database
+// and authorization errors are mapped by their sentinel, and unexpected errors are logged and
+// reported without their message so internals don't leak to clients.
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	apiErr := toAPIError(err)
+	if apiErr.Status >= fiber.StatusInternalServerError {
+		slog.ErrorContext(c.UserContext(), "Request failed", "method", c.Method(), "route", c.Route().Path, "error", err)
+	}
+
+	body := errorBody(apiErr)
+	body.RequestID = logging.RequestID(c.UserContext())
+	return c.Status(apiErr.Status).JSON(fiber.Map{"success": false, "error": body})
+}
+
+// toAPIError classifies err
+func toAPIError(err error) *APIError {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return NewAPIError(fiberErr.Code, statusCode(fiberErr.Code), fiberErr.Message)
+	}
+
+	switch {
+	case errors.Is(err, authz.ErrForbidden):
+		return NewAPIError(fiber.StatusForbidden, "forbidden", "Access denied")
+	case errors.Is(err, database.ErrNotFound):
+		return NewAPIError(fiber.StatusNotFound, "not_found", capitalize(err.Error()))
+	case errors.Is(err, database.ErrConflict):
+		return NewAPIError(fiber.StatusConflict, "conflict", capitalize(err.Error()))
+	case errors.Is(err, context.DeadlineExceeded):
+		return NewAPIError(fiber.StatusGatewayTimeout, "timeout", "The request timed out")
+	}
+	return NewAPIError(fiber.StatusInternalServerError, "internal_error", "Internal server error")
+}
+
+// errorBody returns the envelope member for err, without a request ID
+func errorBody(err *APIError) ErrorBody {
+	code := err.Code
+	if code == "" {
+		code = statusCode(err.Status)
+	}
+	return ErrorBody{Code: code, Message: err.Message, Details: err.Details}
+}
+
+// statusCode derives an error code from an HTTP status, e.g. "not_found"
+func statusCode(status int) string {
+	if status == fiber.StatusInternalServerError {
+		return "internal_error"
+	}
+	message := utils.StatusMessage(status)
+	if message == "" {
+		return "error"
+	}
+	return strings.ToLower(strings.NewReplacer(" ", "_", "-", "_", "'", "").Replace(message))
+}
+
+func capitalize(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	return string(unicode.ToUpper(r)) + s[size:]
+}
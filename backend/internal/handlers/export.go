@@ -0,0 +1,382 @@
+package handlers
+
+import (
+	"backend/internal/authz"
+	"backend/internal/database"
+	"backend/internal/prompts"
+	"backend/internal/validate"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// chatExportVersion identifies the JSON export format
+	chatExportVersion = 1
+	// maxImportMessages caps the size of an imported chat
+	maxImportMessages = 2000
+)
+
+// ChatExport is the JSON export format, which the import endpoint accepts back
+type ChatExport struct {
+	Version    int               `json:"version"`
+	ExportedAt string            `json:"exportedAt"`
+	Chat       ExportedChat      `json:"chat"`
+	Messages   []ExportedMessage `json:"messages"`
+}
+
+type ExportedChat struct {
+	Title     string `json:"title" validate:"max=200"`
+	CreatedAt string `json:"createdAt,omitempty"`
+}
+
+type ExportedMessage struct {
+	Role      string `json:"role"`
+	Content   string `json:"content"`
+	Language  string `json:"language,omitempty"`
+	Mode      string `json:"mode,omitempty"` // task mode, omitted in generate mode
+	Code      string `json:"code,omitempty"` // code a prompt gave to work on
+	CreatedAt string `json:"createdAt,omitempty"`
+}
+
+// ExportChatHandler downloads the active branch of a chat as Markdown
+// (the default), JSON or a standalone HTML page, selected with ?format=
+func (h *Handler) ExportChatHandler(c *fiber.Ctx) error {
+	principal, ferr := currentPrincipal(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	chatID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid chat ID")
+	}
+
+	chat, ferr := h.authorizeChat(c, principal, authz.ActionRead, chatID)
+	if ferr != nil {
+		return ferr
+	}
+
+	format := c.Query("format", "md")
+	if format != "md" && format != "json" && format != "html" {
+		return fiber.NewError(fiber.StatusBadRequest, "format must be md, json or html")
+	}
+
+	var messages []*database.Message
+	if chat.ActiveMessageID != nil {
+		messages, err = h.db.GetBranch(c.UserContext(), chat.ID, *chat.ActiveMessageID)
+		if err != nil {
+			return internalError("Failed to get messages", err)
+		}
+	}
+
+	export := dbChatToExport(chat, messages, time.Now())
+	c.Attachment(fmt.Sprintf("chat-%d.%s", chat.ID, format))
+
+	switch format {
+	case "json":
+		return c.JSON(export)
+	case "html":
+		var buf bytes.Buffer
+		if err := chatHTMLTemplate.Execute(&buf, export); err != nil {
+			return internalError("Failed to export chat", err)
+		}
+		c.Type("html", "utf-8")
+		return c.Send(buf.Bytes())
+	default:
+		c.Set(fiber.HeaderContentType, "text/markdown; charset=utf-8")
+		return c.SendString(chatToMarkdown(export))
+	}
+}
+
+// ImportChatHandler recreates a chat from our JSON export or from a common
+// chat log: {"messages": [{"role": ..., "content": ...}]} or a bare array of
+// such messages. The chat is personal unless ?workspaceId= is given.
+func (h *Handler) ImportChatHandler(c *fiber.Ctx) error {
+	principal, ferr := currentPrincipal(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	var workspaceID *int
+	if workspaceIDStr := c.Query("workspaceId"); workspaceIDStr != "" {
+		id, err := strconv.Atoi(workspaceIDStr)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid workspace ID")
+		}
+		// Creating a chat inside a workspace requires editor access
+		if err := h.policy.Workspace(c.UserContext(), principal, authz.ActionWrite, id); err != nil {
+			return err
+		}
+		workspaceID = &id
+	}
+
+	title, messages, ferr := h.parseChatImport(c.Body())
+	if ferr != nil {
+		return ferr
+	}
+
+	chat, err := h.db.ImportChat(c.UserContext(), principal.UserID, workspaceID, title, messages)
+	if err != nil {
+		return internalError("Failed to import chat", err)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": dbChatToResponse(chat)})
+}
+
+// chatImport covers both our export format and common chat logs
+type chatImport struct {
+	Chat     *ExportedChat   `json:"chat"`
+	Title    string          `json:"title" validate:"max=200"`
+	Messages []importMessage `json:"messages" validate:"max=$maxImportMessages"`
+}
+
+// importMessage is a message of an imported chat. Replies hold code, so
+// contents are bounded like code; prompts are also checked against the
+// prompt limit once their role is known.
+type importMessage struct {
+	Role      string         `json:"role"`
+	Content   messageContent `json:"content" validate:"max=$maxCode"`
+	Language  string         `json:"language" validate:"language"`
+	CreatedAt string         `json:"createdAt"`
+}
+
+// messageContent accepts content either as a string or as a list of
+// {"type": "text", "text": ...} parts
+type messageContent string
+
+func (mc *messageContent) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*mc = messageContent(text)
+		return nil
+	}
+
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(data, &parts); err != nil {
+		return fmt.Errorf("content must be a string or a list of text parts")
+	}
+
+	var texts []string
+	for _, part := range parts {
+		if part.Type == "text" {
+			texts = append(texts, part.Text)
+		}
+	}
+	*mc = messageContent(strings.Join(texts, "\n"))
+	return nil
+}
+
+func (h *Handler) parseChatImport(body []byte) (string, []database.ImportedMessage, error) {
+	var data chatImport
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		if err := json.Unmarshal(body, &data.Messages); err != nil {
+			return "", nil, fiber.NewError(fiber.StatusBadRequest, "Invalid chat import")
+		}
+	} else if err := json.Unmarshal(body, &data); err != nil {
+		return "", nil, fiber.NewError(fiber.StatusBadRequest, "Invalid chat import")
+	}
+
+	if err := h.validateRequest(&data); err != nil {
+		return "", nil, err
+	}
+
+	var messages []database.ImportedMessage
+	for i, msg := range data.Messages {
+		imported := database.ImportedMessage{
+			Content:  string(msg.Content),
+			Language: msg.Language,
+		}
+
+		switch msg.Role {
+		case "user":
+			imported.Role = "user"
+			if limit := h.limits.MaxPromptLength; utf8.RuneCountInString(imported.Content) > limit {
+				return "", nil, validationError(validate.Errors{{
+					Field:   fmt.Sprintf("messages[%d].content", i),
+					Rule:    "max",
+					Message: fmt.Sprintf("must be at most %d characters", limit),
+				}})
+			}
+		case "assistant":
+			imported.Role = "assistant"
+			// Chat logs keep code in markdown fences, while we store raw code
+			if imported.Language == "" && strings.HasPrefix(strings.TrimSpace(imported.Content), "```") {
+				imported.Language = fenceLanguage(imported.Content)
+				imported.Content = prompts.CleanCode(imported.Content)
+			}
+		case "system", "developer", "tool":
+			continue
+		default:
+			return "", nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Message %d has unsupported role %q", i+1, msg.Role))
+		}
+
+		if msg.CreatedAt != "" {
+			createdAt, err := time.Parse(time.RFC3339, msg.CreatedAt)
+			if err != nil {
+				return "", nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Message %d has an invalid createdAt", i+1))
+			}
+			imported.CreatedAt = &createdAt
+		}
+
+		messages = append(messages, imported)
+	}
+
+	if len(messages) == 0 {
+		return "", nil, fiber.NewError(fiber.StatusBadRequest, "Chat import has no messages")
+	}
+
+	title := data.Title
+	if data.Chat != nil && data.Chat.Title != "" {
+		title = data.Chat.Title
+	}
+	title = strings.TrimSpace(title)
+	if title == "" {
+		title = "Imported Chat"
+	}
+
+	return title, messages, nil
+}
+
+func dbChatToExport(chat *database.Chat, messages []*database.Message, now time.Time) ChatExport {
+	export := ChatExport{
+		Version:    chatExportVersion,
+		ExportedAt: now.Format("2006-01-02T15:04:05Z07:00"),
+		Chat: ExportedChat{
+			Title:     chat.Title,
+			CreatedAt: chat.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		},
+		Messages: []ExportedMessage{},
+	}
+	for _, msg := range messages {
+		exported := ExportedMessage{
+			Role:      msg.Role,
+			Content:   msg.Content,
+			Language:  msg.Language,
+			CreatedAt: msg.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		}
+		if msg.Mode != "" && msg.Mode != string(prompts.ModeGenerate) {
+			exported.Mode = msg.Mode
+		}
+		if msg.Role == "user" {
+			if _, input, err := messageTask(msg); err == nil {
+				exported.Code = input.Code
+			}
+		}
+		export.Messages = append(export.Messages, exported)
+	}
+	return export
+}
+
+// chatToMarkdown renders prompts as text followed by the code they gave,
+// and replies as fenced code blocks, or as they are in explain and review
+// mode, whose replies are markdown already
+func chatToMarkdown(export ChatExport) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", export.Chat.Title)
+	fmt.Fprintf(&b, "_Exported %s_\n", export.ExportedAt)
+
+	for _, msg := range export.Messages {
+		mode := prompts.Mode(msg.Mode)
+		if msg.Role == "user" {
+			heading := "Prompt"
+			if msg.Mode != "" {
+				heading += " · " + mode.Label()
+			}
+			fmt.Fprintf(&b, "\n## %s\n", heading)
+			if msg.Content != "" {
+				fmt.Fprintf(&b, "\n%s\n", msg.Content)
+			}
+			if msg.Code != "" {
+				writeCodeBlock(&b, msg.Code, msg.Language)
+			}
+			continue
+		}
+
+		b.WriteString("\n## Response\n")
+		if mode.Markdown() {
+			fmt.Fprintf(&b, "\n%s\n", msg.Content)
+		} else {
+			writeCodeBlock(&b, msg.Content, msg.Language)
+		}
+	}
+
+	return b.String()
+}
+
+// writeCodeBlock writes code as a fenced block preceded by a blank line
+func writeCodeBlock(b *strings.Builder, code, language string) {
+	fence := codeFence(code)
+	fmt.Fprintf(b, "\n%s%s\n%s\n%s\n", fence, fenceTag(language), code, fence)
+}
+
+// codeFence returns a backtick fence longer than any backtick run in content,
+// so code containing fences of its own doesn't end the block early
+func codeFence(content string) string {
+	longest, run := 0, 0
+	for _, r := range content {
+		if r == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	return strings.Repeat("`", max(3, longest+1))
+}
+
+// fenceTag turns a message language into a fence info string
+func fenceTag(language string) string {
+	return strings.ToLower(strings.Join(strings.Fields(language), ""))
+}
+
+// fenceLanguage returns the info string of the fence content starts with
+func fenceLanguage(content string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(content), "\n")
+	return strings.TrimSpace(strings.TrimLeft(line, "`"))
+}
+
+var chatHTMLTemplate = template.Must(template.New("chat").Funcs(template.FuncMap{
+	"fenceTag":  fenceTag,
+	"modeLabel": func(mode string) string { return prompts.Mode(mode).Label() },
+	"markdown":  func(mode string) bool { return prompts.Mode(mode).Markdown() },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Chat.Title}}</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 860px; margin: 2rem auto; padding: 0 1rem; color: #18181b; }
+.meta { color: #71717a; font-size: 0.875rem; }
+.message { margin: 1.5rem 0; }
+.role { font-weight: 600; font-size: 0.875rem; text-transform: uppercase; color: #52525b; }
+.prompt, .prose { white-space: pre-wrap; }
+pre { background: #18181b; color: #f4f4f5; padding: 1rem; border-radius: 0.5rem; overflow-x: auto; }
+</style>
+</head>
+<body>
+<h1>{{.Chat.Title}}</h1>
+<p class="meta">Exported {{.ExportedAt}}</p>
+{{range .Messages}}<div class="message">
+{{if eq .Role "user"}}<div class="role">Prompt{{with .Mode}} &middot; {{modeLabel .}}{{end}}</div>
+{{if .Content}}<p class="prompt">{{.Content}}</p>
+{{end}}{{if .Code}}<pre><code{{if .Language}} class="language-{{fenceTag .Language}}"{{end}}>{{.Code}}</code></pre>
+{{end}}{{else if markdown .Mode}}<div class="role">Response</div>
+<div class="prose">{{.Content}}</div>
+{{else}}<div class="role">Response{{if .Language}} &middot; {{.Language}}{{end}}</div>
+<pre><code{{if .Language}} class="language-{{fenceTag .Language}}"{{end}}>{{.Content}}</code></pre>
+{{end}}</div>
+{{end}}</body>
+</html>
+`))
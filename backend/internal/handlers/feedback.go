@@ -0,0 +1,272 @@
+package handlers
+
+import (
+	"backend/internal/authz"
+	"backend/internal/database"
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxFeedbackCommentLength caps feedback comments, in characters
+const maxFeedbackCommentLength = 2000
+
+// feedbackCategories are the reasons a response can be rated down for
+var feedbackCategories = []string{"wrong", "doesnt_compile", "insecure", "off_topic"}
+
+type FeedbackRequest struct {
+	Rating   string `json:"rating" validate:"required,oneof=up down"`
+	Category string `json:"category,omitempty" validate:"oneof=$feedbackCategories"` // only with "down"
+	Comment  string `json:"comment,omitempty" validate:"max=$maxFeedbackComment"`
+}
+
+type FeedbackResponse struct {
+	Rating    string `json:"rating"`
+	Category  string `json:"category,omitempty"`
+	Comment   string `json:"comment,omitempty"`
+	UpdatedAt string `json:"updatedAt"`
+}
+
+type FeedbackStatsResponse struct {
+	Language   string         `json:"language"`
+	Model      string         `json:"model"`
+	Total      int            `json:"total"`
+	Up         int            `json:"up"`
+	Down       int            `json:"down"`
+	Approval   float64        `json:"approval"` // share of thumbs up, 0 to 1
+	Categories map[string]int `json:"categories"`
+}
+
+// FeedbackExampleLine is one line of the training-data export
+type FeedbackExampleLine struct {
+	MessageID int    `json:"messageId"`
+	Prompt    string `json:"prompt"`
+	Response  string `json:"response"`
+	Language  string `json:"language,omitempty"`
+	Model     string `json:"model,omitempty"`
+	Rating    string `json:"rating"`
+	Category  string `json:"category,omitempty"`
+	Comment   string `json:"comment,omitempty"`
+	RatedAt   string `json:"ratedAt"`
+}
+
+// SetFeedbackHandler rates an assistant message up or down, replacing the
+// user's previous rating of it
+func (h *Handler) SetFeedbackHandler(c *fiber.Ctx) error {
+	principal, ferr := currentPrincipal(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	message, ferr := h.ratedMessage(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	// Anyone who can read the chat can rate its responses
+	if _, ferr := h.authorizeChat(c, principal, authz.ActionRead, message.ChatID); ferr != nil {
+		return ferr
+	}
+
+	var req FeedbackRequest
+	if err := h.parseBody(c, &req); err != nil {
+		return err
+	}
+
+	rating, err := parseRating(req.Rating)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Rating must be up or down")
+	}
+
+	if req.Category != "" && rating > 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "Only negative feedback can have a category")
+	}
+
+	feedback, err := h.db.SetMessageFeedback(c.UserContext(), message.ID, principal.UserID, rating, req.Category, req.Comment)
+	if err != nil {
+		return internalError("Failed to save feedback", err)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": dbFeedbackToResponse(feedback)})
+}
+
+// DeleteFeedbackHandler removes the user's rating of a message
+func (h *Handler) DeleteFeedbackHandler(c *fiber.Ctx) error {
+	principal, ferr := currentPrincipal(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	message, ferr := h.ratedMessage(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	if err := h.db.DeleteMessageFeedback(c.UserContext(), message.ID, principal.UserID); err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Feedback removed"})
+}
+
+// AdminFeedbackStatsHandler returns rating counts per language and model,
+// optionally limited to ratings given between ?from= and ?to=
+func (h *Handler) AdminFeedbackStatsHandler(c *fiber.Ctx) error {
+	filter, ferr := feedbackFilterFromQuery(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	stats, err := h.db.GetFeedbackStats(c.UserContext(), filter)
+	if err != nil {
+		return internalError("Failed to get feedback stats", err)
+	}
+
+	resp := []FeedbackStatsResponse{}
+	for _, s := range stats {
+		total := s.Up + s.Down
+		resp = append(resp, FeedbackStatsResponse{
+			Language:   s.Language,
+			Model:      s.Model,
+			Total:      total,
+			Up:         s.Up,
+			Down:       s.Down,
+			Approval:   float64(s.Up) / float64(total),
+			Categories: s.Categories,
+		})
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": resp})
+}
+
+// AdminExportFeedbackHandler downloads rated prompt/response pairs as JSON
+// Lines for evaluation or fine-tuning. ?rating=up|down, ?from= and ?to= filter.
+func (h *Handler) AdminExportFeedbackHandler(c *fiber.Ctx) error {
+	filter, ferr := feedbackFilterFromQuery(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	if ratingStr := c.Query("rating"); ratingStr != "" {
+		rating, err := parseRating(ratingStr)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "rating must be up or down")
+		}
+		filter.Rating = rating
+	}
+
+	c.Attachment("feedback.jsonl")
+	c.Set(fiber.HeaderContentType, "application/x-ndjson")
+
+	w := bufio.NewWriter(c)
+	enc := json.NewEncoder(w)
+	err := h.db.ExportFeedback(c.UserContext(), filter, func(example *database.FeedbackExample) error {
+		return enc.Encode(FeedbackExampleLine{
+			MessageID: example.MessageID,
+			Prompt:    example.Prompt,
+			Response:  example.Response,
+			Language:  example.Language,
+			Model:     example.Model,
+			Rating:    ratingName(example.Rating),
+			Category:  example.Category,
+			Comment:   example.Comment,
+			RatedAt:   example.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		})
+	})
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		c.Response().ResetBody()
+		return internalError("Failed to export feedback", err)
+	}
+
+	return nil
+}
+
+// ratedMessage loads the assistant message named by the :id parameter
+func (h *Handler) ratedMessage(c *fiber.Ctx) (*database.Message, error) {
+	messageID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid message ID")
+	}
+
+	message, err := h.db.GetMessageByID(c.UserContext(), messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	if message.Role != "assistant" {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Only responses can be rated")
+	}
+
+	return message, nil
+}
+
+// withFeedback adds the user's own ratings to messages
+func (h *Handler) withFeedback(c *fiber.Ctx, userID int, messages []MessageResponse) error {
+	var ids []int
+	for _, msg := range messages {
+		if msg.Role == "assistant" {
+			ids = append(ids, msg.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	feedback, err := h.db.GetMessageFeedbackByUser(c.UserContext(), userID, ids)
+	if err != nil {
+		return internalError("Failed to get messages", err)
+	}
+
+	for i := range messages {
+		if f, ok := feedback[messages[i].ID]; ok {
+			resp := dbFeedbackToResponse(f)
+			messages[i].Feedback = &resp
+		}
+	}
+
+	return nil
+}
+
+func feedbackFilterFromQuery(c *fiber.Ctx) (database.FeedbackFilter, error) {
+	var filter database.FeedbackFilter
+	var err error
+	if filter.From, err = parseDateQuery(c.Query("from")); err != nil {
+		return filter, fiber.NewError(fiber.StatusBadRequest, "from must be a date (YYYY-MM-DD) or RFC 3339 timestamp")
+	}
+	if filter.To, err = parseDateQuery(c.Query("to")); err != nil {
+		return filter, fiber.NewError(fiber.StatusBadRequest, "to must be a date (YYYY-MM-DD) or RFC 3339 timestamp")
+	}
+	return filter, nil
+}
+
+func parseRating(rating string) (int, error) {
+	switch rating {
+	case "up":
+		return 1, nil
+	case "down":
+		return -1, nil
+	}
+	return 0, fmt.Errorf("invalid rating %q", rating)
+}
+
+func ratingName(rating int) string {
+	if rating > 0 {
+		return "up"
+	}
+	return "down"
+}
+
+func dbFeedbackToResponse(feedback *database.MessageFeedback) FeedbackResponse {
+	return FeedbackResponse{
+		Rating:    ratingName(feedback.Rating),
+		Category:  feedback.Category,
+		Comment:   feedback.Comment,
+		UpdatedAt: feedback.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+}
@@ -1,117 +1,427 @@
 package handlers
 
 import (
+	"backend/internal/auth"
+	"backend/internal/authz"
+	"backend/internal/database"
+	"backend/internal/prompts"
+	"backend/internal/provider"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
 	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/google/generative-ai-go/genai"
-	"google.golang.org/api/option"
+)
+
+const (
+	// maxHistoryMessages caps how many earlier messages of the branch are
+	// sent to the model as context
+	maxHistoryMessages = 20
+	// maxCandidates caps how many alternative replies one request may ask for
+	maxCandidates = 4
 )
 
 type GenerateRequest struct {
-	ChatID   *int   `json:"chatId,omitempty"`
-	Prompt   string `json:"prompt"`
-	Language string `json:"language"`
+	ChatID          *int   `json:"chatId,omitempty"`
+	WorkspaceID     *int   `json:"workspaceId,omitempty"`                  // workspace for a new chat
+	Mode            string `json:"mode,omitempty" validate:"oneof=$modes"` // generate (default), explain, refactor, review, tests, translate or edit
+	Prompt          string `json:"prompt" validate:"max=$maxPrompt"`       // description, instruction or question
+	Language        string `json:"language" validate:"language"`
+	Code            string `json:"code,omitempty" validate:"max=$maxCode"`                   // code to work on, or context in generate mode
+	SourceMessageID *int   `json:"sourceMessageId,omitempty"`                                // reply to take the code from instead of code
+	TargetLanguage  string `json:"targetLanguage,omitempty" validate:"language"`             // translate only
+	Candidates      int    `json:"candidates,omitempty" validate:"min=1,max=$maxCandidates"` // alternative replies to generate, default 1
+	Ephemeral       bool   `json:"ephemeral,omitempty"`                                      // answer without saving a chat, the IDs in the response are 0
 }
 
 type GenerateResponse struct {
-	ChatID int    `json:"chatId"`
-	Code   string `json:"code"`
+	ChatID     int                 `json:"chatId"`
+	PromptID   int                 `json:"promptId"`  // the saved user message
+	MessageID  int                 `json:"messageId"` // the saved assistant reply, the first candidate
+	Mode       string              `json:"mode"`
+	Code       string              `json:"code"`                 // the code, or markdown for explain and review
+	Result     any                 `json:"result,omitempty"`     // structured reply, all modes but generate
+	Candidates []CandidateResponse `json:"candidates,omitempty"` // set when more than one was requested
+}
+
+type CandidateResponse struct {
+	MessageID int    `json:"messageId"`
+	Code      string `json:"code"`
+	Result    any    `json:"result,omitempty"`
 }
 
-// GenerateCodeHandler handles code generation requests using Gemini API.
+// GenerateCodeHandler handles code generation requests. The prompt is added
+// to the end of the chat's active branch, which is also sent as context.
 func (h *Handler) GenerateCodeHandler(c *fiber.Ctx) error {
-	userID := c.Locals("userID").(int)
+	task, ferr := h.prepareTask(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	resp, ferr := h.runTask(c.UserContext(), task, nil)
+	if ferr != nil {
+		return ferr
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": resp})
+}
+
+// generationTask is a validated generate request, with its prompt saved
+// unless it is ephemeral
+type generationTask struct {
+	mode       prompts.Mode
+	input      prompts.Input
+	candidates int
+	ephemeral  bool
+	history    []*database.Message // the branch the prompt continues
+	prompt     *database.Message   // nil when ephemeral
+	newChat    bool
+	title      string // provisional title of a new chat
+	request    string // summary of the task, for the title of a new chat
+}
+
+// prepareTask validates a generate request and saves its prompt, creating
+// a chat when the request doesn't continue one
+func (h *Handler) prepareTask(c *fiber.Ctx) (*generationTask, error) {
+	principal, ferr := currentPrincipal(c)
+	if ferr != nil {
+		return nil, ferr
+	}
 
 	var req GenerateRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"success": false, "message": "Invalid request body"})
+	if err := h.parseBody(c, &req); err != nil {
+		return nil, err
+	}
+
+	mode, err := prompts.ParseMode(req.Mode)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "mode must be one of: generate, explain, refactor, review, tests, translate, edit")
+	}
+
+	input := prompts.Input{
+		Prompt:         req.Prompt,
+		Language:       req.Language,
+		Code:           req.Code,
+		TargetLanguage: req.TargetLanguage,
+	}
+	if req.SourceMessageID != nil {
+		if ferr := h.sourceCode(c, principal, *req.SourceMessageID, &input); ferr != nil {
+			return nil, ferr
+		}
+	}
+	if err := validateInput(mode, input); err != nil {
+		return nil, err
+	}
+
+	metadata, err := inputMetadata(input)
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	task := &generationTask{mode: mode, input: input, candidates: candidateCount(req.Candidates)}
+
+	// Editor integrations ask one-off questions that don't belong in the
+	// chat history
+	if req.Ephemeral {
+		if req.ChatID != nil {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "Ephemeral requests cannot continue a chat")
+		}
+		task.ephemeral = true
+		return task, nil
 	}
 
 	// Create or get chat
-	var chatID int
-	var isNewChat bool
+	var chat *database.Chat
 	if req.ChatID != nil {
-		// Verify chat exists and belongs to user
-		chat, err := h.db.GetChatByID(c.Context(), *req.ChatID)
-		if err != nil || chat.UserID != userID {
-			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"success": false, "message": "Invalid chat ID"})
+		// Verify chat exists and the user may add messages to it
+		chat, ferr = h.authorizeChat(c, principal, authz.ActionWrite, *req.ChatID)
+		if ferr != nil {
+			return nil, ferr
 		}
-		chatID = *req.ChatID
-		isNewChat = false
 	} else {
+		// Creating a chat inside a workspace requires editor access
+		if req.WorkspaceID != nil {
+			if err := h.policy.Workspace(c.UserContext(), principal, authz.ActionWrite, *req.WorkspaceID); err != nil {
+				return nil, err
+			}
+		}
+
 		// Create new chat with a temporary title
-		chat, err := h.db.CreateChat(c.Context(), userID, "New Chat")
+		chat, err = h.db.CreateChat(c.UserContext(), principal.UserID, req.WorkspaceID, "New Chat")
 		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "message": "Failed to create chat"})
+			return nil, internalError("Failed to create chat", err)
+		}
+		task.newChat = true
+	}
+
+	// The prompt continues the active branch of the chat
+	if chat.ActiveMessageID != nil {
+		task.history, err = h.db.GetBranch(c.UserContext(), chat.ID, *chat.ActiveMessageID)
+		if err != nil {
+			return nil, internalError("Failed to get messages", err)
 		}
-		chatID = chat.ID
-		isNewChat = true
 	}
 
 	// Save user message
-	_, err := h.db.CreateMessage(c.Context(), chatID, "user", req.Prompt, req.Language)
+	task.prompt, err = h.db.CreateMessage(c.UserContext(), database.CreateMessageParams{
+		ChatID:   chat.ID,
+		ParentID: chat.ActiveMessageID,
+		Role:     "user",
+		Content:  req.Prompt,
+		Language: req.Language,
+		Mode:     string(mode),
+		Metadata: metadata,
+	})
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "message": "Failed to save message"})
+		return nil, internalError("Failed to save message", err)
 	}
 
-	// Update chat title with first prompt if it's a new chat
-	if isNewChat {
-		// Truncate prompt to 50 characters for the title
-		title := req.Prompt
-		if len(title) > 50 {
-			title = title[:50] + "..."
-		}
-		_ = h.db.UpdateChatTitle(c.Context(), chatID, title)
+	// Give a new chat a provisional title right away, the model is asked for
+	// a better one once the first exchange is complete
+	if task.newChat {
+		task.request = taskSummary(mode, input)
+		task.title = fallbackTitle(task.request)
+		_ = h.db.UpdateChatTitle(c.UserContext(), chat.ID, task.title)
+	}
+
+	return task, nil
+}
+
+// runTask generates the reply to a prepared task. onText, when set,
+// receives the reply's text while it is generated.
+func (h *Handler) runTask(ctx context.Context, task *generationTask, onText func(string) error) (*GenerateResponse, error) {
+	if task.ephemeral {
+		return h.answer(ctx, task.mode, task.input, task.candidates, onText)
+	}
+
+	resp, ferr := h.reply(ctx, task.history, task.prompt, task.candidates, onText)
+	if ferr != nil {
+		return nil, ferr
 	}
 
-	// Initialize Gemini client
-	apiKey := os.Getenv("GEMINI_API_KEY")
-	if apiKey == "" {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "message": "GEMINI_API_KEY not set"})
+	if task.newChat {
+		go h.generateTitle(ctx, resp.ChatID, task.title, task.request, resp.Code)
 	}
-	ctx := context.Background()
-	client, err := genai.NewClient(ctx, option.WithAPIKey(apiKey))
+	return resp, nil
+}
+
+// reply generates answers to prompt given the branch leading up to it and
+// saves them as the prompt's children, in the prompt's mode. With
+// several candidates the first one is made active, the others become
+// alternatives the user can switch to.
+func (h *Handler) reply(ctx context.Context, history []*database.Message, prompt *database.Message, candidates int, onText func(string) error) (*GenerateResponse, error) {
+	mode, input, err := messageTask(prompt)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "message": fmt.Sprintf("Failed to create Gemini client: %v", err)})
+		return nil, internalError("Failed to read prompt", err)
 	}
-	defer client.Close()
 
-	model := client.GenerativeModel("gemini-2.5-flash")
-	prompt := fmt.Sprintf("Generate %s code for: %s. Return ONLY the raw code. Do not include markdown formatting, backticks, or any explanations.", req.Language, req.Prompt)
-	respAI, err := model.GenerateContent(ctx, genai.Text(prompt))
+	results, model, err := h.generate(ctx, history, mode, input, candidates, onText)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "message": fmt.Sprintf("Gemini generation error: %v", err)})
+		return nil, providerError("Generation failed", err)
+	}
+
+	// Save AI responses
+	var answers []CandidateResponse
+	for _, result := range results {
+		language := prompt.Language
+		if result.Language != "" {
+			language = result.Language
+		}
+
+		var metadata []byte
+		if result.Data != nil {
+			if metadata, err = json.Marshal(result.Data); err != nil {
+				return nil, internalError("Failed to save AI response", err)
+			}
+		}
+
+		answer, err := h.db.CreateMessage(ctx, database.CreateMessageParams{
+			ChatID:   prompt.ChatID,
+			ParentID: &prompt.ID,
+			Role:     "assistant",
+			Content:  result.Content,
+			Language: language,
+			Model:    model,
+			Mode:     string(mode),
+			Metadata: metadata,
+		})
+		if err != nil {
+			return nil, internalError("Failed to save AI response", err)
+		}
+		answers = append(answers, CandidateResponse{MessageID: answer.ID, Code: result.Content, Result: result.Data})
 	}
-	if len(respAI.Candidates) == 0 || len(respAI.Candidates[0].Content.Parts) == 0 {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "message": "No content returned from Gemini"})
+
+	resp := GenerateResponse{
+		ChatID:    prompt.ChatID,
+		PromptID:  prompt.ID,
+		MessageID: answers[0].MessageID,
+		Mode:      string(mode),
+		Code:      answers[0].Code,
+		Result:    answers[0].Result,
 	}
-	generatedCode := fmt.Sprintf("%v", respAI.Candidates[0].Content.Parts[0])
 
-	// Clean up the output to ensure only code is returned
-	generatedCode = strings.TrimSpace(generatedCode)
-	// Remove markdown code block delimiters if present
-	if strings.HasPrefix(generatedCode, "```") {
-		// Find the first newline to remove the opening tag (e.g., ```python)
-		if newlineIdx := strings.Index(generatedCode, "\n"); newlineIdx != -1 {
-			generatedCode = generatedCode[newlineIdx+1:]
+	if len(answers) > 1 {
+		if err := h.db.SetActiveMessage(ctx, prompt.ChatID, answers[0].MessageID); err != nil {
+			return nil, internalError("Failed to save AI response", err)
 		}
+		resp.Candidates = answers
 	}
-	generatedCode = strings.TrimSuffix(generatedCode, "```")
-	generatedCode = strings.TrimSpace(generatedCode)
 
-	// Save AI response
-	_, err = h.db.CreateMessage(c.Context(), chatID, "assistant", generatedCode, req.Language)
+	return &resp, nil
+}
+
+// answer generates replies to a task without saving anything
+func (h *Handler) answer(ctx context.Context, mode prompts.Mode, input prompts.Input, candidates int, onText func(string) error) (*GenerateResponse, error) {
+	results, _, err := h.generate(ctx, nil, mode, input, candidates, onText)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"success": false, "message": "Failed to save AI response"})
+		return nil, providerError("Generation failed", err)
 	}
 
 	resp := GenerateResponse{
-		ChatID: chatID,
-		Code:   generatedCode,
+		Mode:   string(mode),
+		Code:   results[0].Content,
+		Result: results[0].Data,
 	}
-	return c.JSON(fiber.Map{"success": true, "data": resp})
+	if len(results) > 1 {
+		for _, result := range results {
+			resp.Candidates = append(resp.Candidates, CandidateResponse{Code: result.Content, Result: result.Data})
+		}
+	}
+
+	return &resp, nil
+}
+
+// candidateCount returns the number of requested candidates, 0 meaning 1.
+// The request's validate tags bound it.
+func candidateCount(n int) int {
+	if n == 0 {
+		return 1
+	}
+	return n
+}
+
+// generate asks the model to carry out a task, with the most recent
+// messages of history as conversation context. It returns one result per
+// candidate and the model that produced them. A single reply is streamed
+// to onText, when set, if the provider supports streaming.
+func (h *Handler) generate(ctx context.Context, history []*database.Message, mode prompts.Mode, input prompts.Input, candidates int, onText func(string) error) ([]*prompts.Result, string, error) {
+	if len(history) > maxHistoryMessages {
+		history = history[len(history)-maxHistoryMessages:]
+	}
+	turns := make([]provider.Turn, 0, len(history))
+	for _, msg := range history {
+		content := msg.Content
+		// Earlier prompts are sent as the model saw them, with their code
+		if msg.Role == "user" {
+			if m, in, err := messageTask(msg); err == nil {
+				content = prompts.Build(m, in).Prompt
+			}
+		}
+		turns = append(turns, provider.Turn{Role: msg.Role, Content: content})
+	}
+
+	template := prompts.Build(mode, input)
+	req := provider.Request{
+		System:     template.System,
+		History:    turns,
+		Prompt:     template.Prompt,
+		Candidates: candidates,
+		JSON:       template.JSON,
+	}
+
+	var resp *provider.Response
+	var err error
+	start := time.Now()
+	if streamer, ok := h.provider.(provider.Streamer); ok && onText != nil && candidates == 1 {
+		resp, err = streamer.GenerateStream(ctx, req, onText)
+	} else {
+		resp, err = provider.GenerateCandidates(ctx, h.provider, req)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	h.observeGeneration(resp, input.Language, time.Since(start))
+
+	results := make([]*prompts.Result, len(resp.Candidates))
+	for i, text := range resp.Candidates {
+		if results[i], err = prompts.Parse(mode, input, text); err != nil {
+			return nil, "", err
+		}
+	}
+	return results, resp.Model, nil
+}
+
+// sourceCode fills in the code of a task from an earlier reply the user can read
+func (h *Handler) sourceCode(c *fiber.Ctx, principal *auth.Principal, messageID int, input *prompts.Input) error {
+	if input.Code != "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Provide either code or sourceMessageId, not both")
+	}
+
+	message, err := h.db.GetMessageByID(c.UserContext(), messageID)
+	if errors.Is(err, database.ErrNotFound) {
+		return fiber.NewError(fiber.StatusNotFound, "Source message not found")
+	}
+	if err != nil {
+		return err
+	}
+	if message.Role != "assistant" {
+		return fiber.NewError(fiber.StatusBadRequest, "Source message must be a response")
+	}
+	if _, ferr := h.authorizeChat(c, principal, authz.ActionRead, message.ChatID); ferr != nil {
+		return ferr
+	}
+
+	input.Code = message.Content
+	input.SourceMessageID = &message.ID
+	if input.Language == "" {
+		input.Language = message.Language
+	}
+	return nil
+}
+
+// messageTask recovers the mode and input of a saved prompt
+func messageTask(msg *database.Message) (prompts.Mode, prompts.Input, error) {
+	input := prompts.Input{Prompt: msg.Content, Language: msg.Language}
+	mode, err := prompts.ParseMode(msg.Mode)
+	if err != nil {
+		return "", input, err
+	}
+	if len(msg.Metadata) > 0 {
+		if err := json.Unmarshal(msg.Metadata, &input); err != nil {
+			return "", input, err
+		}
+	}
+	return mode, input, nil
+}
+
+// inputMetadata encodes the parts of input that are stored as metadata, nil
+// when there are none
+func inputMetadata(input prompts.Input) ([]byte, error) {
+	if input.Code == "" && input.SourceMessageID == nil && input.TargetLanguage == "" {
+		return nil, nil
+	}
+	return json.Marshal(input)
+}
+
+// taskSummary describes a task in one line, for titles
+func taskSummary(mode prompts.Mode, input prompts.Input) string {
+	if mode == prompts.ModeGenerate {
+		return input.Prompt
+	}
+	subject := input.Prompt
+	if subject == "" {
+		for _, line := range strings.Split(input.Code, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				subject = line
+				break
+			}
+		}
+	}
+	if mode == prompts.ModeTranslate {
+		return fmt.Sprintf("%s to %s: %s", mode.Label(), input.TargetLanguage, subject)
+	}
+	return mode.Label() + ": " + subject
 }
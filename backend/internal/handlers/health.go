@@ -1,18 +1,38 @@
 package handlers
 
 import (
+	"backend/internal/authz"
+	"backend/internal/cache"
+	"backend/internal/config"
 	"backend/internal/database"
+	"backend/internal/provider"
+	"backend/internal/validate"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 type Handler struct {
-	db database.Service
+	db          database.Service
+	policy      *authz.Policy
+	provider    provider.Provider
+	completer   provider.Provider // used for inline completions
+	completions *cache.LRU[string, cachedCompletion]
+	validator   *validate.Validator
+	appURL      string // frontend URL links point to, none if empty
+	limits      config.Limits
 }
 
-func NewHandler(db database.Service) *Handler {
+func NewHandler(db database.Service, cfg *config.Config) *Handler {
 	return &Handler{
-		db: db,
+		db:          db,
+		policy:      authz.New(db),
+		provider:    provider.NewGemini(cfg.Provider.GeminiAPIKey, cfg.Provider.GenerationModel),
+		completer:   provider.NewGemini(cfg.Provider.GeminiAPIKey, cfg.Provider.CompletionModel),
+		completions: cache.NewLRU[string, cachedCompletion](completionCacheSize, completionCacheTTL),
+		validator:   newValidator(cfg.Limits),
+		appURL:      strings.TrimSuffix(cfg.Server.AppURL, "/"),
+		limits:      cfg.Limits,
 	}
 }
 
@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"backend/internal/metrics"
+	"backend/internal/provider"
+	"slices"
+	"strings"
+	"time"
+)
+
+// generationBuckets are the bounds, in seconds, of generation latency,
+// from inline completions to long multi-candidate replies
+var generationBuckets = []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 20, 30, 60, 120}
+
+// metricLanguages are the languages counted under their own name when
+// requests may use any language; others are counted as "other"
+var metricLanguages = []string{
+	"python", "javascript", "typescript", "java", "cpp", "csharp", "go", "rust",
+	"c", "kotlin", "swift", "php", "ruby", "scala", "sql", "shell", "bash", "html", "css",
+	"javascriptreact", "typescriptreact",
+}
+
+var (
+	generationDuration = metrics.NewHistogramVec("copilot_generation_duration_seconds",
+		"Time the model took to generate replies and completions, by model and language.", generationBuckets, "model", "language")
+	generationTokens = metrics.NewCounterVec("copilot_generation_tokens_total",
+		"Tokens consumed by generations, by model, language and direction (input or output).", "model", "language", "direction")
+	activeStreams = metrics.NewGauge("copilot_active_streams",
+		"Streamed generations in progress.")
+)
+
+// observeGeneration records the latency and token usage of a successful
+// generation
+func (h *Handler) observeGeneration(resp *provider.Response, language string, elapsed time.Duration) {
+	language = h.metricLanguage(language)
+	generationDuration.With(resp.Model, language).Observe(elapsed.Seconds())
+	generationTokens.With(resp.Model, language, "input").Add(float64(resp.Usage.InputTokens))
+	generationTokens.With(resp.Model, language, "output").Add(float64(resp.Usage.OutputTokens))
+}
+
+// metricLanguage bounds the language label: configured languages are
+// already limited by validation, otherwise only well-known ones are kept
+func (h *Handler) metricLanguage(language string) string {
+	language = strings.ToLower(strings.TrimSpace(language))
+	switch {
+	case language == "":
+		return "none"
+	case len(h.limits.Languages) > 0 || slices.Contains(metricLanguages, language):
+		return language
+	}
+	return "other"
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"backend/internal/database"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultChatPageSize    = 50
+	maxChatPageSize        = 100
+	defaultMessagePageSize = 100
+	maxMessagePageSize     = 500
+	defaultSnippetPageSize = 50
+	maxSnippetPageSize     = 100
+)
+
+// pageFromQuery reads the limit and cursor query parameters
+func pageFromQuery(c *fiber.Ctx, defaultLimit, maxLimit int) (database.Page, error) {
+	page := database.Page{Limit: c.QueryInt("limit", defaultLimit)}
+	if page.Limit <= 0 || page.Limit > maxLimit {
+		page.Limit = defaultLimit
+	}
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		after, err := database.DecodeCursor(cursor)
+		if err != nil {
+			return page, fiber.NewError(fiber.StatusBadRequest, "Invalid cursor")
+		}
+		page.After = after
+	}
+
+	return page, nil
+}
+
+// encodeCursor returns the nextCursor value for a response, empty on the last page
+func encodeCursor(cursor *database.Cursor) string {
+	if cursor == nil {
+		return ""
+	}
+	return cursor.Encode()
+}
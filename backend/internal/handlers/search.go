@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"backend/internal/authz"
+	"backend/internal/database"
+	"html"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 50
+	maxSearchQueryLen  = 200
+)
+
+type SearchMessageResponse struct {
+	ID        int    `json:"id"`
+	Role      string `json:"role"`
+	Language  string `json:"language,omitempty"`
+	CreatedAt string `json:"createdAt"`
+}
+
+type SearchResultResponse struct {
+	Type    string                 `json:"type"` // "message" or "chat"
+	Chat    ChatResponse           `json:"chat"`
+	Message *SearchMessageResponse `json:"message,omitempty"`
+	Snippet string                 `json:"snippet"` // HTML-escaped, matches wrapped in <mark>
+	Rank    float64                `json:"rank"`
+}
+
+// SearchHandler runs a full-text search over the chats and messages the
+// authenticated user can read
+func (h *Handler) SearchHandler(c *fiber.Ctx) error {
+	principal, ferr := currentPrincipal(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Query parameter q is required")
+	}
+	if len(query) > maxSearchQueryLen {
+		return fiber.NewError(fiber.StatusBadRequest, "Search query is too long")
+	}
+
+	filter := database.SearchFilter{
+		Query:    query,
+		UserID:   principal.UserID,
+		Language: c.Query("language"),
+		Role:     c.Query("role"),
+		Limit:    c.QueryInt("limit", defaultSearchLimit),
+	}
+	if filter.Limit <= 0 || filter.Limit > maxSearchLimit {
+		filter.Limit = defaultSearchLimit
+	}
+	if filter.Role != "" && filter.Role != "user" && filter.Role != "assistant" {
+		return fiber.NewError(fiber.StatusBadRequest, "role must be user or assistant")
+	}
+
+	var err error
+	if filter.From, err = parseDateQuery(c.Query("from")); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "from must be a date (YYYY-MM-DD) or RFC 3339 timestamp")
+	}
+	if filter.To, err = parseDateQuery(c.Query("to")); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "to must be a date (YYYY-MM-DD) or RFC 3339 timestamp")
+	}
+
+	if workspaceIDStr := c.Query("workspaceId"); workspaceIDStr != "" {
+		workspaceID, err := strconv.Atoi(workspaceIDStr)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid workspace ID")
+		}
+		if err := h.policy.Workspace(c.UserContext(), principal, authz.ActionRead, workspaceID); err != nil {
+			return err
+		}
+		filter.WorkspaceID = &workspaceID
+	}
+
+	results, err := h.db.Search(c.UserContext(), filter)
+	if err != nil {
+		return internalError("Search failed", err)
+	}
+
+	resp := []SearchResultResponse{}
+	for _, result := range results {
+		item := SearchResultResponse{
+			Type:    "chat",
+			Chat:    dbChatToResponse(result.Chat),
+			Snippet: highlightSnippet(result.Snippet),
+			Rank:    result.Rank,
+		}
+		if result.Message != nil {
+			item.Type = "message"
+			item.Message = &SearchMessageResponse{
+				ID:        result.Message.ID,
+				Role:      result.Message.Role,
+				Language:  result.Message.Language,
+				CreatedAt: result.Message.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+			}
+		}
+		resp = append(resp, item)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": resp})
+}
+
+// highlightSnippet HTML-escapes a snippet and turns the database highlight
+// markers into <mark> tags, so clients can render it safely
+func highlightSnippet(snippet string) string {
+	escaped := html.EscapeString(snippet)
+	escaped = strings.ReplaceAll(escaped, database.HighlightStart, "<mark>")
+	return strings.ReplaceAll(escaped, database.HighlightStop, "</mark>")
+}
+
+// parseDateQuery accepts either a plain date or an RFC 3339 timestamp
+func parseDateQuery(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
+	}
+	t = t.UTC()
+	return &t, nil
+}
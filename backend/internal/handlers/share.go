@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"backend/internal/authz"
+	"backend/internal/database"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// shareTokenBytes is the amount of randomness in a share link token
+	shareTokenBytes = 32
+	// shareTokenPrefixLength is how much of a token is kept to identify it
+	shareTokenPrefixLength = 6
+	// maxShareHours caps the lifetime of share links that expire: one year
+	maxShareHours = 365 * 24
+)
+
+type CreateShareRequest struct {
+	ExpiresInHours int `json:"expiresInHours,omitempty" validate:"min=1,max=$maxShareHours"` // 0 means the link never expires
+}
+
+// ShareResponse describes a share link. Token and URL are only returned
+// when the link is created, since only a hash of the token is stored.
+type ShareResponse struct {
+	ID        int    `json:"id"`
+	ChatID    int    `json:"chatId"`
+	Token     string `json:"token,omitempty"`
+	Prefix    string `json:"prefix"`
+	URL       string `json:"url,omitempty"`
+	Active    bool   `json:"active"`
+	ExpiresAt string `json:"expiresAt,omitempty"`
+	RevokedAt string `json:"revokedAt,omitempty"`
+	CreatedAt string `json:"createdAt"`
+}
+
+// CreateChatShareHandler creates a public read-only link to a chat
+func (h *Handler) CreateChatShareHandler(c *fiber.Ctx) error {
+	principal, ferr := currentPrincipal(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	chatID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid chat ID")
+	}
+
+	chat, ferr := h.authorizeChat(c, principal, authz.ActionShare, chatID)
+	if ferr != nil {
+		return ferr
+	}
+
+	// The body is optional
+	var req CreateShareRequest
+	if len(c.Body()) > 0 {
+		if err := h.parseBody(c, &req); err != nil {
+			return err
+		}
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresInHours > 0 {
+		t := time.Now().Add(time.Duration(req.ExpiresInHours) * time.Hour)
+		expiresAt = &t
+	}
+
+	token, err := newShareToken()
+	if err != nil {
+		return internalError("Failed to create share link", err)
+	}
+
+	share, err := h.db.CreateChatShare(c.UserContext(), chat.ID, principal.UserID, hashShareToken(token), token[:shareTokenPrefixLength], expiresAt)
+	if err != nil {
+		return internalError("Failed to create share link", err)
+	}
+
+	resp := dbShareToResponse(share)
+	resp.Token = token
+	if h.appURL != "" {
+		resp.URL = h.appURL + "/shared/" + token
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"success": true, "data": resp})
+}
+
+// GetChatSharesHandler lists the share links of a chat
+func (h *Handler) GetChatSharesHandler(c *fiber.Ctx) error {
+	principal, ferr := currentPrincipal(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	chatID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid chat ID")
+	}
+
+	chat, ferr := h.authorizeChat(c, principal, authz.ActionShare, chatID)
+	if ferr != nil {
+		return ferr
+	}
+
+	shares, err := h.db.GetChatSharesByChat(c.UserContext(), chat.ID)
+	if err != nil {
+		return internalError("Failed to get share links", err)
+	}
+
+	resp := []ShareResponse{}
+	for _, share := range shares {
+		resp = append(resp, dbShareToResponse(share))
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": resp})
+}
+
+// RevokeChatShareHandler disables a share link
+func (h *Handler) RevokeChatShareHandler(c *fiber.Ctx) error {
+	principal, ferr := currentPrincipal(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	chatID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid chat ID")
+	}
+
+	shareID, err := strconv.Atoi(c.Params("shareId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid share ID")
+	}
+
+	chat, ferr := h.authorizeChat(c, principal, authz.ActionShare, chatID)
+	if ferr != nil {
+		return ferr
+	}
+
+	if err := h.db.RevokeChatShare(c.UserContext(), chat.ID, shareID); err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Share link revoked"})
+}
+
+// GetSharedChatHandler returns the active branch of a shared chat without
+// authentication. Owner identifiers are stripped from the response.
+func (h *Handler) GetSharedChatHandler(c *fiber.Ctx) error {
+	errNotShared := fiber.NewError(fiber.StatusNotFound, "Shared chat not found")
+
+	share, err := h.db.GetChatShareByTokenHash(c.UserContext(), hashShareToken(c.Params("token")))
+	if errors.Is(err, database.ErrNotFound) {
+		return errNotShared
+	}
+	if err != nil {
+		return err
+	}
+	if !share.Active(time.Now()) {
+		return errNotShared
+	}
+
+	chat, err := h.db.GetChatByID(c.UserContext(), share.ChatID)
+	if errors.Is(err, database.ErrNotFound) {
+		return errNotShared
+	}
+	if err != nil {
+		return err
+	}
+	if chat.DeletedAt != nil {
+		return errNotShared
+	}
+
+	var messages []*database.Message
+	if chat.ActiveMessageID != nil {
+		messages, err = h.db.GetBranch(c.UserContext(), chat.ID, *chat.ActiveMessageID)
+		if err != nil {
+			return internalError("Failed to get messages", err)
+		}
+	}
+
+	resp := ChatWithMessagesResponse{
+		Chat:     dbChatToResponse(chat),
+		Messages: []MessageResponse{},
+	}
+	resp.Chat.UserID = 0
+	resp.Chat.WorkspaceID = nil
+	for _, msg := range messages {
+		resp.Messages = append(resp.Messages, dbMessageToResponse(msg))
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": resp})
+}
+
+// newShareToken returns an unguessable, URL-safe token
+func newShareToken() (string, error) {
+	b := make([]byte, shareTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashShareToken returns the value stored for a share link token
+func hashShareToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func dbShareToResponse(share *database.ChatShare) ShareResponse {
+	resp := ShareResponse{
+		ID:        share.ID,
+		ChatID:    share.ChatID,
+		Prefix:    share.TokenPrefix,
+		Active:    share.Active(time.Now()),
+		CreatedAt: share.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+	if share.ExpiresAt != nil {
+		resp.ExpiresAt = share.ExpiresAt.Format("2006-01-02T15:04:05Z07:00")
+	}
+	if share.RevokedAt != nil {
+		resp.RevokedAt = share.RevokedAt.Format("2006-01-02T15:04:05Z07:00")
+	}
+	return resp
+}
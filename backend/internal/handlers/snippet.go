@@ -0,0 +1,390 @@
+package handlers
+
+import (
+	"backend/internal/auth"
+	"backend/internal/authz"
+	"backend/internal/database"
+	"backend/internal/diff"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	maxSnippetNameLength = 200
+	maxSnippetTags       = 20
+	maxSnippetTagLength  = 50
+)
+
+type CreateSnippetRequest struct {
+	MessageID *int     `json:"messageId,omitempty"` // assistant message to save
+	Name      string   `json:"name" validate:"required,max=$maxSnippetName"`
+	Language  *string  `json:"language,omitempty" validate:"language"` // defaults to the message's language
+	Tags      []string `json:"tags,omitempty"`
+	Content   *string  `json:"content,omitempty" validate:"notblank,max=$maxCode"` // defaults to the message's content
+}
+
+type UpdateSnippetRequest struct {
+	Name      *string  `json:"name,omitempty" validate:"notblank,max=$maxSnippetName"`
+	Language  *string  `json:"language,omitempty" validate:"language"`
+	Tags      []string `json:"tags"`                                               // omitted keeps the tags, [] clears them
+	Content   *string  `json:"content,omitempty" validate:"notblank,max=$maxCode"` // saved as a new version when changed
+	MessageID *int     `json:"messageId,omitempty"`                                // assistant message the new content comes from
+}
+
+type SnippetResponse struct {
+	ID        int      `json:"id"`
+	MessageID *int     `json:"messageId,omitempty"`
+	Name      string   `json:"name"`
+	Language  string   `json:"language,omitempty"`
+	Tags      []string `json:"tags"`
+	Version   int      `json:"version"`
+	Content   string   `json:"content"`
+	CreatedAt string   `json:"createdAt"`
+	UpdatedAt string   `json:"updatedAt"`
+}
+
+type SnippetVersionResponse struct {
+	Version   int    `json:"version"`
+	Content   string `json:"content"`
+	MessageID *int   `json:"messageId,omitempty"`
+	CreatedAt string `json:"createdAt"`
+}
+
+type SnippetDiffResponse struct {
+	From int    `json:"from"`
+	To   int    `json:"to"`
+	Diff string `json:"diff"` // unified diff, empty when the versions are equal
+}
+
+// CreateSnippetHandler saves code as a snippet, either given directly or
+// taken from an assistant message the user can read
+func (h *Handler) CreateSnippetHandler(c *fiber.Ctx) error {
+	principal, ferr := currentPrincipal(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	var req CreateSnippetRequest
+	if err := h.parseBody(c, &req); err != nil {
+		return err
+	}
+
+	params := database.CreateSnippetParams{
+		UserID:    principal.UserID,
+		MessageID: req.MessageID,
+	}
+
+	if req.MessageID != nil {
+		message, ferr := h.snippetSource(c, principal, *req.MessageID)
+		if ferr != nil {
+			return ferr
+		}
+		params.Content = message.Content
+		params.Language = message.Language
+	} else if req.Content == nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Either messageId or content is required")
+	}
+
+	if req.Content != nil {
+		params.Content = *req.Content
+	}
+	if req.Language != nil {
+		params.Language = strings.TrimSpace(*req.Language)
+	}
+
+	if strings.TrimSpace(params.Content) == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Content cannot be empty")
+	}
+
+	params.Name = strings.TrimSpace(req.Name)
+
+	params.Tags, ferr = normalizeTags(req.Tags)
+	if ferr != nil {
+		return ferr
+	}
+
+	snippet, err := h.db.CreateSnippet(c.UserContext(), params)
+	if err != nil {
+		return internalError("Failed to create snippet", err)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": dbSnippetToResponse(snippet)})
+}
+
+// GetSnippetsHandler lists the user's snippets. ?q= searches names and
+// content, ?tag= and ?language= filter, and ?limit= and ?cursor= paginate.
+func (h *Handler) GetSnippetsHandler(c *fiber.Ctx) error {
+	principal, ferr := currentPrincipal(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	page, ferr := pageFromQuery(c, defaultSnippetPageSize, maxSnippetPageSize)
+	if ferr != nil {
+		return ferr
+	}
+
+	filter := database.SnippetFilter{
+		Query:    strings.TrimSpace(c.Query("q")),
+		Tag:      strings.ToLower(strings.TrimSpace(c.Query("tag"))),
+		Language: c.Query("language"),
+	}
+
+	snippets, next, err := h.db.GetSnippetsByUser(c.UserContext(), principal.UserID, filter, page)
+	if err != nil {
+		return internalError("Failed to get snippets", err)
+	}
+
+	resp := []SnippetResponse{}
+	for _, snippet := range snippets {
+		resp = append(resp, dbSnippetToResponse(snippet))
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": resp, "nextCursor": encodeCursor(next)})
+}
+
+// GetSnippetHandler returns a snippet with the content of its current version
+func (h *Handler) GetSnippetHandler(c *fiber.Ctx) error {
+	principal, ferr := currentPrincipal(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	snippet, ferr := h.authorizeSnippet(c, principal, authz.ActionRead)
+	if ferr != nil {
+		return ferr
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": dbSnippetToResponse(snippet)})
+}
+
+// UpdateSnippetHandler renames, retags or edits a snippet. Changed content
+// is saved as a new version, keeping the previous ones.
+func (h *Handler) UpdateSnippetHandler(c *fiber.Ctx) error {
+	principal, ferr := currentPrincipal(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	snippet, ferr := h.authorizeSnippet(c, principal, authz.ActionWrite)
+	if ferr != nil {
+		return ferr
+	}
+
+	var req UpdateSnippetRequest
+	if err := h.parseBody(c, &req); err != nil {
+		return err
+	}
+
+	update := database.SnippetUpdate{
+		Language:  req.Language,
+		Content:   req.Content,
+		MessageID: req.MessageID,
+	}
+
+	if req.MessageID != nil {
+		message, ferr := h.snippetSource(c, principal, *req.MessageID)
+		if ferr != nil {
+			return ferr
+		}
+		if update.Content == nil {
+			update.Content = &message.Content
+		}
+	}
+
+	if update.Content != nil && strings.TrimSpace(*update.Content) == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "Content cannot be empty")
+	}
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		update.Name = &name
+	}
+
+	if req.Tags != nil {
+		tags, ferr := normalizeTags(req.Tags)
+		if ferr != nil {
+			return ferr
+		}
+		update.Tags = tags
+	}
+
+	snippet, err := h.db.UpdateSnippet(c.UserContext(), snippet.ID, update)
+	if err != nil {
+		return internalError("Failed to update snippet", err)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": dbSnippetToResponse(snippet)})
+}
+
+// DeleteSnippetHandler deletes a snippet and all of its versions
+func (h *Handler) DeleteSnippetHandler(c *fiber.Ctx) error {
+	principal, ferr := currentPrincipal(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	snippet, ferr := h.authorizeSnippet(c, principal, authz.ActionDelete)
+	if ferr != nil {
+		return ferr
+	}
+
+	if err := h.db.DeleteSnippet(c.UserContext(), snippet.ID); err != nil {
+		return internalError("Failed to delete snippet", err)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Snippet deleted"})
+}
+
+// GetSnippetVersionsHandler returns the version history of a snippet, newest first
+func (h *Handler) GetSnippetVersionsHandler(c *fiber.Ctx) error {
+	principal, ferr := currentPrincipal(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	snippet, ferr := h.authorizeSnippet(c, principal, authz.ActionRead)
+	if ferr != nil {
+		return ferr
+	}
+
+	versions, err := h.db.GetSnippetVersions(c.UserContext(), snippet.ID)
+	if err != nil {
+		return internalError("Failed to get snippet versions", err)
+	}
+
+	resp := []SnippetVersionResponse{}
+	for _, version := range versions {
+		resp = append(resp, dbSnippetVersionToResponse(version))
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": resp})
+}
+
+// GetSnippetDiffHandler returns the unified diff between two versions of a
+// snippet. ?to= defaults to the current version and ?from= to the one before.
+func (h *Handler) GetSnippetDiffHandler(c *fiber.Ctx) error {
+	principal, ferr := currentPrincipal(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	snippet, ferr := h.authorizeSnippet(c, principal, authz.ActionRead)
+	if ferr != nil {
+		return ferr
+	}
+
+	to := c.QueryInt("to", snippet.Version)
+	from := c.QueryInt("from", to-1)
+	if from < 1 || to < 1 || from > snippet.Version || to > snippet.Version {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Versions must be between 1 and %d", snippet.Version))
+	}
+
+	fromVersion, err := h.db.GetSnippetVersion(c.UserContext(), snippet.ID, from)
+	if err != nil {
+		return err
+	}
+	toVersion, err := h.db.GetSnippetVersion(c.UserContext(), snippet.ID, to)
+	if err != nil {
+		return err
+	}
+
+	resp := SnippetDiffResponse{
+		From: from,
+		To:   to,
+		Diff: diff.Unified(fmt.Sprintf("%s@v%d", snippet.Name, from), fmt.Sprintf("%s@v%d", snippet.Name, to), fromVersion.Content, toVersion.Content),
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": resp})
+}
+
+// authorizeSnippet loads the snippet named by the :id parameter and checks
+// that principal may perform action on it
+func (h *Handler) authorizeSnippet(c *fiber.Ctx, principal *auth.Principal, action authz.Action) (*database.Snippet, error) {
+	snippetID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid snippet ID")
+	}
+
+	snippet, err := h.db.GetSnippetByID(c.UserContext(), snippetID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := h.policy.Snippet(c.UserContext(), principal, action, snippet); err != nil {
+		return nil, err
+	}
+
+	return snippet, nil
+}
+
+// snippetSource loads an assistant message to save as a snippet, checking
+// that principal can read its chat
+func (h *Handler) snippetSource(c *fiber.Ctx, principal *auth.Principal, messageID int) (*database.Message, error) {
+	message, err := h.db.GetMessageByID(c.UserContext(), messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ferr := h.authorizeChat(c, principal, authz.ActionRead, message.ChatID); ferr != nil {
+		return nil, ferr
+	}
+
+	if message.Role != "assistant" {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Only responses can be saved as snippets")
+	}
+
+	return message, nil
+}
+
+// normalizeTags lowercases and deduplicates tags, dropping empty ones
+func normalizeTags(tags []string) ([]string, error) {
+	normalized := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || slices.Contains(normalized, tag) {
+			continue
+		}
+		if len([]rune(tag)) > maxSnippetTagLength {
+			return nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Tags must be at most %d characters", maxSnippetTagLength))
+		}
+		normalized = append(normalized, tag)
+	}
+
+	if len(normalized) > maxSnippetTags {
+		return nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("A snippet can have at most %d tags", maxSnippetTags))
+	}
+
+	return normalized, nil
+}
+
+func dbSnippetToResponse(snippet *database.Snippet) SnippetResponse {
+	tags := snippet.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	return SnippetResponse{
+		ID:        snippet.ID,
+		MessageID: snippet.MessageID,
+		Name:      snippet.Name,
+		Language:  snippet.Language,
+		Tags:      tags,
+		Version:   snippet.Version,
+		Content:   snippet.Content,
+		CreatedAt: snippet.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		UpdatedAt: snippet.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+}
+
+func dbSnippetVersionToResponse(version *database.SnippetVersion) SnippetVersionResponse {
+	return SnippetVersionResponse{
+		Version:   version.Version,
+		Content:   version.Content,
+		MessageID: version.MessageID,
+		CreatedAt: version.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"backend/internal/logging"
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// streamTimeout bounds a streamed generation, which outlives the handler
+const streamTimeout = 5 * time.Minute
+
+// GenerateStreamHandler handles the same requests as GenerateCodeHandler,
+// but answers with server-sent events. "chunk" events carry the reply's
+// text as it is generated ({"text": ...}), raw model output that is JSON in
+// all modes but generate. A final "done" event carries the GenerateResponse,
+// or an "error" event reports a failure with the error member of the
+// failure envelope and the status the response would have had.
+func (h *Handler) GenerateStreamHandler(c *fiber.Ctx) error {
+	task, ferr := h.prepareTask(c)
+	if ferr != nil {
+		return ferr
+	}
+	if task.candidates > 1 {
+		return fiber.NewError(fiber.StatusBadRequest, "Streaming supports a single candidate")
+	}
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	// The writer runs after the handler has returned, so it must not use c.
+	// Its context keeps the request ID for logging.
+	requestCtx := c.UserContext()
+	requestID := logging.RequestID(requestCtx)
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(requestCtx), streamTimeout)
+		defer cancel()
+
+		activeStreams.Inc()
+		defer activeStreams.Dec()
+
+		resp, err := h.runTask(ctx, task, func(text string) error {
+			// A failed write means the client went away
+			return writeEvent(w, "chunk", fiber.Map{"text": text})
+		})
+		if err != nil {
+			apiErr := toAPIError(err)
+			if apiErr.Status >= fiber.StatusInternalServerError {
+				slog.ErrorContext(ctx, "Streamed generation failed", "error", err)
+			}
+			body := errorBody(apiErr)
+			body.RequestID = requestID
+			_ = writeEvent(w, "error", streamError{Status: apiErr.Status, ErrorBody: body})
+			return
+		}
+		_ = writeEvent(w, "done", resp)
+	})
+
+	return nil
+}
+
+// streamError is the payload of an "error" event
+type streamError struct {
+	Status int `json:"status"`
+	ErrorBody
+}
+
+// writeEvent sends a server-sent event with a JSON payload
+func writeEvent(w *bufio.Writer, event string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload); err != nil {
+		return err
+	}
+	return w.Flush()
+}
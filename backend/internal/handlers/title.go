@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"backend/internal/provider"
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+const (
+	// maxTitleRunes caps the length of chat titles, in characters
+	maxTitleRunes = 50
+	// maxTitleContextRunes caps how much of the first reply is sent when
+	// asking the model for a title
+	maxTitleContextRunes = 2000
+	// titleTimeout bounds background title generation
+	titleTimeout = 30 * time.Second
+)
+
+// fallbackTitle derives a title from the first prompt, truncated to
+// maxTitleRunes characters without splitting multi-byte characters
+func fallbackTitle(prompt string) string {
+	title := strings.Join(strings.Fields(prompt), " ")
+	if title == "" {
+		return "New Chat"
+	}
+	return truncateRunes(title, maxTitleRunes)
+}
+
+// truncateRunes shortens s to at most n characters, marking the cut with "..."
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return strings.TrimSpace(string(runes[:n])) + "..."
+}
+
+// generateTitle asks the model for a short title summarizing the first
+// exchange of a chat and replaces the provisional title with it. It runs in
+// the background after the response has been sent; on failure, or when the
+// chat was renamed in the meantime, the current title is kept.
+func (h *Handler) generateTitle(ctx context.Context, chatID int, provisional, prompt, answer string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), titleTimeout)
+	defer cancel()
+
+	resp, err := h.provider.Generate(ctx, provider.Request{
+		System: "You name conversations between a developer and a coding assistant. " +
+			"Reply with a title of at most six words describing the task. " +
+			"Do not use quotes, punctuation at the end, or markdown.",
+		Prompt: fmt.Sprintf("Request:\n%s\n\nResponse:\n%s", prompt, truncateRunes(answer, maxTitleContextRunes)),
+	})
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to generate chat title", "chat_id", chatID, "error", err)
+		return
+	}
+
+	title := cleanTitle(resp.Text())
+	if title == "" {
+		return
+	}
+
+	chat, err := h.db.GetChatByID(ctx, chatID)
+	if err != nil || chat.Title != provisional {
+		return
+	}
+
+	if err := h.db.UpdateChatTitle(ctx, chatID, title); err != nil {
+		slog.ErrorContext(ctx, "Failed to update chat title", "chat_id", chatID, "error", err)
+	}
+}
+
+// cleanTitle keeps the first line of a model-written title and strips the
+// decoration models tend to add despite being told not to
+func cleanTitle(text string) string {
+	title, _, _ := strings.Cut(strings.TrimSpace(text), "\n")
+	title = strings.TrimPrefix(strings.TrimSpace(title), "Title:")
+	title = strings.Trim(title, " \t\"'`*#.")
+	title = strings.Join(strings.Fields(title), " ")
+	if title == "" {
+		return ""
+	}
+	return truncateRunes(title, maxTitleRunes)
+}
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"backend/internal/auth"
+	"backend/internal/database"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// maxAccessTokenNameLength caps the length of access token names, in characters
+	maxAccessTokenNameLength = 100
+	// maxAccessTokenDays caps the lifetime of access tokens that expire
+	maxAccessTokenDays = 365
+)
+
+type CreateAccessTokenRequest struct {
+	Name          string `json:"name" validate:"required,max=$maxAccessTokenName"`
+	ExpiresInDays int    `json:"expiresInDays,omitempty" validate:"min=1,max=$maxAccessTokenDays"` // 0 means the token never expires
+}
+
+type AccessTokenResponse struct {
+	ID         int    `json:"id"`
+	Name       string `json:"name"`
+	Prefix     string `json:"prefix"`          // start of the token, to tell tokens apart
+	Token      string `json:"token,omitempty"` // only returned when the token is created
+	ExpiresAt  string `json:"expiresAt,omitempty"`
+	LastUsedAt string `json:"lastUsedAt,omitempty"`
+	CreatedAt  string `json:"createdAt"`
+}
+
+// CreateAccessTokenHandler creates a personal access token for editor
+// integrations and scripts. The token is only shown in this response.
+func (h *Handler) CreateAccessTokenHandler(c *fiber.Ctx) error {
+	principal, ferr := currentPrincipal(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	// A leaked token must not be able to mint further tokens
+	if principal.TokenID != 0 {
+		return fiber.NewError(fiber.StatusForbidden, "Access tokens can only be created after signing in")
+	}
+
+	var req CreateAccessTokenRequest
+	if err := h.parseBody(c, &req); err != nil {
+		return err
+	}
+	req.Name = strings.TrimSpace(req.Name)
+
+	var expiresAt *time.Time
+	if req.ExpiresInDays > 0 {
+		t := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		expiresAt = &t
+	}
+
+	secret, hash, prefix, err := auth.GenerateAccessToken()
+	if err != nil {
+		return internalError("Failed to create access token", err)
+	}
+
+	token, err := h.db.CreateAccessToken(c.UserContext(), principal.UserID, req.Name, hash, prefix, expiresAt)
+	if err != nil {
+		return internalError("Failed to create access token", err)
+	}
+
+	resp := dbAccessTokenToResponse(token)
+	resp.Token = secret
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"success": true, "data": resp})
+}
+
+// GetAccessTokensHandler lists the user's personal access tokens
+func (h *Handler) GetAccessTokensHandler(c *fiber.Ctx) error {
+	principal, ferr := currentPrincipal(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	tokens, err := h.db.GetAccessTokensByUser(c.UserContext(), principal.UserID)
+	if err != nil {
+		return internalError("Failed to get access tokens", err)
+	}
+
+	resp := []AccessTokenResponse{}
+	for _, token := range tokens {
+		resp = append(resp, dbAccessTokenToResponse(token))
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": resp})
+}
+
+// DeleteAccessTokenHandler revokes one of the user's personal access tokens
+func (h *Handler) DeleteAccessTokenHandler(c *fiber.Ctx) error {
+	principal, ferr := currentPrincipal(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	tokenID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid token ID")
+	}
+
+	if err := h.db.DeleteAccessToken(c.UserContext(), principal.UserID, tokenID); err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Access token revoked"})
+}
+
+func dbAccessTokenToResponse(token *database.AccessToken) AccessTokenResponse {
+	resp := AccessTokenResponse{
+		ID:        token.ID,
+		Name:      token.Name,
+		Prefix:    token.Prefix,
+		CreatedAt: token.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+	if token.ExpiresAt != nil {
+		resp.ExpiresAt = token.ExpiresAt.Format("2006-01-02T15:04:05Z07:00")
+	}
+	if token.LastUsedAt != nil {
+		resp.LastUsedAt = token.LastUsedAt.Format("2006-01-02T15:04:05Z07:00")
+	}
+	return resp
+}
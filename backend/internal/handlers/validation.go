@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"backend/internal/config"
+	"backend/internal/prompts"
+	"backend/internal/validate"
+	"errors"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxLanguageLength bounds language names
+const maxLanguageLength = 32
+
+// languageName is what a language value looks like: "go", "c++", "c#",
+// "objective-c", "typescriptreact"...
+var languageName = regexp.MustCompile(`^[a-z0-9][a-z0-9+#._-]*$`)
+
+// requestTypes are the request bodies checked with validate tags, including
+// through parseBody
+var requestTypes = []any{
+	SignupRequest{}, LoginRequest{},
+	GenerateRequest{}, CompleteRequest{},
+	CreateChatRequest{}, UpdateChatRequest{}, chatImport{},
+	EditMessageRequest{}, RegenerateRequest{}, SelectBranchRequest{}, FeedbackRequest{},
+	CreateShareRequest{}, CreateSnippetRequest{}, UpdateSnippetRequest{}, CreateAccessTokenRequest{},
+	WorkspaceRequest{}, UpdateMemberRoleRequest{}, CreateInviteRequest{}, AcceptInviteRequest{},
+	UpdateUserRoleRequest{},
+}
+
+// newValidator returns the validator of request bodies. Besides the built-in
+// rules, tags can use the configured limits, the limits defined as
+// constants in this package and the language rule. It panics when the tags
+// of a request type use a rule or parameter it doesn't define, so the
+// mistake stops the server from starting.
+func newValidator(limits config.Limits) *validate.Validator {
+	v := validate.New()
+	v.Set("maxPrompt", limits.MaxPromptLength)
+	v.Set("maxCode", limits.MaxCodeLength)
+	v.Set("modes", strings.Join(modeNames(), " "))
+	v.Set("maxCandidates", maxCandidates)
+	v.Set("maxCompletionCandidates", maxCompletionCandidates)
+	v.Set("maxStopSequences", maxStopSequences)
+	v.Set("maxCompletionTokens", maxCompletionTokens)
+	v.Set("maxFeedbackComment", maxFeedbackCommentLength)
+	v.Set("feedbackCategories", strings.Join(feedbackCategories, " "))
+	v.Set("maxAccessTokenName", maxAccessTokenNameLength)
+	v.Set("maxAccessTokenDays", maxAccessTokenDays)
+	v.Set("maxSnippetName", maxSnippetNameLength)
+	v.Set("maxImportMessages", maxImportMessages)
+	v.Set("maxInviteHours", int(maxInviteTTL/time.Hour))
+	v.Set("maxShareHours", maxShareHours)
+	v.Register("language", languageRule(limits.Languages))
+	if err := v.Check(requestTypes...); err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func modeNames() []string {
+	names := make([]string, len(prompts.Modes))
+	for i, mode := range prompts.Modes {
+		names[i] = string(mode)
+	}
+	return names
+}
+
+// languageRule accepts language names, restricted to allowed unless it is
+// empty. An empty language leaves it unspecified.
+func languageRule(allowed []string) validate.Rule {
+	return func(value reflect.Value, _ string) string {
+		if value.Kind() != reflect.String {
+			return ""
+		}
+		language := strings.ToLower(strings.TrimSpace(value.String()))
+		if language == "" {
+			return ""
+		}
+		if len(allowed) > 0 {
+			if !slices.Contains(allowed, language) {
+				return "must be one of: " + strings.Join(allowed, ", ")
+			}
+			return ""
+		}
+		if len(language) > maxLanguageLength || !languageName.MatchString(language) {
+			return "must be a language name such as go or python"
+		}
+		return ""
+	}
+}
+
+// parseBody decodes the request body into req and validates it
+func (h *Handler) parseBody(c *fiber.Ctx, req any) error {
+	if err := c.BodyParser(req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
+	}
+	return h.validateRequest(req)
+}
+
+// validateRequest checks req against its validate tags. The fields that
+// failed are listed in the error's details.
+func (h *Handler) validateRequest(req any) error {
+	err := h.validator.Struct(req)
+	var fieldErrs validate.Errors
+	if errors.As(err, &fieldErrs) {
+		return validationError(fieldErrs)
+	}
+	return err
+}
+
+// validateInput checks the input a mode needs, which depends on the mode
+// and so can't be expressed in tags, and reports what is missing like
+// validateRequest
+func validateInput(mode prompts.Mode, input prompts.Input) error {
+	err := mode.Validate(input)
+	var inputErr *prompts.InputError
+	if errors.As(err, &inputErr) {
+		return validationError(validate.Errors{{Field: inputErr.Field, Rule: "required", Message: inputErr.Message}})
+	}
+	return err
+}
+
+// validationError reports fields that failed validation, including checks
+// tags can't express
+func validationError(fieldErrs validate.Errors) error {
+	return &APIError{
+		Status:  fiber.StatusBadRequest,
+		Code:    "validation_failed",
+		Message: capitalize(fieldErrs.Error()),
+		Details: fieldErrs,
+	}
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"backend/internal/config"
+	"backend/internal/prompts"
+	"backend/internal/validate"
+	"errors"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRequestTypeTags(t *testing.T) {
+	limits := config.Limits{MaxPromptLength: 20000, MaxCodeLength: 100000, Languages: []string{"go"}}
+	defer func() {
+		if err := recover(); err != nil {
+			t.Fatalf("newValidator() panicked: %v", err)
+		}
+	}()
+
+	v := newValidator(limits)
+	for _, req := range requestTypes {
+		if err := v.Check(req); err != nil {
+			t.Errorf("%T: %v", req, err)
+		}
+	}
+}
+
+// TestRequestTypesAreListed makes sure every struct with validate tags is
+// checked at startup, directly or as a field of a listed type
+func TestRequestTypesAreListed(t *testing.T) {
+	listed := map[string]bool{}
+	var walk func(reflect.Type)
+	walk = func(t reflect.Type) {
+		for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct || listed[t.Name()] {
+			return
+		}
+		listed[t.Name()] = true
+		for i := range t.NumField() {
+			walk(t.Field(i).Type)
+		}
+	}
+	for _, req := range requestTypes {
+		walk(reflect.TypeOf(req))
+	}
+
+	pkgs, err := parser.ParseDir(token.NewFileSet(), ".", func(info os.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pkg := range pkgs {
+		ast.Inspect(pkg, func(node ast.Node) bool {
+			spec, ok := node.(*ast.TypeSpec)
+			if !ok {
+				return true
+			}
+			st, ok := spec.Type.(*ast.StructType)
+			if !ok {
+				return true
+			}
+			for _, field := range st.Fields.List {
+				if field.Tag != nil && strings.Contains(field.Tag.Value, `validate:"`) && !listed[spec.Name.Name] {
+					t.Errorf("%s has validate tags but is missing from requestTypes", spec.Name.Name)
+					break
+				}
+			}
+			return true
+		})
+	}
+}
+
+func newTestHandler() *Handler {
+	return NewHandler(nil, &config.Config{
+		Limits: config.Limits{MaxPromptLength: 20000, MaxCodeLength: 100000},
+	})
+}
+
+// failedFields returns the fields a validation error lists in its details,
+// or nil when err is nil
+func failedFields(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Status != 400 || apiErr.Code != "validation_failed" {
+		t.Fatalf("error = %v, want a validation error", err)
+	}
+	fieldErrs, ok := apiErr.Details.(validate.Errors)
+	if !ok {
+		t.Fatalf("details = %#v, want validate.Errors", apiErr.Details)
+	}
+	var fields []string
+	for _, fieldErr := range fieldErrs {
+		fields = append(fields, fieldErr.Field+":"+fieldErr.Rule)
+	}
+	return fields
+}
+
+func TestSignupPasswordLength(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		want     string // "field:rule" reported, or ""
+	}{
+		{"72 ASCII characters", strings.Repeat("a", 72), ""},
+		{"73 ASCII characters", strings.Repeat("a", 73), "password:max"},
+		{"72 characters of 2 bytes", strings.Repeat("é", 72), "password:maxbytes"},
+		{"36 characters of 2 bytes", strings.Repeat("é", 36), ""},
+		{"19 characters of 4 bytes", strings.Repeat("🔑", 19), "password:maxbytes"},
+	}
+	h := newTestHandler()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := SignupRequest{Name: "Ada", Email: "ada@example.com", Password: tt.password}
+			fields := failedFields(t, h.validateRequest(&req))
+			if strings.Join(fields, " ") != tt.want {
+				t.Errorf("validateRequest() reported %q, want %q", fields, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpiryLimits(t *testing.T) {
+	tests := []struct {
+		name string
+		req  any
+		want string // "field:rule" reported, or ""
+	}{
+		{"invite for 1 hour", &CreateInviteRequest{ExpiresInHours: 1}, ""},
+		{"invite for 30 days", &CreateInviteRequest{ExpiresInHours: 720}, ""},
+		{"invite for longer", &CreateInviteRequest{ExpiresInHours: 721}, "expiresInHours:max"},
+		{"invite for long enough to overflow", &CreateInviteRequest{ExpiresInHours: 1 << 62}, "expiresInHours:max"},
+		{"invite for negative hours", &CreateInviteRequest{ExpiresInHours: -1}, "expiresInHours:min"},
+		{"share link without expiry", &CreateShareRequest{}, ""},
+		{"share link for a year", &CreateShareRequest{ExpiresInHours: 8760}, ""},
+		{"share link for longer", &CreateShareRequest{ExpiresInHours: 8761}, "expiresInHours:max"},
+		{"share link for long enough to overflow", &CreateShareRequest{ExpiresInHours: 1 << 62}, "expiresInHours:max"},
+		{"access token for a year", &CreateAccessTokenRequest{Name: "editor", ExpiresInDays: 365}, ""},
+		{"access token for longer", &CreateAccessTokenRequest{Name: "editor", ExpiresInDays: 366}, "expiresInDays:max"},
+		{"access token for long enough to overflow", &CreateAccessTokenRequest{Name: "editor", ExpiresInDays: 1 << 62}, "expiresInDays:max"},
+	}
+	h := newTestHandler()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields := failedFields(t, h.validateRequest(tt.req))
+			if strings.Join(fields, " ") != tt.want {
+				t.Errorf("validateRequest() reported %q, want %q", fields, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateInput(t *testing.T) {
+	tests := []struct {
+		name  string
+		mode  prompts.Mode
+		input prompts.Input
+		want  string // "field:rule" reported, or ""
+	}{
+		{"generate", prompts.ModeGenerate, prompts.Input{Prompt: "a web server"}, ""},
+		{"generate without prompt", prompts.ModeGenerate, prompts.Input{}, "prompt:required"},
+		{"generate with a blank prompt", prompts.ModeGenerate, prompts.Input{Prompt: " \n"}, "prompt:required"},
+		{"explain without prompt", prompts.ModeExplain, prompts.Input{Code: "x := 1"}, ""},
+		{"explain without code", prompts.ModeExplain, prompts.Input{Prompt: "why?"}, "code:required"},
+		{"refactor without prompt", prompts.ModeRefactor, prompts.Input{Code: "x := 1"}, "prompt:required"},
+		{"edit without prompt", prompts.ModeEdit, prompts.Input{Code: "x := 1"}, "prompt:required"},
+		{"translate without target", prompts.ModeTranslate, prompts.Input{Code: "x := 1"}, "targetLanguage:required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fields := failedFields(t, validateInput(tt.mode, tt.input))
+			if strings.Join(fields, " ") != tt.want {
+				t.Errorf("validateInput() reported %q, want %q", fields, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,503 @@
+package handlers
+
+import (
+	"backend/internal/auth"
+	"backend/internal/authz"
+	"backend/internal/database"
+	"backend/internal/validate"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	defaultInviteTTL = 7 * 24 * time.Hour
+	maxInviteTTL     = 30 * 24 * time.Hour
+)
+
+type WorkspaceRequest struct {
+	Name string `json:"name" validate:"required,max=100"`
+}
+
+type WorkspaceResponse struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	Role      string `json:"role,omitempty"`
+	CreatedAt string `json:"createdAt"`
+	UpdatedAt string `json:"updatedAt"`
+}
+
+type WorkspaceMemberResponse struct {
+	UserID   int    `json:"userId"`
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Role     string `json:"role"`
+	JoinedAt string `json:"joinedAt"`
+}
+
+type WorkspaceWithMembersResponse struct {
+	Workspace WorkspaceResponse         `json:"workspace"`
+	Members   []WorkspaceMemberResponse `json:"members"`
+}
+
+type UpdateMemberRoleRequest struct {
+	Role string `json:"role" validate:"required,oneof=owner editor viewer"`
+}
+
+type CreateInviteRequest struct {
+	Role           string `json:"role" validate:"oneof=owner editor viewer"` // viewer by default
+	Email          string `json:"email,omitempty" validate:"email"`          // only this user may accept the invite
+	ExpiresInHours int    `json:"expiresInHours,omitempty" validate:"min=1,max=$maxInviteHours"`
+}
+
+// InviteResponse describes a pending invite. The token and URL are only
+// returned when the invite is created.
+type InviteResponse struct {
+	ID        int    `json:"id"`
+	Token     string `json:"token,omitempty"`
+	URL       string `json:"url,omitempty"`
+	Role      string `json:"role"`
+	Email     string `json:"email,omitempty"`
+	InvitedBy int    `json:"invitedBy"`
+	ExpiresAt string `json:"expiresAt"`
+	CreatedAt string `json:"createdAt"`
+}
+
+type AcceptInviteRequest struct {
+	Token string `json:"token" validate:"required"`
+}
+
+// CreateWorkspaceHandler creates a workspace owned by the authenticated user
+func (h *Handler) CreateWorkspaceHandler(c *fiber.Ctx) error {
+	principal, ferr := currentPrincipal(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	var req WorkspaceRequest
+	if err := h.parseBody(c, &req); err != nil {
+		return err
+	}
+
+	name := strings.TrimSpace(req.Name)
+
+	workspace, err := h.db.CreateWorkspace(c.UserContext(), principal.UserID, name)
+	if err != nil {
+		return internalError("Failed to create workspace", err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"success": true, "data": dbWorkspaceToResponse(workspace)})
+}
+
+// GetWorkspacesHandler returns the workspaces the authenticated user belongs to
+func (h *Handler) GetWorkspacesHandler(c *fiber.Ctx) error {
+	principal, ferr := currentPrincipal(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	workspaces, err := h.db.GetWorkspacesByUser(c.UserContext(), principal.UserID)
+	if err != nil {
+		return internalError("Failed to get workspaces", err)
+	}
+
+	resp := []WorkspaceResponse{}
+	for _, workspace := range workspaces {
+		resp = append(resp, dbWorkspaceToResponse(workspace))
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": resp})
+}
+
+// GetWorkspaceHandler returns a workspace with its members
+func (h *Handler) GetWorkspaceHandler(c *fiber.Ctx) error {
+	principal, ferr := currentPrincipal(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	workspace, ferr := h.authorizeWorkspace(c, principal, authz.ActionRead)
+	if ferr != nil {
+		return ferr
+	}
+
+	members, err := h.db.GetWorkspaceMembers(c.UserContext(), workspace.ID)
+	if err != nil {
+		return internalError("Failed to get members", err)
+	}
+
+	resp := WorkspaceWithMembersResponse{
+		Workspace: dbWorkspaceToResponse(workspace),
+		Members:   []WorkspaceMemberResponse{},
+	}
+	for _, member := range members {
+		if member.UserID == principal.UserID {
+			resp.Workspace.Role = member.Role
+		}
+		resp.Members = append(resp.Members, dbMemberToResponse(member))
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": resp})
+}
+
+// UpdateWorkspaceHandler renames a workspace
+func (h *Handler) UpdateWorkspaceHandler(c *fiber.Ctx) error {
+	principal, ferr := currentPrincipal(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	workspace, ferr := h.authorizeWorkspace(c, principal, authz.ActionManage)
+	if ferr != nil {
+		return ferr
+	}
+
+	var req WorkspaceRequest
+	if err := h.parseBody(c, &req); err != nil {
+		return err
+	}
+
+	name := strings.TrimSpace(req.Name)
+
+	if err := h.db.UpdateWorkspaceName(c.UserContext(), workspace.ID, name); err != nil {
+		return internalError("Failed to update workspace", err)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Workspace updated"})
+}
+
+// DeleteWorkspaceHandler deletes a workspace. Its chats become personal
+// chats of the members who created them.
+func (h *Handler) DeleteWorkspaceHandler(c *fiber.Ctx) error {
+	principal, ferr := currentPrincipal(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	workspace, ferr := h.authorizeWorkspace(c, principal, authz.ActionDelete)
+	if ferr != nil {
+		return ferr
+	}
+
+	if err := h.db.DeleteWorkspace(c.UserContext(), workspace.ID); err != nil {
+		return internalError("Failed to delete workspace", err)
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Workspace deleted"})
+}
+
+// UpdateWorkspaceMemberHandler changes a member's role
+func (h *Handler) UpdateWorkspaceMemberHandler(c *fiber.Ctx) error {
+	principal, ferr := currentPrincipal(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	workspace, ferr := h.authorizeWorkspace(c, principal, authz.ActionManage)
+	if ferr != nil {
+		return ferr
+	}
+
+	userID, err := strconv.Atoi(c.Params("userId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid user ID")
+	}
+
+	var req UpdateMemberRoleRequest
+	if err := h.parseBody(c, &req); err != nil {
+		return err
+	}
+
+	role := authz.WorkspaceRole(req.Role)
+
+	if role != authz.WorkspaceOwner {
+		if ferr := h.ensureAnotherOwner(c, workspace.ID, userID); ferr != nil {
+			return ferr
+		}
+	}
+
+	if err := h.db.UpdateWorkspaceMemberRole(c.UserContext(), workspace.ID, userID, string(role)); err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Member updated"})
+}
+
+// RemoveWorkspaceMemberHandler removes a member. Owners can remove anyone;
+// other members can only remove themselves (leave the workspace).
+func (h *Handler) RemoveWorkspaceMemberHandler(c *fiber.Ctx) error {
+	principal, ferr := currentPrincipal(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	userID, err := strconv.Atoi(c.Params("userId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid user ID")
+	}
+
+	action := authz.ActionManage
+	if userID == principal.UserID {
+		action = authz.ActionRead
+	}
+
+	workspace, ferr := h.authorizeWorkspace(c, principal, action)
+	if ferr != nil {
+		return ferr
+	}
+
+	if ferr := h.ensureAnotherOwner(c, workspace.ID, userID); ferr != nil {
+		return ferr
+	}
+
+	if err := h.db.RemoveWorkspaceMember(c.UserContext(), workspace.ID, userID); err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Member removed"})
+}
+
+// CreateWorkspaceInviteHandler issues a signed invite link for a workspace.
+// The invite is stored so it can be listed, revoked and only used once.
+func (h *Handler) CreateWorkspaceInviteHandler(c *fiber.Ctx) error {
+	principal, ferr := currentPrincipal(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	workspace, ferr := h.authorizeWorkspace(c, principal, authz.ActionManage)
+	if ferr != nil {
+		return ferr
+	}
+
+	var req CreateInviteRequest
+	if err := h.parseBody(c, &req); err != nil {
+		return err
+	}
+
+	role := authz.WorkspaceRole(req.Role)
+	if req.Role == "" {
+		role = authz.WorkspaceViewer
+	}
+	email := strings.TrimSpace(req.Email)
+
+	// Whoever sees an unbound link can accept it, which is too much for ownership
+	if role == authz.WorkspaceOwner && email == "" {
+		return validationError(validate.Errors{{Field: "email", Rule: "required", Message: "is required for owner invites"}})
+	}
+
+	ttl := defaultInviteTTL
+	if req.ExpiresInHours > 0 {
+		ttl = time.Duration(req.ExpiresInHours) * time.Hour
+	}
+
+	token, claims, err := auth.GenerateInviteToken(workspace.ID, string(role), email, principal.UserID, ttl)
+	if err != nil {
+		return internalError("Failed to create invite", err)
+	}
+
+	invite, err := h.db.CreateWorkspaceInvite(c.UserContext(), &database.WorkspaceInvite{
+		JTI:         claims.ID,
+		WorkspaceID: workspace.ID,
+		Role:        claims.Role,
+		Email:       claims.Email,
+		InvitedBy:   claims.InvitedBy,
+		ExpiresAt:   claims.ExpiresAt.Time,
+	})
+	if err != nil {
+		return internalError("Failed to create invite", err)
+	}
+
+	resp := dbInviteToResponse(invite)
+	resp.Token = token
+	if h.appURL != "" {
+		resp.URL = h.appURL + "/invite?token=" + token
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"success": true, "data": resp})
+}
+
+// GetWorkspaceInvitesHandler lists the workspace's pending invites
+func (h *Handler) GetWorkspaceInvitesHandler(c *fiber.Ctx) error {
+	principal, ferr := currentPrincipal(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	workspace, ferr := h.authorizeWorkspace(c, principal, authz.ActionManage)
+	if ferr != nil {
+		return ferr
+	}
+
+	invites, err := h.db.GetWorkspaceInvites(c.UserContext(), workspace.ID)
+	if err != nil {
+		return internalError("Failed to get invites", err)
+	}
+
+	resp := []InviteResponse{}
+	for _, invite := range invites {
+		resp = append(resp, dbInviteToResponse(invite))
+	}
+
+	return c.JSON(fiber.Map{"success": true, "data": resp})
+}
+
+// DeleteWorkspaceInviteHandler revokes a pending invite
+func (h *Handler) DeleteWorkspaceInviteHandler(c *fiber.Ctx) error {
+	principal, ferr := currentPrincipal(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	workspace, ferr := h.authorizeWorkspace(c, principal, authz.ActionManage)
+	if ferr != nil {
+		return ferr
+	}
+
+	inviteID, err := strconv.Atoi(c.Params("inviteId"))
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid invite ID")
+	}
+
+	if err := h.db.DeleteWorkspaceInvite(c.UserContext(), workspace.ID, inviteID); err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{"success": true, "message": "Invite revoked"})
+}
+
+// AcceptInviteHandler adds the authenticated user to the invited workspace
+// and uses up the invite
+func (h *Handler) AcceptInviteHandler(c *fiber.Ctx) error {
+	principal, ferr := currentPrincipal(c)
+	if ferr != nil {
+		return ferr
+	}
+
+	var req AcceptInviteRequest
+	if err := h.parseBody(c, &req); err != nil {
+		return err
+	}
+
+	claims, err := auth.ValidateInviteToken(req.Token)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid or expired invite")
+	}
+
+	// Accepted and revoked invites are no longer stored
+	invite, err := h.db.GetWorkspaceInviteByJTI(c.UserContext(), claims.ID)
+	if errors.Is(err, database.ErrNotFound) {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid or expired invite")
+	}
+	if err != nil {
+		return err
+	}
+
+	if invite.Email != "" && !strings.EqualFold(invite.Email, principal.Email) {
+		return fiber.NewError(fiber.StatusForbidden, "This invite was issued to a different email address")
+	}
+
+	// The inviter must still be able to manage the workspace for the link to work
+	inviter := &auth.Principal{UserID: invite.InvitedBy}
+	err = h.policy.Workspace(c.UserContext(), inviter, authz.ActionManage, invite.WorkspaceID)
+	if errors.Is(err, authz.ErrForbidden) {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid or expired invite")
+	}
+	if err != nil {
+		return err
+	}
+
+	workspace, err := h.db.GetWorkspaceByID(c.UserContext(), invite.WorkspaceID)
+	if err != nil {
+		return err
+	}
+
+	member, err := h.db.AcceptWorkspaceInvite(c.UserContext(), invite.ID, principal.UserID)
+	if errors.Is(err, database.ErrNotFound) {
+		// Used or revoked since it was read
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid or expired invite")
+	}
+	if err != nil {
+		return internalError("Failed to join workspace", err)
+	}
+
+	workspace.Role = member.Role
+	return c.JSON(fiber.Map{"success": true, "data": dbWorkspaceToResponse(workspace)})
+}
+
+// authorizeWorkspace loads the workspace from the :id route parameter and
+// checks that principal may perform action on it
+func (h *Handler) authorizeWorkspace(c *fiber.Ctx, principal *auth.Principal, action authz.Action) (*database.Workspace, error) {
+	workspaceID, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "Invalid workspace ID")
+	}
+
+	if err := h.policy.Workspace(c.UserContext(), principal, action, workspaceID); err != nil {
+		return nil, err
+	}
+
+	workspace, err := h.db.GetWorkspaceByID(c.UserContext(), workspaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	return workspace, nil
+}
+
+// ensureAnotherOwner prevents a workspace from losing its last owner when
+// userID is demoted or removed
+func (h *Handler) ensureAnotherOwner(c *fiber.Ctx, workspaceID, userID int) error {
+	members, err := h.db.GetWorkspaceMembers(c.UserContext(), workspaceID)
+	if err != nil {
+		return internalError("Failed to get members", err)
+	}
+
+	for _, member := range members {
+		if member.UserID != userID && authz.WorkspaceRole(member.Role) == authz.WorkspaceOwner {
+			return nil
+		}
+	}
+
+	for _, member := range members {
+		if member.UserID == userID && authz.WorkspaceRole(member.Role) == authz.WorkspaceOwner {
+			return fiber.NewError(fiber.StatusBadRequest, "A workspace must have at least one owner")
+		}
+	}
+
+	return nil
+}
+
+func dbWorkspaceToResponse(workspace *database.Workspace) WorkspaceResponse {
+	return WorkspaceResponse{
+		ID:        workspace.ID,
+		Name:      workspace.Name,
+		Role:      workspace.Role,
+		CreatedAt: workspace.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+		UpdatedAt: workspace.UpdatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+}
+
+func dbInviteToResponse(invite *database.WorkspaceInvite) InviteResponse {
+	return InviteResponse{
+		ID:        invite.ID,
+		Role:      invite.Role,
+		Email:     invite.Email,
+		InvitedBy: invite.InvitedBy,
+		ExpiresAt: invite.ExpiresAt.Format("2006-01-02T15:04:05Z07:00"),
+		CreatedAt: invite.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+}
+
+func dbMemberToResponse(member *database.WorkspaceMember) WorkspaceMemberResponse {
+	return WorkspaceMemberResponse{
+		UserID:   member.UserID,
+		Name:     member.Name,
+		Email:    member.Email,
+		Role:     member.Role,
+		JoinedAt: member.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
+	}
+}
@@ -0,0 +1,114 @@
+// Package logging sets up the structured logger and carries request IDs in
+// contexts, so everything logged while serving a request can be correlated:
+//
+//	slog.InfoContext(ctx, "Chat created", "chat_id", chat.ID)
+//
+// adds request_id when ctx comes from a request. Values of attributes
+// holding secrets, and prompts and code unless configured otherwise, are
+// replaced with [REDACTED].
+package logging
+
+import (
+	"backend/internal/config"
+	"context"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+)
+
+// redacted replaces the values of sensitive attributes
+const redacted = "[REDACTED]"
+
+// secretKeys are attribute names whose values are never logged
+var secretKeys = []string{"password", "secret", "token", "authorization", "api_key", "apikey", "cookie"}
+
+// contentKeys are attribute names of user content, logged only when
+// LOG_PROMPTS is enabled. Unlike secret keys they must match exactly, so
+// e.g. status_code is kept.
+var contentKeys = []string{"prompt", "content", "code", "completion", "prefix", "suffix"}
+
+// secretPrefixes start values that are credentials whatever their key
+var secretPrefixes = []string{"Bearer ", "cgc_pat_"}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a copy of ctx carrying a request ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID carried by ctx, or ""
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// New returns a logger writing to w as configured: JSON or text lines,
+// from the configured level up
+func New(w io.Writer, cfg config.Logging) *slog.Logger {
+	opts := &slog.HandlerOptions{
+		Level:       cfg.Level,
+		ReplaceAttr: redactor(cfg.LogPrompts),
+	}
+
+	var handler slog.Handler
+	if cfg.Format == config.LogFormatJSON {
+		handler = slog.NewJSONHandler(w, opts)
+	} else {
+		handler = slog.NewTextHandler(w, opts)
+	}
+	return slog.New(contextHandler{handler})
+}
+
+// contextHandler adds the request ID of the context to records
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		record.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// redactor returns the ReplaceAttr function hiding sensitive values
+func redactor(logPrompts bool) func(groups []string, attr slog.Attr) slog.Attr {
+	return func(_ []string, attr slog.Attr) slog.Attr {
+		key := strings.ToLower(attr.Key)
+		switch {
+		case matches(key, secretKeys):
+			attr.Value = slog.StringValue(redacted)
+		case !logPrompts && slices.Contains(contentKeys, key):
+			attr.Value = slog.StringValue(redacted)
+		case attr.Value.Kind() == slog.KindString:
+			for _, prefix := range secretPrefixes {
+				if strings.HasPrefix(attr.Value.String(), prefix) {
+					attr.Value = slog.StringValue(redacted)
+					break
+				}
+			}
+		}
+		return attr
+	}
+}
+
+// matches reports whether a key names one of the fields, as in "jwt_secret"
+// or "password"
+func matches(key string, names []string) bool {
+	for _, name := range names {
+		if key == name || strings.HasSuffix(key, "_"+name) || strings.HasPrefix(key, name+"_") {
+			return true
+		}
+	}
+	return false
+}
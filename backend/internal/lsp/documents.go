@@ -0,0 +1,117 @@
+package lsp
+
+import (
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// document is an open text document
+type document struct {
+	uri        string
+	languageID string
+	version    int
+	text       string
+}
+
+// documents tracks the documents open in the editor
+type documents struct {
+	mu   sync.Mutex
+	docs map[string]*document
+}
+
+func newDocuments() *documents {
+	return &documents{docs: make(map[string]*document)}
+}
+
+func (d *documents) open(item TextDocumentItem) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.docs[item.URI] = &document{uri: item.URI, languageID: item.LanguageID, version: item.Version, text: item.Text}
+}
+
+func (d *documents) update(uri string, version int, text string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if doc, ok := d.docs[uri]; ok {
+		// Documents are replaced rather than changed, so snapshots handed
+		// out by get stay consistent
+		d.docs[uri] = &document{uri: uri, languageID: doc.languageID, version: version, text: text}
+	}
+}
+
+func (d *documents) close(uri string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.docs, uri)
+}
+
+// get returns a snapshot of an open document
+func (d *documents) get(uri string) (*document, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	doc, ok := d.docs[uri]
+	return doc, ok
+}
+
+// offset converts a position to a byte offset in the text, clamping
+// positions past the end of a line or of the text
+func (doc *document) offset(pos Position) int {
+	start := 0
+	for line := 0; line < pos.Line; line++ {
+		i := strings.IndexByte(doc.text[start:], '\n')
+		if i < 0 {
+			return len(doc.text)
+		}
+		start += i + 1
+	}
+
+	// Characters are counted in UTF-16 code units
+	units := 0
+	i := start
+	for i < len(doc.text) && units < pos.Character {
+		r, size := utf8.DecodeRuneInString(doc.text[i:])
+		if r == '\n' {
+			break
+		}
+		units++
+		if r >= 0x10000 {
+			units++
+		}
+		i += size
+	}
+	return i
+}
+
+// position converts a byte offset in the text to a position
+func (doc *document) position(offset int) Position {
+	offset = min(max(offset, 0), len(doc.text))
+	before := doc.text[:offset]
+	line := strings.Count(before, "\n")
+	lineStart := strings.LastIndexByte(before, '\n') + 1
+
+	units := 0
+	for _, r := range before[lineStart:] {
+		units++
+		if r >= 0x10000 {
+			units++
+		}
+	}
+	return Position{Line: line, Character: units}
+}
+
+// slice returns the text of a range
+func (doc *document) slice(r Range) string {
+	start, end := doc.offset(r.Start), doc.offset(r.End)
+	if end < start {
+		start, end = end, start
+	}
+	return doc.text[start:end]
+}
+
+// lineRange returns the range of whole lines from first to last, including
+// the newline ending the last one
+func (doc *document) lineRange(first, last int) Range {
+	end := doc.offset(Position{Line: last + 1})
+	return Range{Start: Position{Line: first}, End: doc.position(end)}
+}
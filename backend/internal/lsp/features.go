@@ -0,0 +1,458 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"backend/pkg/client"
+)
+
+const (
+	// maxPrefixBytes and maxSuffixBytes cap the code around the cursor sent
+	// for completions, matching what the backend accepts
+	maxPrefixBytes = 8000
+	maxSuffixBytes = 2000
+	// completionCandidates is how many completions are asked for
+	completionCandidates = 3
+	// hoverContextLines is how many lines around the hovered one are sent
+	hoverContextLines = 10
+	// hoverTimeout bounds hover explanations, which block the editor's tooltip
+	hoverTimeout = 20 * time.Second
+)
+
+// Commands run by the code actions
+const (
+	commandExplain  = "copilot.explain"
+	commandRefactor = "copilot.refactor"
+	commandTests    = "copilot.tests"
+)
+
+const (
+	codeActionKindRewrite = "refactor.rewrite"
+	codeActionKindSource  = "source"
+)
+
+// refactorings are the refactor code actions offered for a selection. LSP
+// has no way to ask for free-form input, so the instructions are fixed.
+var refactorings = []struct {
+	title       string
+	instruction string
+}{
+	{"Simplify", "Simplify this code without changing its behavior"},
+	{"Improve names", "Give variables, parameters and functions clearer names"},
+	{"Add error handling", "Add the missing error handling"},
+	{"Add comments", "Add concise comments explaining the parts that aren't obvious"},
+}
+
+// completion asks the backend for inline completions at pos
+func (s *Server) completion(ctx context.Context, doc *document, pos Position) (*CompletionList, error) {
+	offset := doc.offset(pos)
+	prefix := doc.text[:offset]
+	suffix := doc.text[offset:]
+	if len(prefix) > maxPrefixBytes {
+		prefix = strings.ToValidUTF8(prefix[len(prefix)-maxPrefixBytes:], "")
+	}
+	if len(suffix) > maxSuffixBytes {
+		suffix = strings.ToValidUTF8(suffix[:maxSuffixBytes], "")
+	}
+
+	resp, err := s.api.Complete(ctx, client.CompleteRequest{
+		Prefix:     prefix,
+		Suffix:     suffix,
+		Language:   doc.languageID,
+		FilePath:   filePath(doc.uri),
+		Candidates: completionCandidates,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Editors filter items by the word before the cursor, so the edit
+	// replaces that word with the word plus the completion
+	word := wordBefore(prefix)
+	replace := Range{Start: doc.position(offset - len(word)), End: pos}
+
+	list := &CompletionList{IsIncomplete: true, Items: []CompletionItem{}}
+	for _, completion := range resp.Completions {
+		text := word + completion.Text
+		list.Items = append(list.Items, CompletionItem{
+			Label:            completionLabel(text),
+			Kind:             completionItemKindText,
+			Detail:           "copilot",
+			SortText:         fmt.Sprintf("%04d", completion.Rank),
+			FilterText:       text,
+			InsertTextFormat: insertTextFormatPlain,
+			TextEdit:         &TextEdit{Range: replace, NewText: text},
+		})
+	}
+	return list, nil
+}
+
+// hover explains the hovered line in the context of the lines around it
+func (s *Server) hover(ctx context.Context, doc *document, pos Position) (*Hover, error) {
+	lines := strings.Split(doc.text, "\n")
+	if pos.Line >= len(lines) || strings.TrimSpace(lines[pos.Line]) == "" {
+		return nil, nil
+	}
+
+	if summary, ok := s.hovers.get(doc.uri, doc.version, pos.Line); ok {
+		return lineHover(doc, pos.Line, summary), nil
+	}
+
+	first := max(pos.Line-hoverContextLines, 0)
+	last := min(pos.Line+hoverContextLines, len(lines)-1)
+
+	ctx, cancel := context.WithTimeout(ctx, hoverTimeout)
+	defer cancel()
+
+	resp, err := s.api.Generate(ctx, client.GenerateRequest{
+		Mode:      client.ModeExplain,
+		Prompt:    fmt.Sprintf("Explain what line %d does in the summary, in one or two sentences.", pos.Line-first+1),
+		Language:  doc.languageID,
+		Code:      strings.Join(lines[first:last+1], "\n"),
+		Ephemeral: true,
+	})
+	if err != nil {
+		// A failed hover shouldn't interrupt the user with an error
+		s.logger.Printf("Hover failed: %v", err)
+		return nil, nil
+	}
+
+	var explanation struct {
+		Summary string `json:"summary"`
+	}
+	if err := json.Unmarshal(resp.Result, &explanation); err != nil || explanation.Summary == "" {
+		explanation.Summary = resp.Code
+	}
+
+	s.hovers.add(doc.uri, doc.version, pos.Line, explanation.Summary)
+	return lineHover(doc, pos.Line, explanation.Summary), nil
+}
+
+func lineHover(doc *document, line int, text string) *Hover {
+	r := doc.lineRange(line, line)
+	return &Hover{Contents: MarkupContent{Kind: "markdown", Value: text}, Range: &r}
+}
+
+// codeActions offers the copilot commands for the selection, or tests for
+// the whole file when nothing is selected
+func (s *Server) codeActions(params CodeActionParams) []CodeAction {
+	uri := params.TextDocument.URI
+	actions := []CodeAction{}
+
+	if params.Range.Start == params.Range.End {
+		return append(actions, CodeAction{
+			Title:   "Copilot: Generate tests for this file",
+			Kind:    codeActionKindSource,
+			Command: &Command{Title: "Generate tests", Command: commandTests, Arguments: []any{uri, nil}},
+		})
+	}
+
+	actions = append(actions,
+		CodeAction{
+			Title:   "Copilot: Explain selection",
+			Kind:    codeActionKindSource,
+			Command: &Command{Title: "Explain selection", Command: commandExplain, Arguments: []any{uri, params.Range}},
+		},
+		CodeAction{
+			Title:   "Copilot: Generate tests for selection",
+			Kind:    codeActionKindSource,
+			Command: &Command{Title: "Generate tests", Command: commandTests, Arguments: []any{uri, params.Range}},
+		},
+	)
+	for _, r := range refactorings {
+		actions = append(actions, CodeAction{
+			Title:   "Copilot: " + r.title,
+			Kind:    codeActionKindRewrite,
+			Command: &Command{Title: r.title, Command: commandRefactor, Arguments: []any{uri, params.Range, r.instruction}},
+		})
+	}
+	return actions
+}
+
+// executeCommand runs a code action. Failures are shown to the user, since
+// editors often ignore errors returned for commands.
+func (s *Server) executeCommand(ctx context.Context, params ExecuteCommandParams) error {
+	var uri, instruction string
+	var selection *Range
+	args := []any{&uri, &selection, &instruction}
+	for i := range min(len(params.Arguments), len(args)) {
+		if err := json.Unmarshal(params.Arguments[i], args[i]); err != nil {
+			return &rpcError{Code: codeInvalidParams, Message: "invalid command arguments"}
+		}
+	}
+
+	doc, ok := s.docs.get(uri)
+	if !ok {
+		return &rpcError{Code: codeInvalidParams, Message: "document is not open"}
+	}
+
+	var err error
+	switch params.Command {
+	case commandExplain:
+		err = s.explain(ctx, doc, selection)
+	case commandRefactor:
+		err = s.refactor(ctx, doc, selection, instruction)
+	case commandTests:
+		err = s.tests(ctx, doc, selection)
+	default:
+		return &rpcError{Code: codeInvalidParams, Message: "unknown command " + params.Command}
+	}
+	if err != nil && !errors.Is(err, context.Canceled) {
+		s.showMessage(messageTypeError, "Copilot: "+err.Error())
+	}
+	return err
+}
+
+func (s *Server) explain(ctx context.Context, doc *document, selection *Range) error {
+	if selection == nil {
+		return errors.New("select the code to explain")
+	}
+
+	resp, err := s.api.Generate(ctx, client.GenerateRequest{
+		Mode:      client.ModeExplain,
+		Language:  doc.languageID,
+		Code:      doc.slice(*selection),
+		Ephemeral: true,
+	})
+	if err != nil {
+		return err
+	}
+
+	s.showMessage(messageTypeInfo, resp.Code)
+	return nil
+}
+
+func (s *Server) refactor(ctx context.Context, doc *document, selection *Range, instruction string) error {
+	if selection == nil || instruction == "" {
+		return errors.New("select the code to refactor")
+	}
+
+	original := doc.slice(*selection)
+	resp, err := s.api.Generate(ctx, client.GenerateRequest{
+		Mode:      client.ModeRefactor,
+		Prompt:    instruction,
+		Language:  doc.languageID,
+		Code:      original,
+		Ephemeral: true,
+	})
+	if err != nil {
+		return err
+	}
+
+	code := resp.Code
+	if strings.HasSuffix(original, "\n") && !strings.HasSuffix(code, "\n") {
+		code += "\n"
+	}
+
+	// The edit is tied to the document version it was computed for, so the
+	// editor rejects it if the user kept typing
+	version := doc.version
+	return s.applyEdit(ctx, "Copilot: refactor", WorkspaceEdit{DocumentChanges: []any{
+		TextDocumentEdit{
+			TextDocument: OptionalVersionedTextDocumentIdentifier{URI: doc.uri, Version: &version},
+			Edits:        []TextEdit{{Range: *selection, NewText: code}},
+		},
+	}})
+}
+
+// tests writes tests for the selection, or the whole document, to the test
+// file the language's conventions put next to it
+func (s *Server) tests(ctx context.Context, doc *document, selection *Range) error {
+	code := doc.text
+	if selection != nil {
+		code = doc.slice(*selection)
+	}
+
+	path := filePath(doc.uri)
+	if path == "" {
+		return errors.New("tests can only be generated for files on disk")
+	}
+	testPath := testFilePath(path, doc.languageID)
+
+	resp, err := s.api.Generate(ctx, client.GenerateRequest{
+		Mode:      client.ModeTests,
+		Prompt:    "The tests go in " + filepath.Base(testPath) + ", next to " + filepath.Base(path) + ".",
+		Language:  doc.languageID,
+		Code:      code,
+		Ephemeral: true,
+	})
+	if err != nil {
+		return err
+	}
+
+	testURI := fileURI(testPath)
+	tests := strings.TrimRight(resp.Code, "\n") + "\n"
+
+	// Existing test files get the new tests appended
+	var edit WorkspaceEdit
+	if existing, err := s.currentText(testURI, testPath); err == nil {
+		edit.Changes = map[string][]TextEdit{testURI: {appendEdit(existing, tests)}}
+	} else {
+		edit.DocumentChanges = []any{
+			CreateFile{Kind: "create", URI: testURI, Options: CreateFileOptions{IgnoreIfExists: true}},
+			TextDocumentEdit{
+				TextDocument: OptionalVersionedTextDocumentIdentifier{URI: testURI},
+				Edits:        []TextEdit{{Range: Range{}, NewText: tests}},
+			},
+		}
+	}
+
+	if err := s.applyEdit(ctx, "Copilot: generate tests", edit); err != nil {
+		return err
+	}
+
+	// Not all editors support showing documents, which is fine
+	_ = s.conn.call(ctx, "window/showDocument", map[string]any{"uri": testURI, "takeFocus": true}, nil)
+	return nil
+}
+
+// appendEdit adds text at the end of existing, separated from what is
+// already there by one blank line
+func appendEdit(existing, text string) TextEdit {
+	doc := &document{text: existing}
+	content := strings.TrimRight(existing, "\n")
+	if content != "" {
+		text = "\n\n" + text
+	}
+	// Trailing newlines are replaced, so there is never more than one blank line
+	return TextEdit{
+		Range:   Range{Start: doc.position(len(content)), End: doc.position(len(existing))},
+		NewText: text,
+	}
+}
+
+// currentText returns the text of a file as the editor sees it
+func (s *Server) currentText(uri, path string) (string, error) {
+	if doc, ok := s.docs.get(uri); ok {
+		return doc.text, nil
+	}
+	data, err := os.ReadFile(path)
+	return string(data), err
+}
+
+func (s *Server) applyEdit(ctx context.Context, label string, edit WorkspaceEdit) error {
+	var result ApplyWorkspaceEditResult
+	if err := s.conn.call(ctx, "workspace/applyEdit", ApplyWorkspaceEditParams{Label: label, Edit: edit}, &result); err != nil {
+		return err
+	}
+	if !result.Applied {
+		if result.FailureReason != "" {
+			return errors.New("the editor rejected the change: " + result.FailureReason)
+		}
+		return errors.New("the editor rejected the change, was the document edited meanwhile?")
+	}
+	return nil
+}
+
+// testFilePath names the test file for a source file following the
+// conventions of its language
+func testFilePath(path, languageID string) string {
+	dir, base := filepath.Split(path)
+	ext := filepath.Ext(base)
+	name := strings.TrimSuffix(base, ext)
+
+	switch languageID {
+	case "python":
+		return filepath.Join(dir, "test_"+name+ext)
+	case "javascript", "javascriptreact", "typescript", "typescriptreact":
+		return filepath.Join(dir, name+".test"+ext)
+	case "java", "kotlin", "csharp":
+		return filepath.Join(dir, name+"Test"+ext)
+	case "ruby":
+		return filepath.Join(dir, name+"_spec"+ext)
+	}
+	return filepath.Join(dir, name+"_test"+ext)
+}
+
+// filePath returns the local path of a file URI, or "" for other URIs
+func filePath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return ""
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+func fileURI(path string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
+
+// wordBefore returns the identifier characters immediately before the end of text
+func wordBefore(text string) string {
+	i := len(text)
+	for i > 0 {
+		r, size := utf8.DecodeLastRuneInString(text[:i])
+		if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			break
+		}
+		i -= size
+	}
+	return text[i:]
+}
+
+// completionLabel shows the first line of a completion
+func completionLabel(text string) string {
+	label, _, multiline := strings.Cut(strings.TrimSpace(text), "\n")
+	if utf8.RuneCountInString(label) > 60 {
+		label = string([]rune(label)[:60])
+		multiline = true
+	}
+	if multiline {
+		label += "…"
+	}
+	return label
+}
+
+// hoverCache remembers hover explanations per document version and line
+type hoverCache struct {
+	mu      sync.Mutex
+	entries map[string]map[hoverKey]string // by document URI
+}
+
+type hoverKey struct {
+	version int
+	line    int
+}
+
+func newHoverCache() *hoverCache {
+	return &hoverCache{entries: make(map[string]map[hoverKey]string)}
+}
+
+func (c *hoverCache) get(uri string, version, line int) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	text, ok := c.entries[uri][hoverKey{version, line}]
+	return text, ok
+}
+
+func (c *hoverCache) add(uri string, version, line int, text string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// Explanations of older versions are stale once the document changed
+	for key := range c.entries[uri] {
+		if key.version != version {
+			delete(c.entries[uri], key)
+		}
+	}
+	if c.entries[uri] == nil {
+		c.entries[uri] = make(map[hoverKey]string)
+	}
+	c.entries[uri][hoverKey{version, line}] = text
+}
+
+func (c *hoverCache) forget(uri string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, uri)
+}
@@ -0,0 +1,30 @@
+package lsp
+
+import "testing"
+
+func TestAppendEdit(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing string
+		want     string
+	}{
+		{"empty file", "", "func TestB() {}\n"},
+		{"file of blank lines", "\n\n", "func TestB() {}\n"},
+		{"final newline", "func TestA() {}\n", "func TestA() {}\n\nfunc TestB() {}\n"},
+		{"no final newline", "func TestA() {}", "func TestA() {}\n\nfunc TestB() {}\n"},
+		{"blank lines at the end", "func TestA() {}\n\n\n", "func TestA() {}\n\nfunc TestB() {}\n"},
+		{"several lines", "package a\n\nfunc TestA() {}\n", "package a\n\nfunc TestA() {}\n\nfunc TestB() {}\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			edit := appendEdit(tt.existing, "func TestB() {}\n")
+
+			doc := &document{text: tt.existing}
+			start, end := doc.offset(edit.Range.Start), doc.offset(edit.Range.End)
+			got := tt.existing[:start] + edit.NewText + tt.existing[end:]
+			if got != tt.want {
+				t.Errorf("after the edit the file is %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
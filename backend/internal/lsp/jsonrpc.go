@@ -0,0 +1,186 @@
+package lsp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"sync"
+)
+
+// JSON-RPC error codes used by the server
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeInternalError  = -32603
+	codeRequestFailed  = -32803
+	codeCancelled      = -32800
+)
+
+// rpcError is a JSON-RPC error object
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("%s (%d)", e.Message, e.Code)
+}
+
+// message is any JSON-RPC message: a request has an ID and a method, a
+// notification only a method and a response only an ID
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type resultResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result"`
+}
+
+type errorResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Error   *rpcError       `json:"error"`
+}
+
+type outgoingRequest struct {
+	JSONRPC string `json:"jsonrpc"`
+	ID      int    `json:"id,omitempty"`
+	Method  string `json:"method"`
+	Params  any    `json:"params,omitempty"`
+}
+
+// conn exchanges LSP base protocol messages (JSON-RPC with Content-Length
+// headers) over a stream. Writes are safe for concurrent use.
+type conn struct {
+	r *bufio.Reader
+
+	writeMu sync.Mutex
+	w       io.Writer
+
+	mu      sync.Mutex
+	nextID  int
+	pending map[string]chan *message // calls to the client awaiting a response
+}
+
+func newConn(r io.Reader, w io.Writer) *conn {
+	return &conn{
+		r:       bufio.NewReader(r),
+		w:       w,
+		pending: make(map[string]chan *message),
+	}
+}
+
+// read returns the next message from the client
+func (c *conn) read() (*message, error) {
+	header, err := textproto.NewReader(c.r).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("invalid Content-Length %q", header.Get("Content-Length"))
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(c.r, body); err != nil {
+		return nil, err
+	}
+
+	var msg message
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return nil, &rpcError{Code: codeParseError, Message: err.Error()}
+	}
+	return &msg, nil
+}
+
+func (c *conn) write(v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if _, err := fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return err
+	}
+	_, err = c.w.Write(body)
+	return err
+}
+
+// reply answers a request with a result or, when err is set, an error
+func (c *conn) reply(id json.RawMessage, result any, err error) error {
+	if err != nil {
+		var rerr *rpcError
+		if !errors.As(err, &rerr) {
+			rerr = &rpcError{Code: codeRequestFailed, Message: err.Error()}
+			if errors.Is(err, context.Canceled) {
+				rerr.Code = codeCancelled
+			}
+		}
+		return c.write(errorResponse{JSONRPC: "2.0", ID: id, Error: rerr})
+	}
+	return c.write(resultResponse{JSONRPC: "2.0", ID: id, Result: result})
+}
+
+// notify sends a notification to the client
+func (c *conn) notify(method string, params any) error {
+	return c.write(outgoingRequest{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+// call sends a request to the client and waits for its response
+func (c *conn) call(ctx context.Context, method string, params, result any) error {
+	c.mu.Lock()
+	c.nextID++
+	id := c.nextID
+	ch := make(chan *message, 1)
+	c.pending[strconv.Itoa(id)] = ch
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, strconv.Itoa(id))
+		c.mu.Unlock()
+	}()
+
+	if err := c.write(outgoingRequest{JSONRPC: "2.0", ID: id, Method: method, Params: params}); err != nil {
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case resp := <-ch:
+		if resp.Error != nil {
+			return resp.Error
+		}
+		if result != nil && len(resp.Result) > 0 {
+			return json.Unmarshal(resp.Result, result)
+		}
+		return nil
+	}
+}
+
+// deliver hands a response from the client to the call waiting for it
+func (c *conn) deliver(msg *message) {
+	c.mu.Lock()
+	ch, ok := c.pending[string(msg.ID)]
+	c.mu.Unlock()
+	if ok {
+		ch <- msg
+	}
+}
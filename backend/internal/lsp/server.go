@@ -0,0 +1,237 @@
+// Package lsp implements a Language Server Protocol server that brings the
+// copilot's inline completions, code actions and hover explanations to any
+// LSP capable editor. It talks to the editor over stdio and to the backend
+// API with a personal access token.
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"backend/pkg/client"
+)
+
+// Version is reported to the editor on initialization
+const Version = "1.0.0"
+
+// apiTimeout bounds requests to the backend that aren't bounded by the editor
+const apiTimeout = 2 * time.Minute
+
+type Server struct {
+	conn   *conn
+	api    *client.Client
+	docs   *documents
+	hovers *hoverCache
+	logger *log.Logger
+
+	mu       sync.Mutex
+	cancels  map[string]context.CancelFunc // in-flight requests by ID
+	shutdown bool
+}
+
+// NewServer creates a server reading from in and writing to out, calling
+// the backend at apiURL with the given personal access token
+func NewServer(in io.Reader, out io.Writer, apiURL, token string, logger *log.Logger) *Server {
+	return &Server{
+		conn:    newConn(in, out),
+		api:     client.New(apiURL, client.WithToken(token), client.WithHTTPClient(&http.Client{Timeout: apiTimeout})),
+		docs:    newDocuments(),
+		hovers:  newHoverCache(),
+		logger:  logger,
+		cancels: make(map[string]context.CancelFunc),
+	}
+}
+
+// Run serves the editor until it asks the server to exit or closes the stream
+func (s *Server) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for {
+		msg, err := s.conn.read()
+		if err != nil {
+			var rerr *rpcError
+			if errors.As(err, &rerr) {
+				s.logger.Printf("Ignoring malformed message: %v", err)
+				continue
+			}
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+
+		switch {
+		case msg.Method == "":
+			// A response to one of our requests
+			s.conn.deliver(msg)
+		case len(msg.ID) == 0:
+			// Notifications are handled in order, so document changes are
+			// applied before later requests look at the document
+			if msg.Method == "exit" {
+				if !s.isShutdown() {
+					return errors.New("exit without shutdown")
+				}
+				return nil
+			}
+			s.handleNotification(msg)
+		default:
+			reqCtx, reqCancel := context.WithCancel(ctx)
+			s.mu.Lock()
+			s.cancels[string(msg.ID)] = reqCancel
+			s.mu.Unlock()
+
+			// Snapshot what the request needs before handling it concurrently
+			handle := s.prepare(msg)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				defer s.finish(msg.ID, reqCancel)
+				result, err := handle(reqCtx)
+				if err := s.conn.reply(msg.ID, result, err); err != nil {
+					s.logger.Printf("Failed to reply to %s: %v", msg.Method, err)
+				}
+			}()
+		}
+	}
+}
+
+func (s *Server) finish(id json.RawMessage, cancel context.CancelFunc) {
+	cancel()
+	s.mu.Lock()
+	delete(s.cancels, string(id))
+	s.mu.Unlock()
+}
+
+func (s *Server) isShutdown() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.shutdown
+}
+
+func (s *Server) handleNotification(msg *message) {
+	switch msg.Method {
+	case "textDocument/didOpen":
+		var params DidOpenTextDocumentParams
+		if err := json.Unmarshal(msg.Params, &params); err == nil {
+			s.docs.open(params.TextDocument)
+		}
+	case "textDocument/didChange":
+		var params DidChangeTextDocumentParams
+		if err := json.Unmarshal(msg.Params, &params); err == nil && len(params.ContentChanges) > 0 {
+			// With full sync the last change holds the whole document
+			text := params.ContentChanges[len(params.ContentChanges)-1].Text
+			s.docs.update(params.TextDocument.URI, params.TextDocument.Version, text)
+		}
+	case "textDocument/didClose":
+		var params DidCloseTextDocumentParams
+		if err := json.Unmarshal(msg.Params, &params); err == nil {
+			s.docs.close(params.TextDocument.URI)
+			s.hovers.forget(params.TextDocument.URI)
+		}
+	case "$/cancelRequest":
+		var params struct {
+			ID json.RawMessage `json:"id"`
+		}
+		if err := json.Unmarshal(msg.Params, &params); err == nil {
+			s.mu.Lock()
+			if cancel, ok := s.cancels[string(params.ID)]; ok {
+				cancel()
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+// prepare decodes a request and returns the function answering it
+func (s *Server) prepare(msg *message) func(ctx context.Context) (any, error) {
+	fail := func(code int, message string) func(context.Context) (any, error) {
+		return func(context.Context) (any, error) {
+			return nil, &rpcError{Code: code, Message: message}
+		}
+	}
+
+	switch msg.Method {
+	case "initialize":
+		return func(context.Context) (any, error) {
+			return s.initialize(), nil
+		}
+	case "shutdown":
+		s.mu.Lock()
+		s.shutdown = true
+		s.mu.Unlock()
+		return func(context.Context) (any, error) { return nil, nil }
+	case "textDocument/completion":
+		var params TextDocumentPositionParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return fail(codeInvalidParams, err.Error())
+		}
+		doc, ok := s.docs.get(params.TextDocument.URI)
+		if !ok {
+			return fail(codeInvalidParams, "document is not open")
+		}
+		return func(ctx context.Context) (any, error) {
+			return s.completion(ctx, doc, params.Position)
+		}
+	case "textDocument/hover":
+		var params TextDocumentPositionParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return fail(codeInvalidParams, err.Error())
+		}
+		doc, ok := s.docs.get(params.TextDocument.URI)
+		if !ok {
+			return fail(codeInvalidParams, "document is not open")
+		}
+		return func(ctx context.Context) (any, error) {
+			return s.hover(ctx, doc, params.Position)
+		}
+	case "textDocument/codeAction":
+		var params CodeActionParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return fail(codeInvalidParams, err.Error())
+		}
+		return func(context.Context) (any, error) {
+			return s.codeActions(params), nil
+		}
+	case "workspace/executeCommand":
+		var params ExecuteCommandParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return fail(codeInvalidParams, err.Error())
+		}
+		return func(ctx context.Context) (any, error) {
+			return nil, s.executeCommand(ctx, params)
+		}
+	}
+	return fail(codeMethodNotFound, "method not supported: "+msg.Method)
+}
+
+func (s *Server) initialize() InitializeResult {
+	return InitializeResult{
+		Capabilities: ServerCapabilities{
+			TextDocumentSync:   textDocumentSyncFull,
+			CompletionProvider: CompletionOptions{TriggerCharacters: []string{".", "(", " ", "\n"}},
+			HoverProvider:      true,
+			CodeActionProvider: CodeActionOptions{CodeActionKinds: []string{codeActionKindRewrite, codeActionKindSource}},
+			ExecuteCommandProvider: ExecuteCommandOptions{
+				Commands: []string{commandExplain, commandRefactor, commandTests},
+			},
+		},
+		ServerInfo: ServerInfo{Name: "copilot-lsp", Version: Version},
+	}
+}
+
+// showMessage shows a message to the user, logging failures to do so
+func (s *Server) showMessage(kind int, text string) {
+	if err := s.conn.notify("window/showMessage", ShowMessageParams{Type: kind, Message: text}); err != nil {
+		s.logger.Printf("Failed to show message: %v", err)
+	}
+}
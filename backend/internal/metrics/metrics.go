@@ -0,0 +1,415 @@
+// Package metrics keeps counters, gauges and histograms in memory and
+// writes them in the Prometheus text exposition format. Metrics are created
+// once, usually as package variables, and registered in Default:
+//
+//	requests := metrics.NewCounterVec("http_requests_total", "HTTP requests handled.", "route", "status")
+//	requests.With("/api/v1/chats", "200").Inc()
+//
+// Label values must come from small fixed sets, like route patterns, never
+// from user input, since every combination is kept forever.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultBuckets are histogram bounds, in seconds, suited to request latency
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Default is the registry the package-level constructors register in
+var Default = NewRegistry()
+
+// collector is a metric family the registry writes
+type collector interface {
+	name() string
+	write(w *bufio.Writer)
+}
+
+// Registry holds the metrics exposed together
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, existing := range r.collectors {
+		if existing.name() == c.name() {
+			panic("metrics: " + c.name() + " is registered twice")
+		}
+	}
+	r.collectors = append(r.collectors, c)
+}
+
+// WriteTo writes every metric in the text exposition format, sorted by name
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	collectors := slices.Clone(r.collectors)
+	r.mu.Unlock()
+	slices.SortFunc(collectors, func(a, b collector) int { return strings.Compare(a.name(), b.name()) })
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, c := range collectors {
+		c.write(bw)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// ContentType is the media type of the exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// family holds what all metric types share: a name, help text, label
+// names and one series per combination of label values
+type family[S any] struct {
+	metricName string
+	help       string
+	kind       string
+	labels     []string
+	newSeries  func() *S
+
+	mu     sync.RWMutex
+	series map[string]*S // keyed by the joined label values
+}
+
+func newFamily[S any](name, help, kind string, labels []string, newSeries func() *S) *family[S] {
+	return &family[S]{
+		metricName: name,
+		help:       help,
+		kind:       kind,
+		labels:     labels,
+		newSeries:  newSeries,
+		series:     make(map[string]*S),
+	}
+}
+
+func (f *family[S]) name() string {
+	return f.metricName
+}
+
+// with returns the series of the label values, creating it if needed
+func (f *family[S]) with(values []string) *S {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", f.metricName, len(f.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+
+	f.mu.RLock()
+	s, ok := f.series[key]
+	f.mu.RUnlock()
+	if ok {
+		return s
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if s, ok := f.series[key]; ok {
+		return s
+	}
+	s = f.newSeries()
+	f.series[key] = s
+	return s
+}
+
+// each calls fn for every series in a stable order
+func (f *family[S]) each(fn func(labels string, s *S)) {
+	f.mu.RLock()
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	f.mu.RUnlock()
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		f.mu.RLock()
+		s := f.series[key]
+		f.mu.RUnlock()
+		var values []string
+		if len(f.labels) > 0 {
+			values = strings.Split(key, "\xff")
+		}
+		fn(formatLabels(f.labels, values), s)
+	}
+}
+
+func (f *family[S]) writeHeader(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", f.metricName, escapeHelp(f.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.metricName, f.kind)
+}
+
+// Counter is a value that only goes up
+type Counter struct {
+	bits atomic.Uint64
+}
+
+// Inc adds 1
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add adds v, which must not be negative
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		panic("metrics: counters cannot decrease")
+	}
+	addFloat(&c.bits, v)
+}
+
+func (c *Counter) value() float64 {
+	return math.Float64frombits(c.bits.Load())
+}
+
+// CounterVec is a counter with labels
+type CounterVec struct {
+	*family[Counter]
+}
+
+// NewCounterVec creates a counter with the given label names and registers it in Default
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	v := &CounterVec{newFamily(name, help, "counter", labels, func() *Counter { return &Counter{} })}
+	Default.register(v)
+	return v
+}
+
+// With returns the counter of the label values, in the order of the label names
+func (v *CounterVec) With(values ...string) *Counter {
+	return v.with(values)
+}
+
+func (v *CounterVec) write(w *bufio.Writer) {
+	v.writeHeader(w)
+	v.each(func(labels string, c *Counter) {
+		writeSample(w, v.metricName, labels, c.value())
+	})
+}
+
+// Gauge is a value that goes up and down
+type Gauge struct {
+	bits atomic.Uint64
+}
+
+// Set replaces the value
+func (g *Gauge) Set(v float64) {
+	g.bits.Store(math.Float64bits(v))
+}
+
+// Inc adds 1
+func (g *Gauge) Inc() {
+	addFloat(&g.bits, 1)
+}
+
+// Dec subtracts 1
+func (g *Gauge) Dec() {
+	addFloat(&g.bits, -1)
+}
+
+func (g *Gauge) value() float64 {
+	return math.Float64frombits(g.bits.Load())
+}
+
+// GaugeVec is a gauge with labels
+type GaugeVec struct {
+	*family[Gauge]
+}
+
+// NewGaugeVec creates a gauge with the given label names and registers it in Default
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	v := &GaugeVec{newFamily(name, help, "gauge", labels, func() *Gauge { return &Gauge{} })}
+	Default.register(v)
+	return v
+}
+
+// With returns the gauge of the label values, in the order of the label names
+func (v *GaugeVec) With(values ...string) *Gauge {
+	return v.with(values)
+}
+
+func (v *GaugeVec) write(w *bufio.Writer) {
+	v.writeHeader(w)
+	v.each(func(labels string, g *Gauge) {
+		writeSample(w, v.metricName, labels, g.value())
+	})
+}
+
+// NewGauge creates a gauge without labels and registers it in Default
+func NewGauge(name, help string) *Gauge {
+	return NewGaugeVec(name, help).With()
+}
+
+// funcMetric is a counter or gauge whose value is read when it is written,
+// for values kept elsewhere
+type funcMetric struct {
+	metricName string
+	help       string
+	kind       string
+	value      func() float64
+}
+
+// NewGaugeFunc registers a gauge whose value is read from fn at each scrape
+func NewGaugeFunc(name, help string, fn func() float64) {
+	Default.register(&funcMetric{metricName: name, help: help, kind: "gauge", value: fn})
+}
+
+// NewCounterFunc registers a counter whose value is read from fn at each scrape
+func NewCounterFunc(name, help string, fn func() float64) {
+	Default.register(&funcMetric{metricName: name, help: help, kind: "counter", value: fn})
+}
+
+func (m *funcMetric) name() string {
+	return m.metricName
+}
+
+func (m *funcMetric) write(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", m.metricName, escapeHelp(m.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", m.metricName, m.kind)
+	writeSample(w, m.metricName, "", m.value())
+}
+
+// Histogram counts observations in buckets
+type Histogram struct {
+	bounds []float64
+	mu     sync.Mutex
+	counts []uint64 // per bucket, not cumulative; the last one is +Inf
+	sum    float64
+	count  uint64
+}
+
+// Observe records a value, e.g. a duration in seconds
+func (h *Histogram) Observe(v float64) {
+	i, _ := slices.BinarySearch(h.bounds, v)
+	h.mu.Lock()
+	h.counts[i]++
+	h.sum += v
+	h.count++
+	h.mu.Unlock()
+}
+
+// HistogramVec is a histogram with labels
+type HistogramVec struct {
+	*family[Histogram]
+	bounds []float64
+}
+
+// NewHistogramVec creates a histogram with the given bucket upper bounds,
+// in increasing order, and label names, and registers it in Default
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if !slices.IsSorted(buckets) {
+		panic("metrics: buckets of " + name + " are not sorted")
+	}
+	v := &HistogramVec{bounds: buckets}
+	v.family = newFamily(name, help, "histogram", labels, func() *Histogram {
+		return &Histogram{bounds: buckets, counts: make([]uint64, len(buckets)+1)}
+	})
+	Default.register(v)
+	return v
+}
+
+// With returns the histogram of the label values, in the order of the label names
+func (v *HistogramVec) With(values ...string) *Histogram {
+	return v.with(values)
+}
+
+func (v *HistogramVec) write(w *bufio.Writer) {
+	v.writeHeader(w)
+	v.each(func(labels string, h *Histogram) {
+		h.mu.Lock()
+		counts := slices.Clone(h.counts)
+		sum, count := h.sum, h.count
+		h.mu.Unlock()
+
+		var cumulative uint64
+		for i, bound := range v.bounds {
+			cumulative += counts[i]
+			writeSample(w, v.metricName+"_bucket", withLabel(labels, "le", formatFloat(bound)), float64(cumulative))
+		}
+		writeSample(w, v.metricName+"_bucket", withLabel(labels, "le", "+Inf"), float64(count))
+		writeSample(w, v.metricName+"_sum", labels, sum)
+		writeSample(w, v.metricName+"_count", labels, float64(count))
+	})
+}
+
+func addFloat(bits *atomic.Uint64, delta float64) {
+	for {
+		old := bits.Load()
+		updated := math.Float64bits(math.Float64frombits(old) + delta)
+		if bits.CompareAndSwap(old, updated) {
+			return
+		}
+	}
+}
+
+func writeSample(w *bufio.Writer, name, labels string, value float64) {
+	w.WriteString(name)
+	if labels != "" {
+		w.WriteString("{" + labels + "}")
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+// formatLabels renders label pairs without the braces: a="1",b="2"
+func formatLabels(names, values []string) string {
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + escapeLabel(values[i]) + `"`
+	}
+	return strings.Join(pairs, ",")
+}
+
+func withLabel(labels, name, value string) string {
+	pair := name + `="` + value + `"`
+	if labels == "" {
+		return pair
+	}
+	return labels + "," + pair
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,183 @@
+package metrics
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+// useRegistry makes the constructors register in a new registry for the
+// rest of the test
+func useRegistry(t *testing.T) *Registry {
+	t.Helper()
+	saved := Default
+	Default = NewRegistry()
+	t.Cleanup(func() { Default = saved })
+	return Default
+}
+
+func exposition(t *testing.T, r *Registry) string {
+	t.Helper()
+	var b strings.Builder
+	n, err := r.WriteTo(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(b.Len()) {
+		t.Errorf("WriteTo() = %d, wrote %d bytes", n, b.Len())
+	}
+	return b.String()
+}
+
+func TestCounterAndGauge(t *testing.T) {
+	r := useRegistry(t)
+
+	requests := NewCounterVec("requests_total", "Requests handled.", "route", "status")
+	requests.With("/b", "200").Inc()
+	requests.With("/a", "500").Add(2.5)
+	requests.With("/a", "200").Inc()
+	requests.With("/a", "200").Inc()
+	NewCounterVec("unused_total", "Nothing observed yet.", "route")
+
+	streams := NewGauge("active_streams", "Streams open.")
+	streams.Inc()
+	streams.Inc()
+	streams.Dec()
+	queue := NewGaugeVec("queue_length", "Queued jobs.", "queue")
+	queue.With("email").Set(-3)
+
+	want := `# HELP active_streams Streams open.
+# TYPE active_streams gauge
+active_streams 1
+# HELP queue_length Queued jobs.
+# TYPE queue_length gauge
+queue_length{queue="email"} -3
+# HELP requests_total Requests handled.
+# TYPE requests_total counter
+requests_total{route="/a",status="200"} 2
+requests_total{route="/a",status="500"} 2.5
+requests_total{route="/b",status="200"} 1
+# HELP unused_total Nothing observed yet.
+# TYPE unused_total counter
+`
+	if got := exposition(t, r); got != want {
+		t.Errorf("WriteTo() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestEscaping(t *testing.T) {
+	r := useRegistry(t)
+
+	errs := NewCounterVec("errors_total", "Errors by message.\nBackslashes \\ and \"quotes\" stay.", "message")
+	errs.With(`path C:\tmp`).Inc()
+	errs.With("two\nlines").Inc()
+	errs.With(`say "hi"`).Inc()
+
+	want := `# HELP errors_total Errors by message.\nBackslashes \\ and "quotes" stay.
+# TYPE errors_total counter
+errors_total{message="path C:\\tmp"} 1
+errors_total{message="say \"hi\""} 1
+errors_total{message="two\nlines"} 1
+`
+	if got := exposition(t, r); got != want {
+		t.Errorf("WriteTo() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	r := useRegistry(t)
+
+	duration := NewHistogramVec("duration_seconds", "Time taken.", []float64{0.1, 1, 10}, "route")
+	for _, v := range []float64{0.05, 0.1, 0.5, 3, 20} {
+		duration.With("/a").Observe(v)
+	}
+	duration.With("/b").Observe(math.Inf(1))
+	NewHistogramVec("empty_seconds", "No observations.", []float64{1})
+	NewHistogramVec("size_bytes", "Without labels.", []float64{1024}).With().Observe(512)
+
+	want := `# HELP duration_seconds Time taken.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{route="/a",le="0.1"} 2
+duration_seconds_bucket{route="/a",le="1"} 3
+duration_seconds_bucket{route="/a",le="10"} 4
+duration_seconds_bucket{route="/a",le="+Inf"} 5
+duration_seconds_sum{route="/a"} 23.65
+duration_seconds_count{route="/a"} 5
+duration_seconds_bucket{route="/b",le="0.1"} 0
+duration_seconds_bucket{route="/b",le="1"} 0
+duration_seconds_bucket{route="/b",le="10"} 0
+duration_seconds_bucket{route="/b",le="+Inf"} 1
+duration_seconds_sum{route="/b"} +Inf
+duration_seconds_count{route="/b"} 1
+# HELP empty_seconds No observations.
+# TYPE empty_seconds histogram
+# HELP size_bytes Without labels.
+# TYPE size_bytes histogram
+size_bytes_bucket{le="1024"} 1
+size_bytes_bucket{le="+Inf"} 1
+size_bytes_sum 512
+size_bytes_count 1
+`
+	if got := exposition(t, r); got != want {
+		t.Errorf("WriteTo() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestFuncMetrics(t *testing.T) {
+	r := useRegistry(t)
+
+	open := 3.0
+	NewGaugeFunc("connections_open", "Open connections.", func() float64 { return open })
+	waits := 0.0
+	NewCounterFunc("connection_waits_total", "Waits for a connection.", func() float64 { return waits })
+
+	want := `# HELP connection_waits_total Waits for a connection.
+# TYPE connection_waits_total counter
+connection_waits_total 0
+# HELP connections_open Open connections.
+# TYPE connections_open gauge
+connections_open 3
+`
+	if got := exposition(t, r); got != want {
+		t.Errorf("WriteTo() =\n%s\nwant\n%s", got, want)
+	}
+
+	// The functions are read again at every scrape
+	open, waits = 1, 7
+	got := exposition(t, r)
+	if !strings.Contains(got, "\nconnections_open 1\n") || !strings.Contains(got, "\nconnection_waits_total 7\n") {
+		t.Errorf("second WriteTo() =\n%s\nwant the updated values", got)
+	}
+}
+
+func TestMisuse(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func()
+	}{
+		{"name registered twice", func() {
+			NewCounterVec("twice_total", "First.")
+			NewGaugeFunc("twice_total", "Second.", func() float64 { return 0 })
+		}},
+		{"wrong number of label values", func() {
+			NewCounterVec("labeled_total", "Labeled.", "route", "status").With("/a")
+		}},
+		{"negative counter increment", func() {
+			NewCounterVec("negative_total", "Negative.").With().Add(-1)
+		}},
+		{"unsorted buckets", func() {
+			NewHistogramVec("unsorted_seconds", "Unsorted.", []float64{1, 0.5})
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			useRegistry(t)
+			defer func() {
+				if recover() == nil {
+					t.Error("no panic")
+				}
+			}()
+			tt.fn()
+		})
+	}
+}
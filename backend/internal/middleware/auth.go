@@ -1,49 +1,109 @@
 package middleware
 
 import (
+	"errors"
 	"strings"
 
 	"backend/internal/auth"
+	"backend/internal/database"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-// AuthMiddleware validates JWT tokens and protects routes
-func AuthMiddleware() fiber.Handler {
+const principalKey = "principal"
+
+// GetPrincipal returns the principal stored by AuthMiddleware.
+// ok is false when the route is not behind AuthMiddleware.
+func GetPrincipal(c *fiber.Ctx) (principal *auth.Principal, ok bool) {
+	principal, ok = c.Locals(principalKey).(*auth.Principal)
+	return principal, ok && principal != nil
+}
+
+// AuthMiddleware validates session JWTs and personal access tokens and
+// protects routes
+func AuthMiddleware(db database.Service) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		// Get Authorization header
 		authHeader := c.Get("Authorization")
 		if authHeader == "" {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"success": false,
-				"message": "Missing authorization token",
-			})
+			return fiber.NewError(fiber.StatusUnauthorized, "Missing authorization token")
 		}
 
 		// Extract token from "Bearer <token>"
 		parts := strings.Split(authHeader, " ")
 		if len(parts) != 2 || parts[0] != "Bearer" {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"success": false,
-				"message": "Invalid authorization format. Use: Bearer <token>",
-			})
+			return fiber.NewError(fiber.StatusUnauthorized, "Invalid authorization format. Use: Bearer <token>")
 		}
 
 		tokenString := parts[1]
 
-		// Validate token
-		claims, err := auth.ValidateToken(tokenString)
-		if err != nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-				"success": false,
-				"message": "Invalid or expired token",
-			})
+		var principal *auth.Principal
+		var user *database.User
+		if auth.IsAccessToken(tokenString) {
+			// Personal access tokens are looked up by hash and carry no claims
+			token, err := db.UseAccessToken(c.UserContext(), auth.HashAccessToken(tokenString))
+			if err == nil {
+				user, err = db.GetUserByID(c.UserContext(), token.UserID)
+			}
+			if errors.Is(err, database.ErrNotFound) {
+				return fiber.NewError(fiber.StatusUnauthorized, "Invalid or expired token")
+			}
+			if err != nil {
+				return err
+			}
+			principal = &auth.Principal{
+				UserID:  user.ID,
+				Email:   user.Email,
+				Role:    auth.Role(user.Role),
+				TokenID: token.ID,
+			}
+		} else {
+			// Validate token
+			claims, err := auth.ValidateToken(tokenString)
+			if err != nil {
+				return fiber.NewError(fiber.StatusUnauthorized, "Invalid or expired token")
+			}
+
+			// Reject tokens of revoked sessions
+			user, err = db.GetUserByID(c.UserContext(), claims.UserID)
+			if err != nil && !errors.Is(err, database.ErrNotFound) {
+				return err
+			}
+			if err != nil || user.TokenVersion != claims.TokenVersion {
+				return fiber.NewError(fiber.StatusUnauthorized, "Invalid or expired token")
+			}
+			principal = &auth.Principal{
+				UserID: claims.UserID,
+				Email:  claims.Email,
+				Role:   claims.Role,
+			}
 		}
 
-		// Store user info in context for handlers to use
-		c.Locals("userID", claims.UserID)
-		c.Locals("email", claims.Email)
+		if user.DisabledAt != nil {
+			return fiber.NewError(fiber.StatusForbidden, "Account is disabled")
+		}
+
+		// Store the principal in context for handlers to use
+		c.Locals(principalKey, principal)
 
 		return c.Next()
 	}
 }
+
+// RequireRole only lets requests through when the authenticated user has one
+// of the given roles. It must run after AuthMiddleware. Personal access
+// tokens never pass: they are made for editor integrations, and a leaked
+// one must not give access to privileged routes.
+func RequireRole(roles ...auth.Role) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		principal, ok := GetPrincipal(c)
+		if ok && principal.TokenID != 0 {
+			return fiber.NewError(fiber.StatusForbidden, "Personal access tokens cannot be used for this route")
+		}
+		if ok && principal.HasRole(roles...) {
+			return c.Next()
+		}
+
+		return fiber.NewError(fiber.StatusForbidden, "Insufficient permissions")
+	}
+}
@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+
+	"backend/internal/logging"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+)
+
+// requestIDPattern is what a request ID sent by a client or proxy must look
+// like to be kept; anything else is replaced, so IDs are safe to log
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestID tags every request with an ID, returned in the X-Request-ID
+// header. An ID sent in the request header is reused, which lets callers
+// correlate their logs with ours. The ID is added to the user context, so
+// handlers must pass c.UserContext() to what they call for it to be logged.
+func RequestID() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := c.Get(fiber.HeaderXRequestID)
+		if !requestIDPattern.MatchString(id) {
+			id = utils.UUIDv4()
+		}
+
+		c.Set(fiber.HeaderXRequestID, id)
+		c.SetUserContext(logging.WithRequestID(c.UserContext(), id))
+
+		return c.Next()
+	}
+}
+
+// Logger logs every request once it has been handled: method, route,
+// status, latency and the authenticated user. It must run after RequestID.
+// Errors are written by the app's error handler first, so the status
+// logged is the one the client receives.
+func Logger() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+
+		if err := c.Next(); err != nil {
+			if err := c.App().ErrorHandler(c, err); err != nil {
+				_ = c.SendStatus(fiber.StatusInternalServerError)
+			}
+		}
+
+		status := c.Response().StatusCode()
+		level := slog.LevelInfo
+		switch {
+		case status >= fiber.StatusInternalServerError:
+			level = slog.LevelError
+		case status >= fiber.StatusBadRequest:
+			level = slog.LevelWarn
+		}
+
+		// Share links carry their credential in the path
+		path := c.Path()
+		if token := c.Params("token"); token != "" {
+			path = strings.Replace(path, token, "[REDACTED]", 1)
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", c.Method()),
+			slog.String("path", path),
+			slog.String("route", c.Route().Path),
+			slog.Int("status", status),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("ip", c.IP()),
+		}
+		if principal, ok := GetPrincipal(c); ok {
+			attrs = append(attrs, slog.Int("user_id", principal.UserID))
+		}
+
+		slog.LogAttrs(c.UserContext(), level, "Request handled", attrs...)
+		return nil
+	}
+}
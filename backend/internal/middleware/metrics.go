@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"strconv"
+	"time"
+
+	"backend/internal/metrics"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var (
+	httpRequests = metrics.NewCounterVec("http_requests_total",
+		"HTTP requests handled, by method, route and status.", "method", "route", "status")
+	httpRequestDuration = metrics.NewHistogramVec("http_request_duration_seconds",
+		"Time to handle HTTP requests, by method, route and status.", metrics.DefaultBuckets, "method", "route", "status")
+)
+
+// Metrics counts requests and measures how long they take, by route
+// pattern rather than path so IDs don't multiply the series. Errors are
+// written by the app's error handler first, so the status counted is the
+// one the client receives. Streamed responses are measured until their
+// headers are sent.
+func Metrics() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+
+		if err := c.Next(); err != nil {
+			if err := c.App().ErrorHandler(c, err); err != nil {
+				_ = c.SendStatus(fiber.StatusInternalServerError)
+			}
+		}
+
+		labels := []string{c.Method(), c.Route().Path, strconv.Itoa(c.Response().StatusCode())}
+		httpRequests.With(labels...).Inc()
+		httpRequestDuration.With(labels...).Observe(time.Since(start).Seconds())
+		return nil
+	}
+}
+
+// MetricsHandler serves the metrics in the Prometheus text format. When
+// token is set, scrapers must send it as a bearer token.
+func MetricsHandler(token string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		given := []byte(c.Get(fiber.HeaderAuthorization))
+		if token != "" && subtle.ConstantTimeCompare(given, []byte("Bearer "+token)) != 1 {
+			return fiber.NewError(fiber.StatusUnauthorized, "Invalid metrics token")
+		}
+
+		c.Set(fiber.HeaderContentType, metrics.ContentType)
+		_, err := metrics.Default.WriteTo(c)
+		return err
+	}
+}
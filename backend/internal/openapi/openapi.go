@@ -0,0 +1,444 @@
+// Package openapi generates an OpenAPI 3 document for the API from the
+// registered routes and the Go types of their request and response bodies,
+// so the document can't drift from the handlers.
+package openapi
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DocsPage is an HTML page rendering the document, served next to it as
+// openapi.json
+//
+//go:embed docs.html
+var DocsPage []byte
+
+// Operation documents a route. Request and Response hold a value of the
+// body type (usually its zero value), which is turned into a schema.
+type Operation struct {
+	Method      string
+	Path        string // as registered, e.g. /api/v1/chats/:id
+	Tag         string
+	Summary     string
+	Description string
+	Public      bool     // no authentication required
+	Roles       []string // roles allowed, when restricted
+	Query       []Param
+	Request     any    // JSON request body, nil for none
+	Response    any    // data of the response envelope, nil when it only has a message
+	Paginated   bool   // the envelope has a nextCursor
+	Unwrapped   bool   // Response is the whole body rather than the data of an envelope
+	Status      int    // success status, 200 by default
+	ContentType string // non-JSON response, e.g. text/event-stream; Response is then ignored
+}
+
+type Param struct {
+	Name        string
+	Type        string // integer, boolean or string (the default)
+	Description string
+	Required    bool
+}
+
+// Route is a registered route
+type Route struct {
+	Method string
+	Path   string
+}
+
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Servers    []Server             `json:"servers,omitempty"`
+	Tags       []Tag                `json:"tags,omitempty"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type Server struct {
+	URL string `json:"url"`
+}
+
+type Tag struct {
+	Name string `json:"name"`
+}
+
+// PathItem maps lowercase HTTP methods to operations
+type PathItem map[string]*OperationObject
+
+type OperationObject struct {
+	Tags        []string              `json:"tags,omitempty"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	OperationID string                `json:"operationId"`
+	Parameters  []ParameterObject     `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []map[string][]string `json:"security"`
+}
+
+type ParameterObject struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes"`
+}
+
+type SecurityScheme struct {
+	Type        string `json:"type"`
+	Scheme      string `json:"scheme"`
+	Description string `json:"description,omitempty"`
+}
+
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+const bearerAuth = "bearerAuth"
+
+var pathParam = regexp.MustCompile(`:([A-Za-z0-9_]+)\??`)
+
+// Build generates the document for the routes. Routes without an
+// operation are still listed, as undocumented, and returned so callers
+// can report them.
+func Build(info Info, routes []Route, ops []Operation) (*Document, []Route) {
+	doc := &Document{
+		OpenAPI: "3.0.3",
+		Info:    info,
+		Paths:   map[string]*PathItem{},
+		Components: Components{
+			Schemas: map[string]*Schema{},
+			SecuritySchemes: map[string]SecurityScheme{
+				bearerAuth: {
+					Type:        "http",
+					Scheme:      "bearer",
+					Description: "A session token from /api/v1/auth/login, or a personal access token (cgc_pat_...)",
+				},
+			},
+		},
+	}
+	g := &generator{schemas: doc.Components.Schemas}
+	doc.Components.Schemas["Error"] = errorSchema()
+
+	documented := map[Route]Operation{}
+	for _, op := range ops {
+		documented[Route{op.Method, op.Path}] = op
+	}
+
+	var undocumented []Route
+	seen := map[Route]bool{}
+	tags := map[string]bool{}
+	for _, route := range routes {
+		// Fiber registers HEAD along with every GET
+		if route.Method == http.MethodHead || seen[route] {
+			continue
+		}
+		seen[route] = true
+
+		op, ok := documented[route]
+		if !ok {
+			undocumented = append(undocumented, route)
+			op = Operation{Method: route.Method, Path: route.Path, Tag: "undocumented", Summary: "Undocumented"}
+		}
+		tags[op.Tag] = true
+
+		path := pathParam.ReplaceAllString(route.Path, "{$1}")
+		item, ok := doc.Paths[path]
+		if !ok {
+			item = &PathItem{}
+			doc.Paths[path] = item
+		}
+		(*item)[strings.ToLower(route.Method)] = g.operation(op)
+	}
+
+	for tag := range tags {
+		doc.Tags = append(doc.Tags, Tag{Name: tag})
+	}
+	sort.Slice(doc.Tags, func(i, j int) bool { return doc.Tags[i].Name < doc.Tags[j].Name })
+
+	return doc, undocumented
+}
+
+// generator turns operations and Go types into OpenAPI objects, collecting
+// named struct types as components
+type generator struct {
+	schemas map[string]*Schema
+	names   map[reflect.Type]string
+}
+
+func (g *generator) operation(op Operation) *OperationObject {
+	obj := &OperationObject{
+		Summary:     op.Summary,
+		Description: op.Description,
+		OperationID: operationID(op.Method, op.Path),
+		Responses:   map[string]*Response{},
+		Security:    []map[string][]string{{bearerAuth: {}}},
+	}
+	if op.Tag != "" {
+		obj.Tags = []string{op.Tag}
+	}
+	if op.Public {
+		obj.Security = []map[string][]string{}
+	}
+	if len(op.Roles) > 0 {
+		obj.Description = strings.TrimSpace(obj.Description + "\n\nRequires one of the roles: " + strings.Join(op.Roles, ", ") + ", and a session token.")
+	}
+
+	for _, match := range pathParam.FindAllStringSubmatch(op.Path, -1) {
+		schema := &Schema{Type: "integer"}
+		// Tokens are the only path parameters that aren't IDs
+		if strings.HasSuffix(strings.ToLower(match[1]), "token") {
+			schema = &Schema{Type: "string"}
+		}
+		obj.Parameters = append(obj.Parameters, ParameterObject{Name: match[1], In: "path", Required: true, Schema: schema})
+	}
+	for _, param := range op.Query {
+		typ := param.Type
+		if typ == "" {
+			typ = "string"
+		}
+		obj.Parameters = append(obj.Parameters, ParameterObject{
+			Name:        param.Name,
+			In:          "query",
+			Description: param.Description,
+			Required:    param.Required,
+			Schema:      &Schema{Type: typ},
+		})
+	}
+
+	if op.Request != nil {
+		obj.RequestBody = &RequestBody{
+			Required: true,
+			Content:  map[string]MediaType{"application/json": {Schema: g.schema(reflect.TypeOf(op.Request))}},
+		}
+	}
+
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	success := &Response{Description: http.StatusText(status)}
+	if op.ContentType != "" {
+		success.Content = map[string]MediaType{op.ContentType: {Schema: &Schema{Type: "string"}}}
+	} else if op.Unwrapped {
+		success.Content = map[string]MediaType{"application/json": {Schema: g.schema(reflect.TypeOf(op.Response))}}
+	} else {
+		success.Content = map[string]MediaType{"application/json": {Schema: g.envelope(op)}}
+	}
+	obj.Responses[fmt.Sprint(status)] = success
+	obj.Responses["default"] = &Response{
+		Description: "Error",
+		Content:     map[string]MediaType{"application/json": {Schema: &Schema{Ref: "#/components/schemas/Error"}}},
+	}
+	return obj
+}
+
+// envelope is the {success, message, data} wrapper of a successful response
+func (g *generator) envelope(op Operation) *Schema {
+	schema := &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"success": {Type: "boolean", Enum: []any{true}},
+			"message": {Type: "string"},
+		},
+		Required: []string{"success"},
+	}
+	if op.Response != nil {
+		schema.Properties["data"] = g.schema(reflect.TypeOf(op.Response))
+		schema.Required = append(schema.Required, "data")
+	}
+	if op.Paginated {
+		schema.Properties["nextCursor"] = &Schema{Type: "string", Description: "Cursor of the next page, empty on the last page"}
+	}
+	return schema
+}
+
+func errorSchema() *Schema {
+	return &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"success": {Type: "boolean", Enum: []any{false}},
+			"error": {
+				Type: "object",
+				Properties: map[string]*Schema{
+					"code":      {Type: "string", Description: `Machine-readable error code, e.g. "not_found" or "forbidden"`},
+					"message":   {Type: "string"},
+					"details":   {Description: "More about the error, such as the fields that failed validation"},
+					"requestId": {Type: "string", Description: "ID of the request, also sent in the X-Request-ID header"},
+				},
+				Required: []string{"code", "message"},
+			},
+		},
+		Required: []string{"success", "error"},
+	}
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// schema describes a Go type the way encoding/json encodes it
+func (g *generator) schema(t reflect.Type) *Schema {
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case rawMessageType:
+		return &Schema{Description: "Any JSON value"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		schema := g.schema(t.Elem())
+		if schema.Ref != "" {
+			// Siblings of $ref are ignored in OpenAPI 3.0
+			return schema
+		}
+		schema.Nullable = true
+		return schema
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		return g.ref(t)
+	}
+	// Interfaces can hold anything
+	return &Schema{}
+}
+
+// ref adds a named struct type to the components and refers to it
+func (g *generator) ref(t reflect.Type) *Schema {
+	if g.names == nil {
+		g.names = map[reflect.Type]string{}
+	}
+	name, ok := g.names[t]
+	if !ok {
+		name = t.Name()
+		// Types of different packages may share a name
+		for i := 2; g.schemas[name] != nil; i++ {
+			name = fmt.Sprintf("%s%d", t.Name(), i)
+		}
+		g.names[t] = name
+		g.schemas[name] = &Schema{} // placeholder for recursive types
+		g.schemas[name] = g.object(t)
+	}
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+func (g *generator) object(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	g.fields(t, schema)
+	return schema
+}
+
+// fields adds the JSON fields of a struct, including promoted ones
+func (g *generator) fields(t reflect.Type, schema *Schema) {
+	for i := range t.NumField() {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				g.fields(embedded, schema)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		schema.Properties[name] = g.schema(field.Type)
+		if !slices.Contains(strings.Split(opts, ","), "omitempty") && field.Type.Kind() != reflect.Pointer {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+}
+
+// operationID derives an ID like getChatsById from a method and path
+func operationID(method, path string) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(method))
+	for _, segment := range strings.Split(strings.TrimPrefix(path, "/api/v1"), "/") {
+		if segment == "" {
+			continue
+		}
+		by := strings.HasPrefix(segment, ":")
+		segment = strings.TrimSuffix(strings.TrimPrefix(segment, ":"), "?")
+		if by {
+			b.WriteString("By")
+		}
+		for _, word := range strings.FieldsFunc(segment, func(r rune) bool { return r == '-' || r == '_' || r == '.' }) {
+			b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+		}
+	}
+	return b.String()
+}
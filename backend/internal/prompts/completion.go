@@ -0,0 +1,69 @@
+package prompts
+
+import "strings"
+
+// cursorMarker marks the insertion point in completion prompts
+const cursorMarker = "<CURSOR>"
+
+// CompletionInput is the code around the cursor of an inline completion
+type CompletionInput struct {
+	Prefix   string // text before the cursor
+	Suffix   string // text after the cursor
+	Language string
+	FilePath string
+}
+
+// Completion renders the fill-in-the-middle prompt of an inline completion
+func Completion(in CompletionInput) Template {
+	var b strings.Builder
+	if in.FilePath != "" {
+		b.WriteString("File: " + in.FilePath + "\n")
+	}
+	if in.Language != "" {
+		b.WriteString("Language: " + in.Language + "\n")
+	}
+	b.WriteString("\n")
+	b.WriteString(in.Prefix)
+	b.WriteString(cursorMarker)
+	b.WriteString(in.Suffix)
+
+	return Template{
+		System: "You are the code completion engine of an editor. The file is shown with the cursor marked as " +
+			cursorMarker + ". Reply with only the text to insert at the cursor, exactly as it should be typed: " +
+			"no explanations, no markdown fences, and without repeating code before or after the cursor. " +
+			"Prefer short completions that finish the current line, statement or block. " +
+			"Reply with nothing if no completion makes sense.",
+		Prompt: b.String(),
+	}
+}
+
+// CleanCompletion trims a completion to what should be inserted: markdown
+// fences are removed, the text is cut at the first stop sequence, and text
+// repeating the start of the suffix is dropped. Whitespace is significant
+// and kept.
+func CleanCompletion(text string, in CompletionInput, stop []string) string {
+	if strings.HasPrefix(strings.TrimSpace(text), "```") {
+		text = CleanCode(text)
+	}
+	text = strings.ReplaceAll(text, cursorMarker, "")
+
+	for _, s := range stop {
+		if i := strings.Index(text, s); s != "" && i >= 0 {
+			text = text[:i]
+		}
+	}
+
+	// Models often close brackets the suffix already closes
+	for n := min(len(text), len(in.Suffix)); n > 0; n-- {
+		overlap := in.Suffix[:n]
+		if strings.TrimSpace(overlap) != "" && strings.HasSuffix(text, overlap) {
+			text = text[:len(text)-n]
+			break
+		}
+	}
+
+	if strings.TrimSpace(text) == "" {
+		return ""
+	}
+	return text
+}
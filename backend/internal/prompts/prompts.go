@@ -0,0 +1,209 @@
+// Package prompts holds the prompt templates of the task modes the
+// assistant supports and parses the structured replies they ask for.
+package prompts
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Mode is the kind of task a prompt asks for
+type Mode string
+
+const (
+	ModeGenerate  Mode = "generate"  // write code for a description
+	ModeExplain   Mode = "explain"   // explain a code block
+	ModeRefactor  Mode = "refactor"  // rewrite a code block following an instruction
+	ModeReview    Mode = "review"    // find bugs and security issues in a code block
+	ModeTests     Mode = "tests"     // write unit tests for a code block
+	ModeTranslate Mode = "translate" // port a code block to another language
+	ModeEdit      Mode = "edit"      // change a code block in place, replying with a diff
+)
+
+// Modes lists all modes
+var Modes = []Mode{ModeGenerate, ModeExplain, ModeRefactor, ModeReview, ModeTests, ModeTranslate, ModeEdit}
+
+// ParseMode validates a mode name, "" meaning ModeGenerate
+func ParseMode(name string) (Mode, error) {
+	if name == "" {
+		return ModeGenerate, nil
+	}
+	for _, mode := range Modes {
+		if string(mode) == name {
+			return mode, nil
+		}
+	}
+	return "", fmt.Errorf("unknown mode %q", name)
+}
+
+// Label is the human readable name of the mode
+func (m Mode) Label() string {
+	switch m {
+	case ModeExplain:
+		return "Explain"
+	case ModeRefactor:
+		return "Refactor"
+	case ModeReview:
+		return "Review"
+	case ModeTests:
+		return "Tests"
+	case ModeTranslate:
+		return "Translate"
+	case ModeEdit:
+		return "Edit"
+	}
+	return "Generate"
+}
+
+// Markdown reports whether replies of the mode are markdown prose rather
+// than code
+func (m Mode) Markdown() bool {
+	return m == ModeExplain || m == ModeReview
+}
+
+// Input is the task given by the user. Prompt and Language are stored in the
+// message itself, the rest as the message's JSON metadata.
+type Input struct {
+	Prompt          string `json:"-"`                         // description, instruction or question
+	Language        string `json:"-"`                         // language of the code
+	Code            string `json:"code,omitempty"`            // code to work on, optional context in generate mode
+	SourceMessageID *int   `json:"sourceMessageId,omitempty"` // reply Code was taken from, if any
+	TargetLanguage  string `json:"targetLanguage,omitempty"`  // translate only
+}
+
+// InputError is input a mode needs but is missing
+type InputError struct {
+	Field   string // JSON name of the request field, e.g. "targetLanguage"
+	Message string // e.g. "is required in explain mode"
+}
+
+func (e *InputError) Error() string {
+	return e.Field + " " + e.Message
+}
+
+// Validate reports input the mode needs but is missing as an *InputError
+func (m Mode) Validate(in Input) error {
+	switch m {
+	case ModeGenerate:
+		if strings.TrimSpace(in.Prompt) == "" {
+			return &InputError{Field: "prompt", Message: "is required"}
+		}
+		return nil
+	case ModeRefactor, ModeEdit:
+		if strings.TrimSpace(in.Prompt) == "" {
+			return &InputError{Field: "prompt", Message: fmt.Sprintf("is required to describe the change in %s mode", m)}
+		}
+	case ModeTranslate:
+		if strings.TrimSpace(in.TargetLanguage) == "" {
+			return &InputError{Field: "targetLanguage", Message: "is required"}
+		}
+	}
+	if strings.TrimSpace(in.Code) == "" {
+		return &InputError{Field: "code", Message: fmt.Sprintf("is required in %s mode", m)}
+	}
+	return nil
+}
+
+// Template is what the model is asked for a task
+type Template struct {
+	System string
+	Prompt string
+	JSON   bool // the reply is expected to be a JSON document, see Parse
+}
+
+// Build renders the prompt template of the mode
+func Build(m Mode, in Input) Template {
+	switch m {
+	case ModeExplain:
+		return Template{
+			System: "You are a senior engineer explaining code to a colleague. " +
+				"Be accurate and concrete, refer to identifiers from the code, and skip the obvious.\n" +
+				`Reply with a JSON object {"summary": string, "explanation": string} where ` +
+				"summary is one or two sentences and explanation walks through the code in markdown.",
+			Prompt: task(in, "Explain this code.", false, false),
+			JSON:   true,
+		}
+	case ModeRefactor:
+		return Template{
+			System: "You are a senior engineer refactoring code. Keep the behavior unless the " +
+				"instruction says otherwise and keep the code's style and public names.\n" +
+				`Reply with a JSON object {"code": string, "changes": [string]} where code is ` +
+				"the complete refactored code without markdown fences and changes lists what was changed.",
+			Prompt: task(in, "Refactor this code: "+in.Prompt, true, false),
+			JSON:   true,
+		}
+	case ModeReview:
+		return Template{
+			System: "You are a meticulous code reviewer looking for bugs, security issues, " +
+				"performance problems and maintainability concerns. Report real problems only.\n" +
+				`Reply with a JSON object {"summary": string, "findings": [{"line": number, ` +
+				`"endLine": number, "severity": string, "category": string, "message": string, ` +
+				`"suggestion": string}]}. Lines are the numbers shown in front of the code. ` +
+				"Severity is one of " + strings.Join(Severities, ", ") +
+				" and category one of " + strings.Join(Categories, ", ") + ".",
+			Prompt: task(in, "Review this code.", false, true),
+			JSON:   true,
+		}
+	case ModeTests:
+		return Template{
+			System: "You are a senior engineer writing unit tests. Use the standard or most " +
+				"common test framework of the language, cover edge cases and failure paths, " +
+				"and make the tests runnable as they are.\n" +
+				`Reply with a JSON object {"code": string, "framework": string, "cases": [string]} ` +
+				"where code is the test file without markdown fences and cases describes each test.",
+			Prompt: task(in, "Write unit tests for this code.", false, false),
+			JSON:   true,
+		}
+	case ModeTranslate:
+		return Template{
+			System: "You are an expert in many programming languages porting code between them. " +
+				"Write idiomatic code in the target language rather than a literal transcription.\n" +
+				`Reply with a JSON object {"code": string, "language": string, "notes": [string]} ` +
+				"where code is the translation without markdown fences and notes lists behavior " +
+				"that differs or needed a judgment call.",
+			Prompt: task(in, "Translate this code to "+in.TargetLanguage+".", false, false),
+			JSON:   true,
+		}
+	case ModeEdit:
+		return Template{
+			System: "You edit code by replying with a unified diff against the code you are given. " +
+				"Change only what the instruction asks for.\n" +
+				"Reply with the diff only, without explanations or markdown fences. Start each hunk " +
+				"with an @@ header giving its line numbers and keep three unchanged lines of context " +
+				"around each change. Context and removed lines must match the code exactly.",
+			Prompt: task(in, "Edit this code: "+in.Prompt, true, false),
+		}
+	}
+
+	prompt := fmt.Sprintf("Generate %s code for: %s. Return ONLY the raw code. Do not include markdown formatting, backticks, or any explanations.", in.Language, in.Prompt)
+	if strings.TrimSpace(in.Code) != "" {
+		prompt += "\n\nUse this existing code as context:\n\n```" + in.Language + "\n" + strings.TrimRight(in.Code, "\n") + "\n```"
+	}
+	return Template{Prompt: prompt}
+}
+
+// task renders the request about a code block. The user's prompt, if any,
+// is added as extra instructions unless promptIncluded says the request
+// already holds it. Numbered code has line numbers in front of each line.
+func task(in Input, request string, promptIncluded, numbered bool) string {
+	var b strings.Builder
+	b.WriteString(request)
+	if in.Prompt != "" && !promptIncluded {
+		b.WriteString("\n\n")
+		b.WriteString(in.Prompt)
+	}
+
+	b.WriteString("\n\n```")
+	b.WriteString(in.Language)
+	b.WriteString("\n")
+	if numbered {
+		for i, line := range strings.Split(strings.TrimRight(in.Code, "\n"), "\n") {
+			fmt.Fprintf(&b, "%4d| %s\n", i+1, line)
+		}
+	} else {
+		b.WriteString(strings.TrimRight(in.Code, "\n"))
+		b.WriteString("\n")
+	}
+	b.WriteString("```")
+	return b.String()
+}
@@ -0,0 +1,63 @@
+package prompts
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildIncludesPrompt(t *testing.T) {
+	code := "func add(a, b int) int { return a + b }"
+	tests := []struct {
+		name   string
+		mode   Mode
+		prompt string
+	}{
+		{"explain, prompt inside the request", ModeExplain, "code"},
+		{"explain, question", ModeExplain, "Why is there no overflow check?"},
+		{"review, prompt inside the request", ModeReview, "this"},
+		{"tests, prompt inside the request", ModeTests, "tests"},
+		{"tests, instruction", ModeTests, "Use table-driven tests."},
+		{"translate, prompt inside the request", ModeTranslate, "code to"},
+		{"refactor", ModeRefactor, "code"},
+		{"edit", ModeEdit, "Rename add to sum."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := Input{Prompt: tt.prompt, Language: "go", Code: code, TargetLanguage: "rust"}
+			prompt := Build(tt.mode, in).Prompt
+			request, _, _ := strings.Cut(prompt, "```")
+
+			// The prompt must appear exactly once, as its own paragraph
+			// or as the end of the request line
+			if !strings.Contains(request, tt.prompt) {
+				t.Fatalf("prompt %q missing from:\n%s", tt.prompt, prompt)
+			}
+			lines := strings.Split(strings.TrimSpace(request), "\n")
+			var found int
+			for _, line := range lines {
+				if line == tt.prompt || strings.HasSuffix(line, ": "+tt.prompt) {
+					found++
+				}
+			}
+			if found != 1 {
+				t.Errorf("prompt %q appears as an instruction %d times in:\n%s", tt.prompt, found, prompt)
+			}
+			if !strings.Contains(prompt, code) {
+				t.Errorf("code missing from:\n%s", prompt)
+			}
+		})
+	}
+}
+
+func TestBuildWithoutPrompt(t *testing.T) {
+	in := Input{Language: "go", Code: "x := 1"}
+	want := "Explain this code.\n\n```go\nx := 1\n```"
+	if got := Build(ModeExplain, in).Prompt; got != want {
+		t.Errorf("Build() = %q, want %q", got, want)
+	}
+
+	want = "Review this code.\n\n```go\n   1| x := 1\n```"
+	if got := Build(ModeReview, in).Prompt; got != want {
+		t.Errorf("Build() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,212 @@
+package prompts
+
+import (
+	"backend/internal/diff"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Severities of review findings, most severe first
+var Severities = []string{"critical", "high", "medium", "low", "info"}
+
+// Categories of review findings
+var Categories = []string{"bug", "security", "performance", "maintainability", "style"}
+
+// Result is the model's reply to a task
+type Result struct {
+	Content  string // readable reply: the code, or markdown for explain and review
+	Language string // language of the code in Content, "" if unchanged
+	Data     any    // structured reply, nil in generate mode
+}
+
+type Explanation struct {
+	Summary     string `json:"summary"`
+	Explanation string `json:"explanation"`
+}
+
+type Refactoring struct {
+	Code    string   `json:"code"`
+	Changes []string `json:"changes"`
+}
+
+type Review struct {
+	Summary  string    `json:"summary"`
+	Findings []Finding `json:"findings"`
+}
+
+// Finding is a problem found in review. Lines are 1-based and refer to the
+// reviewed code.
+type Finding struct {
+	Line       int    `json:"line"`
+	EndLine    int    `json:"endLine,omitempty"`
+	Severity   string `json:"severity"`
+	Category   string `json:"category"`
+	Message    string `json:"message"`
+	Suggestion string `json:"suggestion,omitempty"`
+}
+
+type TestSuite struct {
+	Code      string   `json:"code"`
+	Framework string   `json:"framework"`
+	Cases     []string `json:"cases"`
+}
+
+// Edit is an in-place change of a code block
+type Edit struct {
+	Diff      string `json:"diff"` // unified diff from the original code to the result, "" if unchanged
+	Additions int    `json:"additions"`
+	Deletions int    `json:"deletions"`
+}
+
+type Translation struct {
+	Code     string   `json:"code"`
+	Language string   `json:"language"`
+	Notes    []string `json:"notes"`
+}
+
+// Parse interprets the model's reply to a task of the mode
+func Parse(m Mode, in Input, text string) (*Result, error) {
+	switch m {
+	case ModeExplain:
+		var e Explanation
+		if err := decode(text, &e); err != nil {
+			return nil, err
+		}
+		content := strings.TrimSpace(e.Summary + "\n\n" + e.Explanation)
+		return &Result{Content: content, Data: e}, nil
+
+	case ModeRefactor:
+		var r Refactoring
+		if err := decode(text, &r); err != nil {
+			return nil, err
+		}
+		r.Code = CleanCode(r.Code)
+		return &Result{Content: r.Code, Data: r}, nil
+
+	case ModeReview:
+		var r Review
+		if err := decode(text, &r); err != nil {
+			return nil, err
+		}
+		r.Findings = normalizeFindings(r.Findings, strings.Count(strings.TrimRight(in.Code, "\n"), "\n")+1)
+		return &Result{Content: r.Markdown(), Data: r}, nil
+
+	case ModeTests:
+		var t TestSuite
+		if err := decode(text, &t); err != nil {
+			return nil, err
+		}
+		t.Code = CleanCode(t.Code)
+		return &Result{Content: t.Code, Data: t}, nil
+
+	case ModeTranslate:
+		var t Translation
+		if err := decode(text, &t); err != nil {
+			return nil, err
+		}
+		t.Code = CleanCode(t.Code)
+		if t.Language == "" {
+			t.Language = in.TargetLanguage
+		}
+		return &Result{Content: t.Code, Language: t.Language, Data: t}, nil
+
+	case ModeEdit:
+		// The diff must apply to the original code; it is stored in the
+		// canonical form produced by the diff package
+		patched, err := diff.Apply(in.Code, CleanCode(text))
+		if err != nil {
+			return nil, fmt.Errorf("model returned an invalid diff: %w", err)
+		}
+		e := Edit{Diff: diff.Unified("a/code", "b/code", in.Code, patched)}
+		for _, op := range diff.Lines(in.Code, patched) {
+			switch op.Kind {
+			case diff.Insert:
+				e.Additions++
+			case diff.Delete:
+				e.Deletions++
+			}
+		}
+		return &Result{Content: patched, Data: e}, nil
+	}
+
+	return &Result{Content: CleanCode(text)}, nil
+}
+
+// Markdown renders the review as a list of findings, most severe first
+func (r Review) Markdown() string {
+	var b strings.Builder
+	b.WriteString(strings.TrimSpace(r.Summary))
+	if len(r.Findings) == 0 {
+		b.WriteString("\n\nNo issues found.")
+		return strings.TrimSpace(b.String())
+	}
+
+	b.WriteString("\n")
+	for _, f := range r.Findings {
+		lines := fmt.Sprintf("line %d", f.Line)
+		if f.EndLine > f.Line {
+			lines = fmt.Sprintf("lines %d-%d", f.Line, f.EndLine)
+		}
+		fmt.Fprintf(&b, "\n- **%s** (%s, %s): %s", f.Severity, f.Category, lines, f.Message)
+		if f.Suggestion != "" {
+			fmt.Fprintf(&b, "\n  Suggestion: %s", f.Suggestion)
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// normalizeFindings clamps line numbers to the code, maps unknown severities
+// and categories to the closest safe value and sorts by severity
+func normalizeFindings(findings []Finding, lineCount int) []Finding {
+	for i := range findings {
+		f := &findings[i]
+		f.Line = min(max(f.Line, 1), lineCount)
+		if f.EndLine != 0 {
+			f.EndLine = min(max(f.EndLine, f.Line), lineCount)
+		}
+		f.Severity = strings.ToLower(f.Severity)
+		if !slices.Contains(Severities, f.Severity) {
+			f.Severity = "medium"
+		}
+		f.Category = strings.ToLower(f.Category)
+		if !slices.Contains(Categories, f.Category) {
+			f.Category = "bug"
+		}
+	}
+
+	slices.SortStableFunc(findings, func(a, b Finding) int {
+		if d := slices.Index(Severities, a.Severity) - slices.Index(Severities, b.Severity); d != 0 {
+			return d
+		}
+		return a.Line - b.Line
+	})
+	if findings == nil {
+		findings = []Finding{}
+	}
+	return findings
+}
+
+// decode parses a JSON reply, tolerating markdown fences around it
+func decode(text string, v any) error {
+	if err := json.Unmarshal([]byte(CleanCode(text)), v); err != nil {
+		return fmt.Errorf("model returned malformed JSON: %w", err)
+	}
+	return nil
+}
+
+// CleanCode strips the markdown fences models add despite being told not to
+func CleanCode(text string) string {
+	// Clean up the output to ensure only code is returned
+	generatedCode := strings.TrimSpace(text)
+	// Remove markdown code block delimiters if present
+	if strings.HasPrefix(generatedCode, "```") {
+		// Find the first newline to remove the opening tag (e.g., ```python)
+		if newlineIdx := strings.Index(generatedCode, "\n"); newlineIdx != -1 {
+			generatedCode = generatedCode[newlineIdx+1:]
+		}
+	}
+	generatedCode = strings.TrimSuffix(generatedCode, "```")
+	return strings.TrimSpace(generatedCode)
+}
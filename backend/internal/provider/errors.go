@@ -0,0 +1,44 @@
+package provider
+
+import (
+	"context"
+	"errors"
+
+	"backend/internal/metrics"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var providerErrors = metrics.NewCounterVec("copilot_provider_errors_total",
+	"Failed model calls, by model and error type.", "model", "type")
+
+// errorType classifies a failed model call for metrics and logs: timeout,
+// canceled, no_content, rate_limited, invalid_request, auth, unavailable
+// or other
+func errorType(err error) string {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, ErrNoContent):
+		return "no_content"
+	}
+
+	switch status.Code(err) {
+	case codes.DeadlineExceeded:
+		return "timeout"
+	case codes.Canceled:
+		return "canceled"
+	case codes.ResourceExhausted:
+		return "rate_limited"
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return "invalid_request"
+	case codes.Unauthenticated, codes.PermissionDenied:
+		return "auth"
+	case codes.Unavailable, codes.Internal:
+		return "unavailable"
+	}
+	return "other"
+}
@@ -0,0 +1,217 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
+)
+
+// Gemini generates replies with a Google Gemini model
+type Gemini struct {
+	apiKey string
+	model  string
+}
+
+func NewGemini(apiKey, model string) *Gemini {
+	return &Gemini{apiKey: apiKey, model: model}
+}
+
+func (g *Gemini) Generate(ctx context.Context, req Request) (resp *Response, err error) {
+	defer g.record(ctx, "generate", time.Now(), &resp, &err)
+
+	client, model, contents, err := g.prepare(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	var result *genai.GenerateContentResponse
+	if len(contents) == 1 {
+		// Chat sessions always ask for a single candidate, so the candidate
+		// count can only be used for prompts without history
+		if req.Candidates > 1 {
+			model.SetCandidateCount(int32(req.Candidates))
+		}
+		result, err = model.GenerateContent(ctx, contents[0].Parts...)
+	} else {
+		session := model.StartChat()
+		session.History = contents[:len(contents)-1]
+		result, err = session.SendMessage(ctx, contents[len(contents)-1].Parts...)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []string
+	for _, candidate := range result.Candidates {
+		if text := candidateText(candidate); text != "" {
+			candidates = append(candidates, text)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, ErrNoContent
+	}
+
+	return &Response{Candidates: candidates, Model: g.model, Usage: geminiUsage(result.UsageMetadata)}, nil
+}
+
+// GenerateStream generates a single reply, passing its text to onText as
+// it arrives
+func (g *Gemini) GenerateStream(ctx context.Context, req Request, onText func(string) error) (resp *Response, err error) {
+	// A reply abandoned because onText failed is not the model's failure
+	aborted := false
+	defer func(start time.Time) {
+		if !aborted {
+			g.record(ctx, "stream", start, &resp, &err)
+		}
+	}(time.Now())
+
+	client, model, contents, err := g.prepare(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	var iter *genai.GenerateContentResponseIterator
+	if len(contents) == 1 {
+		iter = model.GenerateContentStream(ctx, contents[0].Parts...)
+	} else {
+		session := model.StartChat()
+		session.History = contents[:len(contents)-1]
+		iter = session.SendMessageStream(ctx, contents[len(contents)-1].Parts...)
+	}
+
+	var text strings.Builder
+	var usage *genai.UsageMetadata // sent with the last parts
+	for {
+		part, err := iter.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.UsageMetadata != nil {
+			usage = part.UsageMetadata
+		}
+		if len(part.Candidates) == 0 {
+			continue
+		}
+		chunk := candidateText(part.Candidates[0])
+		if chunk == "" {
+			continue
+		}
+		text.WriteString(chunk)
+		if err := onText(chunk); err != nil {
+			aborted = true
+			return nil, err
+		}
+	}
+	if text.Len() == 0 {
+		return nil, ErrNoContent
+	}
+
+	return &Response{Candidates: []string{text.String()}, Model: g.model, Usage: geminiUsage(usage)}, nil
+}
+
+// record logs a call to the model with the context it was made in, which
+// carries the request ID of the request it serves, and counts failures.
+// Prompts and replies are not logged.
+func (g *Gemini) record(ctx context.Context, op string, start time.Time, resp **Response, err *error) {
+	attrs := []slog.Attr{
+		slog.String("model", g.model),
+		slog.String("op", op),
+		slog.Duration("duration", time.Since(start)),
+	}
+	if *err != nil {
+		kind := errorType(*err)
+		providerErrors.With(g.model, kind).Inc()
+		attrs = append(attrs, slog.String("type", kind), slog.Any("error", *err))
+		slog.LogAttrs(ctx, slog.LevelWarn, "Model call failed", attrs...)
+		return
+	}
+	attrs = append(attrs, slog.Int("candidates", len((*resp).Candidates)))
+	slog.LogAttrs(ctx, slog.LevelDebug, "Model call", attrs...)
+}
+
+// prepare creates a client and model configured for req, and the contents
+// of the conversation ending with the prompt. The caller closes the client.
+func (g *Gemini) prepare(ctx context.Context, req Request) (*genai.Client, *genai.GenerativeModel, []*genai.Content, error) {
+	if g.apiKey == "" {
+		return nil, nil, nil, errors.New("GEMINI_API_KEY not set")
+	}
+
+	client, err := genai.NewClient(ctx, option.WithAPIKey(g.apiKey))
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to create Gemini client: %w", err)
+	}
+
+	model := client.GenerativeModel(g.model)
+	if req.System != "" {
+		model.SystemInstruction = genai.NewUserContent(genai.Text(req.System))
+	}
+	if req.JSON {
+		model.ResponseMIMEType = "application/json"
+	}
+	if len(req.Stop) > 0 {
+		model.StopSequences = req.Stop
+	}
+	if req.MaxTokens > 0 {
+		model.SetMaxOutputTokens(int32(req.MaxTokens))
+	}
+
+	turns := append(slices.Clone(req.History), Turn{Role: RoleUser, Content: req.Prompt})
+	return client, model, geminiContents(turns), nil
+}
+
+func geminiUsage(metadata *genai.UsageMetadata) Usage {
+	if metadata == nil {
+		return Usage{}
+	}
+	return Usage{
+		InputTokens:  int(metadata.PromptTokenCount),
+		OutputTokens: int(metadata.CandidatesTokenCount),
+	}
+}
+
+// candidateText joins the text parts of a candidate
+func candidateText(candidate *genai.Candidate) string {
+	if candidate.Content == nil {
+		return ""
+	}
+	var text strings.Builder
+	for _, part := range candidate.Content.Parts {
+		if t, ok := part.(genai.Text); ok {
+			text.WriteString(string(t))
+		}
+	}
+	return text.String()
+}
+
+// geminiContents converts turns to Gemini contents. Gemini expects user and
+// model turns to alternate, so consecutive turns of the same role (e.g. a
+// prompt whose generation failed) are merged.
+func geminiContents(turns []Turn) []*genai.Content {
+	var contents []*genai.Content
+	for _, turn := range turns {
+		role := "user"
+		if turn.Role == RoleAssistant {
+			role = "model"
+		}
+
+		if n := len(contents); n > 0 && contents[n-1].Role == role {
+			contents[n-1].Parts = append(contents[n-1].Parts, genai.Text(turn.Content))
+			continue
+		}
+		contents = append(contents, &genai.Content{Role: role, Parts: []genai.Part{genai.Text(turn.Content)}})
+	}
+	return contents
+}
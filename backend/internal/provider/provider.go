@@ -0,0 +1,104 @@
+// Package provider abstracts the language model used to generate code, so
+// handlers don't depend on a particular vendor SDK.
+package provider
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// ErrNoContent is returned when the model produced an empty response
+var ErrNoContent = errors.New("no content returned from model")
+
+// Turn is a previous message of the conversation
+type Turn struct {
+	Role    string // RoleUser or RoleAssistant
+	Content string
+}
+
+type Request struct {
+	System     string // optional system instruction
+	History    []Turn // earlier turns, oldest first
+	Prompt     string
+	Candidates int      // number of alternative replies wanted, 0 means 1
+	JSON       bool     // ask for replies that are a single JSON document
+	Stop       []string // stop sequences, the reply ends before the first one
+	MaxTokens  int      // limit on the length of each reply, 0 for the model's default
+}
+
+type Response struct {
+	Candidates []string // at least one, possibly fewer than requested
+	Model      string
+	Usage      Usage
+}
+
+// Usage counts the tokens a generation consumed, zero when the provider
+// doesn't report them
+type Usage struct {
+	InputTokens  int // prompt, history and system instruction
+	OutputTokens int // all candidates
+}
+
+// Text returns the first candidate
+func (r *Response) Text() string {
+	return r.Candidates[0]
+}
+
+// Provider generates a reply to a prompt given the preceding conversation
+type Provider interface {
+	Generate(ctx context.Context, req Request) (*Response, error)
+}
+
+// Streamer is implemented by providers that can deliver a single reply
+// while it is being generated. onText receives each new piece of text, an
+// error returned by it aborts the generation.
+type Streamer interface {
+	GenerateStream(ctx context.Context, req Request, onText func(string) error) (*Response, error)
+}
+
+// GenerateCandidates asks p for req.Candidates alternative replies. When the
+// provider returns fewer in one call, the missing ones are generated with
+// parallel single-candidate calls.
+func GenerateCandidates(ctx context.Context, p Provider, req Request) (*Response, error) {
+	resp, err := p.Generate(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	missing := req.Candidates - len(resp.Candidates)
+	if missing <= 0 {
+		return resp, nil
+	}
+
+	single := req
+	single.Candidates = 1
+	extra := make([]*Response, missing)
+	errs := make([]error, missing)
+
+	var wg sync.WaitGroup
+	for i := range missing {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			extra[i], errs[i] = p.Generate(ctx, single)
+		}()
+	}
+	wg.Wait()
+
+	for i := range extra {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		resp.Candidates = append(resp.Candidates, extra[i].Candidates...)
+		resp.Usage.InputTokens += extra[i].Usage.InputTokens
+		resp.Usage.OutputTokens += extra[i].Usage.OutputTokens
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,223 @@
+package routes
+
+import (
+	"log/slog"
+
+	"backend/internal/auth"
+	"backend/internal/handlers"
+	"backend/internal/openapi"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var (
+	staffRoles = []string{string(auth.RoleAdmin), string(auth.RoleSupport)}
+	adminRoles = []string{string(auth.RoleAdmin)}
+
+	dateRange = []openapi.Param{
+		{Name: "from", Description: "Start date (YYYY-MM-DD) or RFC 3339 timestamp"},
+		{Name: "to", Description: "End date (YYYY-MM-DD) or RFC 3339 timestamp"},
+	}
+	workspaceParam = openapi.Param{Name: "workspaceId", Type: "integer", Description: "Workspace to use instead of the user's personal chats"}
+)
+
+// paged adds the keyset pagination parameters to params
+func paged(params ...openapi.Param) []openapi.Param {
+	return append(params,
+		openapi.Param{Name: "limit", Type: "integer", Description: "Page size"},
+		openapi.Param{Name: "cursor", Description: "nextCursor of the previous page"},
+	)
+}
+
+// operations documents the routes registered by RegisterRoutes. Routes
+// missing here still show up in the document, as undocumented.
+var operations = []openapi.Operation{
+	{Method: "GET", Path: "/health", Tag: "system", Summary: "Health check", Public: true, Response: fiber.Map{}, Unwrapped: true},
+	{Method: "GET", Path: "/metrics", Tag: "system", Summary: "Prometheus metrics", Public: true, ContentType: "text/plain",
+		Description: "Request, generation, provider error, database pool and stream metrics in the Prometheus text format. " +
+			"Requires METRICS_TOKEN as a bearer token when the server sets one."},
+	{Method: "GET", Path: "/api/v1/openapi.json", Tag: "system", Summary: "This OpenAPI document", Public: true, ContentType: "application/json"},
+	{Method: "GET", Path: "/api/v1/docs", Tag: "system", Summary: "API documentation page", Public: true, ContentType: "text/html"},
+
+	{Method: "POST", Path: "/api/v1/auth/signup", Tag: "auth", Summary: "Create an account", Public: true,
+		Request: handlers.SignupRequest{}, Response: handlers.SignupResponse{}, Status: fiber.StatusCreated},
+	{Method: "POST", Path: "/api/v1/auth/login", Tag: "auth", Summary: "Log in", Public: true,
+		Request: handlers.LoginRequest{}, Response: handlers.LoginResponse{}},
+	{Method: "POST", Path: "/api/v1/auth/refresh", Tag: "auth", Summary: "Refresh the session token",
+		Description: "Issues a new session token with the user's current role. Personal access tokens cannot be refreshed.",
+		Response:    handlers.LoginResponse{}},
+
+	{Method: "POST", Path: "/api/v1/generate", Tag: "generation", Summary: "Generate code or run a task on code",
+		Description: "Adds the prompt to the end of the chat's active branch, or to a new chat, and returns the model's reply.",
+		Request:     handlers.GenerateRequest{}, Response: handlers.GenerateResponse{}},
+	{Method: "POST", Path: "/api/v1/generate/stream", Tag: "generation", Summary: "Generate with a streamed reply",
+		Description: `Takes the same body as /generate and answers with server-sent events: "chunk" events {"text"} ` +
+			`while the reply is generated, then a "done" event with the GenerateResponse or an "error" event {"status", "code", "message", ...}.`,
+		Request: handlers.GenerateRequest{}, ContentType: "text/event-stream"},
+	{Method: "POST", Path: "/api/v1/complete", Tag: "generation", Summary: "Inline code completion",
+		Request: handlers.CompleteRequest{}, Response: handlers.CompleteResponse{}},
+
+	{Method: "POST", Path: "/api/v1/chats", Tag: "chats", Summary: "Create a chat",
+		Request: handlers.CreateChatRequest{}, Response: handlers.ChatResponse{}},
+	{Method: "GET", Path: "/api/v1/chats", Tag: "chats", Summary: "List chats", Paginated: true,
+		Query: paged(workspaceParam,
+			openapi.Param{Name: "archived", Type: "boolean", Description: "List archived chats (true), or all chats (any)"},
+			openapi.Param{Name: "pinned", Type: "boolean", Description: "Only pinned (true) or unpinned (false) chats"},
+			openapi.Param{Name: "trashed", Type: "boolean", Description: "List the chats in the trash"},
+		),
+		Response: []handlers.ChatResponse{}},
+	{Method: "POST", Path: "/api/v1/chats/import", Tag: "chats", Summary: "Import a chat",
+		Description: `Accepts the JSON export format, {"messages": [{"role", "content"}]} or a bare array of such messages.`,
+		Query:       []openapi.Param{workspaceParam}, Request: handlers.ChatExport{}, Response: handlers.ChatResponse{}},
+	{Method: "GET", Path: "/api/v1/chats/:id", Tag: "chats", Summary: "Get a chat with its active branch",
+		Description: "Returns the latest messages of the active branch, older ones are loaded with nextCursor.",
+		Query:       paged(), Response: handlers.ChatWithMessagesResponse{}},
+	{Method: "PATCH", Path: "/api/v1/chats/:id", Tag: "chats", Summary: "Rename, pin or archive a chat",
+		Request: handlers.UpdateChatRequest{}, Response: handlers.ChatResponse{}},
+	{Method: "DELETE", Path: "/api/v1/chats/:id", Tag: "chats", Summary: "Move a chat to the trash",
+		Query: []openapi.Param{{Name: "permanent", Type: "boolean", Description: "Delete the chat permanently"}}},
+	{Method: "POST", Path: "/api/v1/chats/:id/restore", Tag: "chats", Summary: "Restore a chat from the trash"},
+	{Method: "PUT", Path: "/api/v1/chats/:id/branch", Tag: "chats", Summary: "Switch to the branch ending at a message",
+		Request: handlers.SelectBranchRequest{}, Response: handlers.ChatResponse{}},
+	{Method: "GET", Path: "/api/v1/chats/:id/export", Tag: "chats", Summary: "Download a chat",
+		Query:       []openapi.Param{{Name: "format", Description: "md (default), json or html"}},
+		ContentType: "application/octet-stream"},
+	{Method: "POST", Path: "/api/v1/chats/:id/shares", Tag: "sharing", Summary: "Create a share link",
+		Request: handlers.CreateShareRequest{}, Response: handlers.ShareResponse{}, Status: fiber.StatusCreated},
+	{Method: "GET", Path: "/api/v1/chats/:id/shares", Tag: "sharing", Summary: "List share links",
+		Response: []handlers.ShareResponse{}},
+	{Method: "DELETE", Path: "/api/v1/chats/:id/shares/:shareId", Tag: "sharing", Summary: "Revoke a share link"},
+	{Method: "GET", Path: "/api/v1/shared/:token", Tag: "sharing", Summary: "View a shared chat", Public: true,
+		Response: handlers.ChatWithMessagesResponse{}},
+
+	{Method: "PATCH", Path: "/api/v1/messages/:id", Tag: "messages", Summary: "Edit a prompt",
+		Description: "Saves the new content as a sibling of the prompt, starting a new branch, and generates a reply to it.",
+		Request:     handlers.EditMessageRequest{}, Response: handlers.GenerateResponse{}},
+	{Method: "POST", Path: "/api/v1/messages/:id/regenerate", Tag: "messages", Summary: "Generate another reply",
+		Request: handlers.RegenerateRequest{}, Response: handlers.GenerateResponse{}},
+	{Method: "POST", Path: "/api/v1/messages/:id/select", Tag: "messages", Summary: "Make a message's branch active",
+		Response: handlers.ChatResponse{}},
+	{Method: "PUT", Path: "/api/v1/messages/:id/feedback", Tag: "messages", Summary: "Rate a reply",
+		Request: handlers.FeedbackRequest{}, Response: handlers.FeedbackResponse{}},
+	{Method: "DELETE", Path: "/api/v1/messages/:id/feedback", Tag: "messages", Summary: "Remove a rating"},
+
+	{Method: "POST", Path: "/api/v1/snippets", Tag: "snippets", Summary: "Save a snippet",
+		Request: handlers.CreateSnippetRequest{}, Response: handlers.SnippetResponse{}},
+	{Method: "GET", Path: "/api/v1/snippets", Tag: "snippets", Summary: "List snippets", Paginated: true,
+		Query: paged(
+			openapi.Param{Name: "q", Description: "Text to search for"},
+			openapi.Param{Name: "tag"},
+			openapi.Param{Name: "language"},
+		),
+		Response: []handlers.SnippetResponse{}},
+	{Method: "GET", Path: "/api/v1/snippets/:id", Tag: "snippets", Summary: "Get a snippet", Response: handlers.SnippetResponse{}},
+	{Method: "PATCH", Path: "/api/v1/snippets/:id", Tag: "snippets", Summary: "Update a snippet",
+		Description: "Changed content is saved as a new version.",
+		Request:     handlers.UpdateSnippetRequest{}, Response: handlers.SnippetResponse{}},
+	{Method: "DELETE", Path: "/api/v1/snippets/:id", Tag: "snippets", Summary: "Delete a snippet"},
+	{Method: "GET", Path: "/api/v1/snippets/:id/versions", Tag: "snippets", Summary: "List the versions of a snippet",
+		Response: []handlers.SnippetVersionResponse{}},
+	{Method: "GET", Path: "/api/v1/snippets/:id/diff", Tag: "snippets", Summary: "Diff two versions of a snippet",
+		Query: []openapi.Param{
+			{Name: "from", Type: "integer", Description: "Older version, defaults to the one before to"},
+			{Name: "to", Type: "integer", Description: "Newer version, defaults to the latest"},
+		},
+		Response: handlers.SnippetDiffResponse{}},
+
+	{Method: "POST", Path: "/api/v1/tokens", Tag: "tokens", Summary: "Create a personal access token",
+		Description: "The token is only returned in this response. Requires a session token.",
+		Request:     handlers.CreateAccessTokenRequest{}, Response: handlers.AccessTokenResponse{}, Status: fiber.StatusCreated},
+	{Method: "GET", Path: "/api/v1/tokens", Tag: "tokens", Summary: "List personal access tokens",
+		Response: []handlers.AccessTokenResponse{}},
+	{Method: "DELETE", Path: "/api/v1/tokens/:id", Tag: "tokens", Summary: "Revoke a personal access token"},
+
+	{Method: "GET", Path: "/api/v1/search", Tag: "search", Summary: "Search chats and messages",
+		Query: append([]openapi.Param{
+			{Name: "q", Required: true, Description: "Search query"},
+			{Name: "language"},
+			{Name: "role", Description: "user or assistant"},
+			{Name: "limit", Type: "integer"},
+			workspaceParam,
+		}, dateRange...),
+		Response: []handlers.SearchResultResponse{}},
+
+	{Method: "POST", Path: "/api/v1/workspaces", Tag: "workspaces", Summary: "Create a workspace",
+		Request: handlers.WorkspaceRequest{}, Response: handlers.WorkspaceResponse{}, Status: fiber.StatusCreated},
+	{Method: "GET", Path: "/api/v1/workspaces", Tag: "workspaces", Summary: "List the user's workspaces",
+		Response: []handlers.WorkspaceResponse{}},
+	{Method: "GET", Path: "/api/v1/workspaces/:id", Tag: "workspaces", Summary: "Get a workspace with its members",
+		Response: handlers.WorkspaceWithMembersResponse{}},
+	{Method: "PATCH", Path: "/api/v1/workspaces/:id", Tag: "workspaces", Summary: "Rename a workspace",
+		Request: handlers.WorkspaceRequest{}},
+	{Method: "DELETE", Path: "/api/v1/workspaces/:id", Tag: "workspaces", Summary: "Delete a workspace"},
+	{Method: "PUT", Path: "/api/v1/workspaces/:id/members/:userId", Tag: "workspaces", Summary: "Change a member's role",
+		Request: handlers.UpdateMemberRoleRequest{}},
+	{Method: "DELETE", Path: "/api/v1/workspaces/:id/members/:userId", Tag: "workspaces", Summary: "Remove a member"},
+	{Method: "POST", Path: "/api/v1/workspaces/:id/invites", Tag: "workspaces", Summary: "Invite someone to a workspace",
+		Description: "The token is only returned in this response. Owner invites must name the invitee's email.",
+		Request:     handlers.CreateInviteRequest{}, Response: handlers.InviteResponse{}, Status: fiber.StatusCreated},
+	{Method: "GET", Path: "/api/v1/workspaces/:id/invites", Tag: "workspaces", Summary: "List pending invites",
+		Response: []handlers.InviteResponse{}},
+	{Method: "DELETE", Path: "/api/v1/workspaces/:id/invites/:inviteId", Tag: "workspaces", Summary: "Revoke an invite"},
+	{Method: "POST", Path: "/api/v1/invites/accept", Tag: "workspaces", Summary: "Accept an invite",
+		Description: "Each invite can only be accepted once.",
+		Request:     handlers.AcceptInviteRequest{}, Response: handlers.WorkspaceResponse{}},
+
+	{Method: "GET", Path: "/api/v1/admin/users", Tag: "admin", Summary: "List users", Roles: staffRoles,
+		Query: []openapi.Param{
+			{Name: "q", Description: "Name or email to search for"},
+			{Name: "role"},
+			{Name: "limit", Type: "integer"},
+			{Name: "offset", Type: "integer"},
+		},
+		Response: handlers.AdminUserListResponse{}},
+	{Method: "GET", Path: "/api/v1/admin/users/:id", Tag: "admin", Summary: "Get a user with usage figures", Roles: staffRoles,
+		Response: handlers.AdminUserDetailResponse{}},
+	{Method: "PUT", Path: "/api/v1/admin/users/:id/role", Tag: "admin", Summary: "Change a user's role", Roles: adminRoles,
+		Request: handlers.UpdateUserRoleRequest{}},
+	{Method: "POST", Path: "/api/v1/admin/users/:id/disable", Tag: "admin", Summary: "Disable an account", Roles: staffRoles},
+	{Method: "POST", Path: "/api/v1/admin/users/:id/enable", Tag: "admin", Summary: "Enable an account", Roles: staffRoles},
+	{Method: "POST", Path: "/api/v1/admin/users/:id/revoke-sessions", Tag: "admin", Summary: "Sign a user out everywhere and delete their access tokens", Roles: staffRoles},
+	{Method: "GET", Path: "/api/v1/admin/usage", Tag: "admin", Summary: "System-wide usage figures", Roles: staffRoles,
+		Response: handlers.UsageStatsResponse{}},
+	{Method: "GET", Path: "/api/v1/admin/feedback/stats", Tag: "admin", Summary: "Feedback by language and model", Roles: staffRoles,
+		Query: dateRange, Response: []handlers.FeedbackStatsResponse{}},
+	{Method: "GET", Path: "/api/v1/admin/feedback/export", Tag: "admin", Summary: "Export rated replies as JSON lines", Roles: adminRoles,
+		Description: "Each line is a FeedbackExampleLine.",
+		Query:       append([]openapi.Param{{Name: "rating", Description: "up or down"}}, dateRange...),
+		ContentType: "application/x-ndjson"},
+}
+
+// apiDocs serves the OpenAPI document of the app's routes and a page
+// rendering it
+type apiDocs struct {
+	doc *openapi.Document
+}
+
+// build generates the document from the routes registered so far, so it is
+// called once all routes are in place
+func (d *apiDocs) build(app *fiber.App) {
+	var routes []openapi.Route
+	for _, route := range app.GetRoutes(true) {
+		routes = append(routes, openapi.Route{Method: route.Method, Path: route.Path})
+	}
+	doc, undocumented := openapi.Build(openapi.Info{
+		Title:   "Code Generation Copilot API",
+		Version: "1.0.0",
+		Description: "Responses are wrapped in an envelope: {success: true, message?, data} on success " +
+			"and {success: false, error: {code, message, details?, requestId}} on failure.",
+	}, routes, operations)
+	for _, route := range undocumented {
+		slog.Warn("Route is missing from the API documentation", "method", route.Method, "path", route.Path)
+	}
+	d.doc = doc
+}
+
+func (d *apiDocs) spec(c *fiber.Ctx) error {
+	return c.JSON(d.doc)
+}
+
+func (d *apiDocs) page(c *fiber.Ctx) error {
+	c.Type("html")
+	return c.Send(openapi.DocsPage)
+}
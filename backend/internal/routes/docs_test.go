@@ -0,0 +1,134 @@
+package routes
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"backend/internal/config"
+	"backend/internal/handlers"
+	"backend/internal/openapi"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// newTestApp registers the routes on an app without a database; requests
+// that don't reach a handler, like the docs, still work
+func newTestApp(t *testing.T) *fiber.App {
+	t.Helper()
+	cfg := &config.Config{
+		Limits: config.Limits{MaxPromptLength: 20000, MaxCodeLength: 100000},
+	}
+	app := fiber.New()
+	RegisterRoutes(app, handlers.NewHandler(nil, cfg), nil, cfg)
+	return app
+}
+
+func TestOperationsMatchRoutes(t *testing.T) {
+	app := newTestApp(t)
+
+	registered := map[openapi.Route]bool{}
+	for _, route := range app.GetRoutes(true) {
+		if route.Method == http.MethodHead {
+			continue
+		}
+		registered[openapi.Route{Method: route.Method, Path: route.Path}] = true
+	}
+
+	documented := map[openapi.Route]bool{}
+	for _, op := range operations {
+		route := openapi.Route{Method: op.Method, Path: op.Path}
+		if documented[route] {
+			t.Errorf("%s %s is documented twice", op.Method, op.Path)
+		}
+		documented[route] = true
+		if !registered[route] {
+			t.Errorf("%s %s is documented but not registered", op.Method, op.Path)
+		}
+	}
+	for route := range registered {
+		if !documented[route] {
+			t.Errorf("%s %s is missing from the operations", route.Method, route.Path)
+		}
+	}
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	app := newTestApp(t)
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/api/v1/openapi.json", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var doc openapi.Document
+	if err := json.Unmarshal(body, &doc); err != nil {
+		t.Fatalf("document is not valid JSON: %v", err)
+	}
+	if doc.OpenAPI != "3.0.3" || doc.Info.Title == "" || doc.Info.Version == "" {
+		t.Errorf("document header = %q %+v", doc.OpenAPI, doc.Info)
+	}
+
+	tags := map[string]bool{}
+	for _, tag := range doc.Tags {
+		tags[tag.Name] = true
+	}
+	if tags["undocumented"] {
+		t.Error("document lists undocumented routes")
+	}
+
+	pathParam := regexp.MustCompile(`\{(\w+)\}`)
+	operationIDs := map[string]string{}
+	for path, item := range doc.Paths {
+		for method, op := range *item {
+			where := strings.ToUpper(method) + " " + path
+			if op.OperationID == "" {
+				t.Errorf("%s has no operationId", where)
+			} else if other, ok := operationIDs[op.OperationID]; ok {
+				t.Errorf("%s and %s share the operationId %q", where, other, op.OperationID)
+			}
+			operationIDs[op.OperationID] = where
+
+			if len(op.Responses) == 0 {
+				t.Errorf("%s has no responses", where)
+			}
+			for _, tag := range op.Tags {
+				if !tags[tag] {
+					t.Errorf("%s has tag %q, which the document doesn't list", where, tag)
+				}
+			}
+
+			// Every path parameter must be declared
+			declared := map[string]bool{}
+			for _, param := range op.Parameters {
+				if param.In == "path" {
+					declared[param.Name] = true
+				}
+			}
+			for _, match := range pathParam.FindAllStringSubmatch(path, -1) {
+				if !declared[match[1]] {
+					t.Errorf("%s doesn't declare path parameter %q", where, match[1])
+				}
+			}
+		}
+	}
+
+	// Every schema reference must resolve
+	refs := regexp.MustCompile(`"\$ref":"#/components/schemas/([^"]+)"`)
+	for _, match := range refs.FindAllStringSubmatch(string(body), -1) {
+		if _, ok := doc.Components.Schemas[match[1]]; !ok {
+			t.Errorf("reference to missing schema %q", match[1])
+		}
+	}
+}
@@ -1,6 +1,9 @@
 package routes
 
 import (
+	"backend/internal/auth"
+	"backend/internal/config"
+	"backend/internal/database"
 	"backend/internal/handlers"
 	"backend/internal/middleware"
 
@@ -8,25 +11,95 @@ import (
 )
 
 // RegisterRoutes sets up all application routes
-func RegisterRoutes(app *fiber.App, h *handlers.Handler) {
+func RegisterRoutes(app *fiber.App, h *handlers.Handler, db database.Service, cfg *config.Config) {
 	// Public routes (no authentication required)
 	app.Get("/health", h.HealthHandler)
 
+	// Prometheus metrics, behind their own token when one is configured
+	app.Get("/metrics", middleware.MetricsHandler(cfg.Server.MetricsToken))
+
 	// API v1 routes with /api/v1 prefix
 	v1 := app.Group("/api/v1")
 
 	// Public API routes
-	auth := v1.Group("/auth")
-	auth.Post("/signup", h.SignupHandler)
-	auth.Post("/login", h.LoginHandler)
+	authRoutes := v1.Group("/auth")
+	authRoutes.Post("/signup", h.SignupHandler)
+	authRoutes.Post("/login", h.LoginHandler)
+	authRoutes.Post("/refresh", middleware.AuthMiddleware(db), h.RefreshTokenHandler)
+
+	// Public read-only view of shared chats
+	v1.Get("/shared/:token", h.GetSharedChatHandler)
+
+	// API documentation, generated from the routes once they are all registered
+	docs := &apiDocs{}
+	v1.Get("/openapi.json", docs.spec)
+	v1.Get("/docs", docs.page)
+
+	// Admin routes (require an admin or support role)
+	admin := v1.Group("/admin", middleware.AuthMiddleware(db), middleware.RequireRole(auth.RoleAdmin, auth.RoleSupport))
+	admin.Get("/users", h.AdminListUsersHandler)
+	admin.Get("/users/:id", h.AdminGetUserHandler)
+	admin.Put("/users/:id/role", middleware.RequireRole(auth.RoleAdmin), h.AdminUpdateUserRoleHandler)
+	admin.Post("/users/:id/disable", h.AdminDisableUserHandler)
+	admin.Post("/users/:id/enable", h.AdminEnableUserHandler)
+	admin.Post("/users/:id/revoke-sessions", h.AdminRevokeSessionsHandler)
+	admin.Get("/usage", h.AdminUsageStatsHandler)
+	admin.Get("/feedback/stats", h.AdminFeedbackStatsHandler)
+	admin.Get("/feedback/export", middleware.RequireRole(auth.RoleAdmin), h.AdminExportFeedbackHandler)
 
 	// Protected API routes (require authentication)
 	protected := v1.Group("")
-	protected.Use(middleware.AuthMiddleware())
+	protected.Use(middleware.AuthMiddleware(db))
 	protected.Post("/generate", h.GenerateCodeHandler)
+	protected.Post("/generate/stream", h.GenerateStreamHandler)
+	protected.Post("/complete", h.CompleteHandler)
 
 	// Chat routes
 	protected.Post("/chats", h.CreateChatHandler)
 	protected.Get("/chats", h.GetChatsHandler)
+	protected.Post("/chats/import", h.ImportChatHandler)
 	protected.Get("/chats/:id", h.GetChatHandler)
+	protected.Patch("/chats/:id", h.UpdateChatHandler)
+	protected.Delete("/chats/:id", h.DeleteChatHandler)
+	protected.Post("/chats/:id/restore", h.RestoreChatHandler)
+	protected.Put("/chats/:id/branch", h.SelectBranchHandler)
+	protected.Get("/chats/:id/export", h.ExportChatHandler)
+	protected.Post("/chats/:id/shares", h.CreateChatShareHandler)
+	protected.Get("/chats/:id/shares", h.GetChatSharesHandler)
+	protected.Delete("/chats/:id/shares/:shareId", h.RevokeChatShareHandler)
+	protected.Patch("/messages/:id", h.EditMessageHandler)
+	protected.Post("/messages/:id/regenerate", h.RegenerateMessageHandler)
+	protected.Post("/messages/:id/select", h.SelectMessageHandler)
+	protected.Put("/messages/:id/feedback", h.SetFeedbackHandler)
+	protected.Delete("/messages/:id/feedback", h.DeleteFeedbackHandler)
+	protected.Post("/snippets", h.CreateSnippetHandler)
+	protected.Get("/snippets", h.GetSnippetsHandler)
+	protected.Get("/snippets/:id", h.GetSnippetHandler)
+	protected.Patch("/snippets/:id", h.UpdateSnippetHandler)
+	protected.Delete("/snippets/:id", h.DeleteSnippetHandler)
+	protected.Get("/snippets/:id/versions", h.GetSnippetVersionsHandler)
+	protected.Get("/snippets/:id/diff", h.GetSnippetDiffHandler)
+
+	// Personal access tokens for editor integrations
+	protected.Post("/tokens", h.CreateAccessTokenHandler)
+	protected.Get("/tokens", h.GetAccessTokensHandler)
+	protected.Delete("/tokens/:id", h.DeleteAccessTokenHandler)
+
+	// Search
+	protected.Get("/search", h.SearchHandler)
+
+	// Workspace routes
+	protected.Post("/workspaces", h.CreateWorkspaceHandler)
+	protected.Get("/workspaces", h.GetWorkspacesHandler)
+	protected.Get("/workspaces/:id", h.GetWorkspaceHandler)
+	protected.Patch("/workspaces/:id", h.UpdateWorkspaceHandler)
+	protected.Delete("/workspaces/:id", h.DeleteWorkspaceHandler)
+	protected.Put("/workspaces/:id/members/:userId", h.UpdateWorkspaceMemberHandler)
+	protected.Delete("/workspaces/:id/members/:userId", h.RemoveWorkspaceMemberHandler)
+	protected.Post("/workspaces/:id/invites", h.CreateWorkspaceInviteHandler)
+	protected.Get("/workspaces/:id/invites", h.GetWorkspaceInvitesHandler)
+	protected.Delete("/workspaces/:id/invites/:inviteId", h.DeleteWorkspaceInviteHandler)
+	protected.Post("/invites/accept", h.AcceptInviteHandler)
+
+	docs.build(app)
 }
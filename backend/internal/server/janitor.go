@@ -0,0 +1,29 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// PurgeTrash permanently deletes chats that have been in the trash for longer
+// than retention, checking every interval until ctx is cancelled
+func (s *Server) PurgeTrash(ctx context.Context, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := s.db.PurgeDeletedChats(ctx, time.Now().Add(-retention))
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to purge trash", "error", err)
+		} else if purged > 0 {
+			slog.InfoContext(ctx, "Purged chats from the trash", "chats", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"backend/internal/config"
 	"backend/internal/database"
 	"backend/internal/handlers"
 	"backend/internal/routes"
@@ -10,16 +11,18 @@ import (
 
 type Server struct {
 	db      database.Service
+	cfg     *config.Config
 	handler *handlers.Handler
 }
 
-func NewServer(db database.Service) *Server {
+func NewServer(db database.Service, cfg *config.Config) *Server {
 	return &Server{
 		db:      db,
-		handler: handlers.NewHandler(db),
+		cfg:     cfg,
+		handler: handlers.NewHandler(db, cfg),
 	}
 }
 
 func (s *Server) RegisterRoutes(app *fiber.App) {
-	routes.RegisterRoutes(app, s.handler)
+	routes.RegisterRoutes(app, s.handler, s.db, s.cfg)
 }
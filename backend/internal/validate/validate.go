@@ -0,0 +1,400 @@
+// Package validate checks request structs against rules declared in
+// `validate` struct tags:
+//
+//	type SignupRequest struct {
+//		Name  string `json:"name" validate:"required,min=2,max=100"`
+//		Email string `json:"email" validate:"required,email"`
+//	}
+//
+// Rules are separated by commas and take an optional parameter after "=".
+// Parameters starting with "$" are looked up with Validator.Set, so limits
+// can come from configuration. Fields are reported by their JSON name.
+//
+// Optional fields are only checked when set: zero values are skipped unless
+// the field is required, and nil pointers are always skipped, while the
+// value of a non-nil pointer is checked even when empty.
+//
+// Tags naming unknown rules or parameters are reported by Check, which is
+// best called once the validator is configured, when the program starts.
+package validate
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Rule checks a field value against the rule's parameter and returns why
+// it fails, e.g. "must be at most 100 characters", or "" if it passes
+type Rule func(value reflect.Value, param string) string
+
+// FieldError describes a field that failed a rule
+type FieldError struct {
+	Field   string `json:"field"` // JSON path, e.g. "messages[2].role"
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	return e.Field + " " + e.Message
+}
+
+// Errors lists the fields that failed validation, in field order
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	switch len(e) {
+	case 0:
+		return "validation failed"
+	case 1:
+		return e[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more)", e[0].Error(), len(e)-1)
+}
+
+// Validator checks structs. Configure it before use; it is then safe for
+// concurrent use.
+type Validator struct {
+	rules  map[string]Rule
+	params map[string]string
+}
+
+// New returns a Validator with the built-in rules: required, notblank,
+// min, max, maxbytes, email and oneof
+func New() *Validator {
+	v := &Validator{rules: make(map[string]Rule), params: make(map[string]string)}
+	v.Register("notblank", notBlank)
+	v.Register("min", minimum)
+	v.Register("max", maximum)
+	v.Register("maxbytes", maxBytes)
+	v.Register("email", email)
+	v.Register("oneof", oneOf)
+	return v
+}
+
+// Register adds a rule, or replaces the rule with the same name
+func (v *Validator) Register(name string, rule Rule) {
+	v.rules[name] = rule
+}
+
+// Set defines a parameter tags can refer to as "$name"
+func (v *Validator) Set(name string, value any) {
+	v.params[name] = fmt.Sprint(value)
+}
+
+// Check verifies that the tags of the struct types of values, and of the
+// structs their fields hold, only use registered rules and set parameters.
+// Struct reports such mistakes only once a value reaches the field.
+func (v *Validator) Check(values ...any) error {
+	var errs []error
+	seen := make(map[reflect.Type]bool)
+	for _, value := range values {
+		errs = append(errs, v.checkType(reflect.TypeOf(value), seen)...)
+	}
+	return errors.Join(errs...)
+}
+
+func (v *Validator) checkType(t reflect.Type, seen map[reflect.Type]bool) []error {
+	for t != nil && (t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct || seen[t] {
+		return nil
+	}
+	seen[t] = true
+
+	var errs []error
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		if tag := field.Tag.Get("validate"); tag != "" && tag != "-" {
+			for _, rule := range strings.Split(tag, ",") {
+				ruleName, param, _ := strings.Cut(rule, "=")
+				if _, _, err := v.resolve(ruleName, param); err != nil {
+					errs = append(errs, fmt.Errorf("validate: %s.%s: %w", t.Name(), field.Name, err))
+				}
+			}
+		}
+		errs = append(errs, v.checkType(field.Type, seen)...)
+	}
+	return errs
+}
+
+// resolve returns the rule named in a tag and its parameter, with "$name"
+// parameters replaced by their value
+func (v *Validator) resolve(ruleName, param string) (Rule, string, error) {
+	if ruleName == "required" {
+		return nil, "", nil
+	}
+	check, ok := v.rules[ruleName]
+	if !ok {
+		return nil, "", fmt.Errorf("unknown rule %q", ruleName)
+	}
+	if strings.HasPrefix(param, "$") {
+		resolved, ok := v.params[param[1:]]
+		if !ok {
+			return nil, "", fmt.Errorf("parameter %s is not set", param)
+		}
+		param = resolved
+	}
+	return check, param, nil
+}
+
+// Struct checks the fields of the struct s points to. It returns Errors
+// when fields fail their rules.
+func (v *Validator) Struct(s any) error {
+	value := reflect.ValueOf(s)
+	for value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return fmt.Errorf("validate: %T is not a struct", s)
+	}
+
+	var errs Errors
+	if err := v.checkStruct(value, "", &errs); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (v *Validator) checkStruct(value reflect.Value, prefix string, errs *Errors) error {
+	t := value.Type()
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := prefix + jsonName(field)
+
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			if err := v.checkStruct(value.Field(i), prefix, errs); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if tag := field.Tag.Get("validate"); tag != "" && tag != "-" {
+			failed, err := v.checkField(value.Field(i), name, tag, errs)
+			if err != nil {
+				return err
+			}
+			if failed {
+				continue
+			}
+		}
+
+		if err := v.checkNested(value.Field(i), name, errs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkField applies the rules of tag to a field and reports whether one
+// failed. Only the first failing rule of a field is reported.
+func (v *Validator) checkField(value reflect.Value, name, tag string, errs *Errors) (bool, error) {
+	rules := strings.Split(tag, ",")
+
+	required := false
+	for _, rule := range rules {
+		if rule == "required" {
+			required = true
+		}
+	}
+
+	if value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			if required {
+				*errs = append(*errs, FieldError{Field: name, Rule: "required", Message: "is required"})
+				return true, nil
+			}
+			return false, nil
+		}
+		value = value.Elem()
+	} else if isEmpty(value) {
+		if required {
+			*errs = append(*errs, FieldError{Field: name, Rule: "required", Message: "is required"})
+			return true, nil
+		}
+		return false, nil
+	}
+
+	for _, rule := range rules {
+		ruleName, param, _ := strings.Cut(rule, "=")
+		if ruleName == "required" {
+			continue
+		}
+		check, param, err := v.resolve(ruleName, param)
+		if err != nil {
+			return false, fmt.Errorf("validate: %s: %w", name, err)
+		}
+		if message := check(value, param); message != "" {
+			*errs = append(*errs, FieldError{Field: name, Rule: ruleName, Message: message})
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// checkNested validates structs and slices of structs held by a field
+func (v *Validator) checkNested(value reflect.Value, name string, errs *Errors) error {
+	for value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+
+	switch value.Kind() {
+	case reflect.Struct:
+		return v.checkStruct(value, name+".", errs)
+	case reflect.Slice, reflect.Array:
+		elem := value.Type().Elem()
+		for elem.Kind() == reflect.Pointer {
+			elem = elem.Elem()
+		}
+		if elem.Kind() != reflect.Struct {
+			return nil
+		}
+		for i := range value.Len() {
+			if err := v.checkNested(value.Index(i), fmt.Sprintf("%s[%d]", name, i), errs); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// isEmpty reports whether a value counts as not set. Strings of only
+// whitespace are empty.
+func isEmpty(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.String:
+		return strings.TrimSpace(value.String()) == ""
+	case reflect.Slice, reflect.Map:
+		return value.Len() == 0
+	}
+	return value.IsZero()
+}
+
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}
+
+func notBlank(value reflect.Value, _ string) string {
+	if value.Kind() == reflect.String && strings.TrimSpace(value.String()) == "" {
+		return "cannot be blank"
+	}
+	return ""
+}
+
+func minimum(value reflect.Value, param string) string {
+	n, err := strconv.ParseInt(param, 10, 64)
+	if err != nil {
+		return "has an invalid limit"
+	}
+	size, unit, ok := measure(value)
+	if !ok || size >= n {
+		return ""
+	}
+	if unit == "" {
+		return fmt.Sprintf("must be at least %d", n)
+	}
+	return fmt.Sprintf("must be at least %d %s", n, plural(unit, n))
+}
+
+func maximum(value reflect.Value, param string) string {
+	n, err := strconv.ParseInt(param, 10, 64)
+	if err != nil {
+		return "has an invalid limit"
+	}
+	size, unit, ok := measure(value)
+	if !ok || size <= n {
+		return ""
+	}
+	if unit == "" {
+		return fmt.Sprintf("must be at most %d", n)
+	}
+	return fmt.Sprintf("must be at most %d %s", n, plural(unit, n))
+}
+
+// maxBytes limits the length of strings in bytes rather than characters,
+// for limits of encoded text like bcrypt's
+func maxBytes(value reflect.Value, param string) string {
+	n, err := strconv.Atoi(param)
+	if err != nil {
+		return "has an invalid limit"
+	}
+	if value.Kind() != reflect.String || len(value.String()) <= n {
+		return ""
+	}
+	return fmt.Sprintf("must be at most %d %s when encoded as UTF-8", n, plural("byte", int64(n)))
+}
+
+// measure returns what min and max compare: the length of strings in
+// characters, of slices and maps in items, or the value of integers
+func measure(value reflect.Value) (int64, string, bool) {
+	switch value.Kind() {
+	case reflect.String:
+		return int64(utf8.RuneCountInString(value.String())), "character", true
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return int64(value.Len()), "item", true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return value.Int(), "", true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(value.Uint()), "", true
+	}
+	return 0, "", false
+}
+
+func plural(unit string, n int64) string {
+	if n == 1 {
+		return unit
+	}
+	return unit + "s"
+}
+
+func email(value reflect.Value, _ string) string {
+	if value.Kind() != reflect.String {
+		return ""
+	}
+	s := value.String()
+	addr, err := mail.ParseAddress(s)
+	// A bare address only, no display name or comments
+	if err != nil || addr.Address != s || addr.Name != "" {
+		return "must be a valid email address"
+	}
+	_, domain, _ := strings.Cut(addr.Address, "@")
+	if !strings.Contains(domain, ".") || strings.HasPrefix(domain, "[") {
+		return "must be a valid email address"
+	}
+	return ""
+}
+
+func oneOf(value reflect.Value, param string) string {
+	options := strings.Fields(param)
+	s := fmt.Sprint(value.Interface())
+	for _, option := range options {
+		if s == option {
+			return ""
+		}
+	}
+	return "must be one of: " + strings.Join(options, ", ")
+}
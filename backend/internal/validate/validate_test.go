@@ -0,0 +1,109 @@
+package validate
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+type address struct {
+	City string `json:"city" validate:"required,max=$maxCity"`
+}
+
+type person struct {
+	Name      string     `json:"name" validate:"required,notblank,max=20"`
+	Email     *string    `json:"email,omitempty" validate:"email"`
+	Addresses []*address `json:"addresses" validate:"max=2"`
+}
+
+func newTestValidator() *Validator {
+	v := New()
+	v.Set("maxCity", 10)
+	return v
+}
+
+func TestCheck(t *testing.T) {
+	type unknownRule struct {
+		Name string `validate:"required,shout"`
+	}
+	type unsetParam struct {
+		Name string `validate:"max=$maxName"`
+	}
+	type nested struct {
+		Items []struct {
+			Value int `validate:"between=1"`
+		}
+	}
+	type Embedded struct {
+		Name string `validate:"max=$maxName"`
+	}
+	type embedding struct {
+		Embedded
+	}
+
+	tests := []struct {
+		name    string
+		value   any
+		wantErr string // "" when the tags are valid
+	}{
+		{"valid tags", person{}, ""},
+		{"pointer to a struct", &person{}, ""},
+		{"unknown rule", unknownRule{}, `unknownRule.Name: unknown rule "shout"`},
+		{"unset parameter", unsetParam{}, "unsetParam.Name: parameter $maxName is not set"},
+		{"rule of a nested struct", nested{}, `Value: unknown rule "between"`},
+		{"embedded struct", embedding{}, "Embedded.Name: parameter $maxName is not set"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := newTestValidator().Check(tt.value)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("Check() error = %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("Check() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	err := newTestValidator().Check(unknownRule{}, unsetParam{})
+	if err == nil || !strings.Contains(err.Error(), "shout") || !strings.Contains(err.Error(), "$maxName") {
+		t.Errorf("Check() of two types = %v, want both mistakes", err)
+	}
+}
+
+func TestStruct(t *testing.T) {
+	blank, invalid := "", "not an email"
+
+	tests := []struct {
+		name   string
+		value  person
+		fields []string // fields reported, in order
+	}{
+		{"valid", person{Name: "Ada", Addresses: []*address{{City: "London"}}}, nil},
+		{"missing required field", person{}, []string{"name"}},
+		{"blank string counts as missing", person{Name: "  "}, []string{"name"}},
+		{"nil pointer is skipped", person{Name: "Ada", Email: nil}, nil},
+		{"empty pointer value is checked", person{Name: "Ada", Email: &blank}, []string{"email"}},
+		{"invalid pointer value", person{Name: "Ada", Email: &invalid}, []string{"email"}},
+		{"too long", person{Name: strings.Repeat("a", 21)}, []string{"name"}},
+		{"nested fields by JSON path", person{Name: "Ada", Addresses: []*address{{City: "Paris"}, {}}}, []string{"addresses[1].city"}},
+		{"configured parameter", person{Name: "Ada", Addresses: []*address{{City: "Llanfairpwllgwyngyll"}}}, []string{"addresses[0].city"}},
+		{"too many items", person{Name: "Ada", Addresses: []*address{{City: "A"}, {City: "B"}, {City: "C"}}}, []string{"addresses"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := newTestValidator().Struct(&tt.value)
+			var errs Errors
+			if err != nil && !errors.As(err, &errs) {
+				t.Fatalf("Struct() error = %v, want Errors", err)
+			}
+			var fields []string
+			for _, e := range errs {
+				fields = append(fields, e.Field)
+			}
+			if strings.Join(fields, " ") != strings.Join(tt.fields, " ") {
+				t.Errorf("Struct() reported %q, want %q (%v)", fields, tt.fields, err)
+			}
+		})
+	}
+}
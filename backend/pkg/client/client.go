@@ -0,0 +1,451 @@
+// Package client is a Go client for the copilot API.
+//
+//	c := client.New("https://copilot.example.com", client.WithToken(os.Getenv("COPILOT_TOKEN")))
+//	resp, err := c.Generate(ctx, client.GenerateRequest{Prompt: "parse a CSV file", Language: "go"})
+//
+// It authenticates with a session token from Login or with a personal
+// access token, refreshes session tokens before they expire, and retries
+// requests that failed for transient reasons.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// accessTokenPrefix starts personal access tokens, which don't expire
+	// like session tokens and aren't refreshed
+	accessTokenPrefix = "cgc_pat_"
+	// refreshBefore is how long before its expiry a session token is refreshed
+	refreshBefore = time.Hour
+	maxBackoff    = 30 * time.Second
+)
+
+// Error is returned when the API answers a request with an error
+type Error struct {
+	StatusCode int
+	Code       string // machine-readable, e.g. "not_found"
+	Message    string
+	Details    json.RawMessage // e.g. the fields that failed validation, nil if none
+	RequestID  string          // quote it when reporting a problem
+}
+
+// errorBody is the error member of a failure response
+type errorBody struct {
+	Code      string          `json:"code"`
+	Message   string          `json:"message"`
+	Details   json.RawMessage `json:"details"`
+	RequestID string          `json:"requestId"`
+}
+
+func (b *errorBody) toError(status int) *Error {
+	return &Error{StatusCode: status, Code: b.Code, Message: b.Message, Details: b.Details, RequestID: b.RequestID}
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("copilot: %s (%d)", e.Message, e.StatusCode)
+}
+
+// StatusCode returns the HTTP status of an *Error in err's chain, or 0
+func StatusCode(err error) int {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode
+	}
+	return 0
+}
+
+// Client calls the copilot API. It is safe for concurrent use.
+type Client struct {
+	baseURL string
+	http    *http.Client
+	retries int
+	backoff time.Duration
+	onToken func(token string)
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time // zero for tokens that don't expire
+	refreshMu sync.Mutex
+}
+
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client used for requests. Streams stay open
+// for the whole generation, so its timeout should allow for that.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.http = hc }
+}
+
+// WithToken authenticates requests with a session or personal access token
+func WithToken(token string) Option {
+	return func(c *Client) { c.setToken(token) }
+}
+
+// WithRetries sets how many times a request failing for a transient reason
+// is retried, and the delay before the first retry, which doubles with each
+// retry. The default is 3 retries starting at 500ms, 0 disables retries.
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = retries
+		c.backoff = backoff
+	}
+}
+
+// WithTokenCallback calls fn with every new session token, from Login,
+// Signup or a refresh, for instance to persist it
+func WithTokenCallback(fn func(token string)) Option {
+	return func(c *Client) { c.onToken = fn }
+}
+
+// New creates a client for the API at baseURL, e.g. "https://copilot.example.com"
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/") + "/api/v1",
+		http:    &http.Client{},
+		retries: 3,
+		backoff: 500 * time.Millisecond,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Token returns the token requests are authenticated with
+func (c *Client) Token() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.token
+}
+
+func (c *Client) setToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = token
+	c.expiresAt = tokenExpiry(token)
+}
+
+// Signup creates an account and authenticates the client as the new user
+func (c *Client) Signup(ctx context.Context, req SignupRequest) (*AuthResponse, error) {
+	var resp AuthResponse
+	if err := c.send(ctx, http.MethodPost, "/auth/signup", req, &resp, nil); err != nil {
+		return nil, err
+	}
+	c.newToken(resp.Token)
+	return &resp, nil
+}
+
+// Login authenticates the client with an email and password
+func (c *Client) Login(ctx context.Context, email, password string) (*AuthResponse, error) {
+	var resp AuthResponse
+	body := map[string]string{"email": email, "password": password}
+	if err := c.send(ctx, http.MethodPost, "/auth/login", body, &resp, nil); err != nil {
+		return nil, err
+	}
+	c.newToken(resp.Token)
+	return &resp, nil
+}
+
+// Refresh replaces the session token with a new one. Requests refresh the
+// token by themselves when it is about to expire.
+func (c *Client) Refresh(ctx context.Context) (*AuthResponse, error) {
+	var resp AuthResponse
+	if err := c.send(ctx, http.MethodPost, "/auth/refresh", nil, &resp, nil); err != nil {
+		return nil, err
+	}
+	c.newToken(resp.Token)
+	return &resp, nil
+}
+
+func (c *Client) newToken(token string) {
+	c.setToken(token)
+	if c.onToken != nil {
+		c.onToken(token)
+	}
+}
+
+// Generate sends a prompt, to a new chat unless req.ChatID is set
+func (c *Client) Generate(ctx context.Context, req GenerateRequest) (*GenerateResponse, error) {
+	var resp GenerateResponse
+	if err := c.do(ctx, http.MethodPost, "/generate", req, &resp, nil); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Complete returns inline completions for the code around a cursor
+func (c *Client) Complete(ctx context.Context, req CompleteRequest) (*CompleteResponse, error) {
+	var resp CompleteResponse
+	if err := c.do(ctx, http.MethodPost, "/complete", req, &resp, nil); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// CreateChat creates an empty chat
+func (c *Client) CreateChat(ctx context.Context, req CreateChatRequest) (*Chat, error) {
+	var chat Chat
+	if err := c.do(ctx, http.MethodPost, "/chats", req, &chat, nil); err != nil {
+		return nil, err
+	}
+	return &chat, nil
+}
+
+// ListChats returns a page of the user's chats, or of a workspace's
+func (c *Client) ListChats(ctx context.Context, opts ListChatsOptions) (*ChatList, error) {
+	query := url.Values{}
+	if opts.WorkspaceID != nil {
+		query.Set("workspaceId", strconv.Itoa(*opts.WorkspaceID))
+	}
+	if opts.Archived != nil {
+		query.Set("archived", strconv.FormatBool(*opts.Archived))
+	}
+	if opts.Pinned != nil {
+		query.Set("pinned", strconv.FormatBool(*opts.Pinned))
+	}
+	if opts.Trashed {
+		query.Set("trashed", "true")
+	}
+	if opts.Limit > 0 {
+		query.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	if opts.Cursor != "" {
+		query.Set("cursor", opts.Cursor)
+	}
+
+	var list ChatList
+	if err := c.do(ctx, http.MethodGet, "/chats?"+query.Encode(), nil, &list.Chats, &list.NextCursor); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// GetChat returns a chat with the latest messages of its active branch.
+// Pass the previous response's NextCursor to load older messages.
+func (c *Client) GetChat(ctx context.Context, id int, cursor string) (*ChatWithMessages, error) {
+	path := fmt.Sprintf("/chats/%d", id)
+	if cursor != "" {
+		path += "?cursor=" + url.QueryEscape(cursor)
+	}
+
+	var resp ChatWithMessages
+	if err := c.do(ctx, http.MethodGet, path, nil, &resp, nil); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// GetChatMessages returns a chat with its whole active branch, oldest first
+func (c *Client) GetChatMessages(ctx context.Context, id int) (*ChatWithMessages, error) {
+	resp, err := c.GetChat(ctx, id, "")
+	if err != nil {
+		return nil, err
+	}
+	for resp.NextCursor != "" {
+		older, err := c.GetChat(ctx, id, resp.NextCursor)
+		if err != nil {
+			return nil, err
+		}
+		resp.Messages = append(older.Messages, resp.Messages...)
+		resp.NextCursor = older.NextCursor
+	}
+	return resp, nil
+}
+
+// UpdateChat renames, pins or archives a chat
+func (c *Client) UpdateChat(ctx context.Context, id int, req UpdateChatRequest) (*Chat, error) {
+	var chat Chat
+	if err := c.do(ctx, http.MethodPatch, fmt.Sprintf("/chats/%d", id), req, &chat, nil); err != nil {
+		return nil, err
+	}
+	return &chat, nil
+}
+
+// DeleteChat moves a chat to the trash
+func (c *Client) DeleteChat(ctx context.Context, id int) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/chats/%d", id), nil, nil, nil)
+}
+
+// do sends an authenticated request, refreshing the session token first
+// when it is about to expire
+func (c *Client) do(ctx context.Context, method, path string, body, data any, cursor *string) error {
+	if err := c.refreshIfExpiring(ctx); err != nil {
+		return err
+	}
+	return c.send(ctx, method, path, body, data, cursor)
+}
+
+func (c *Client) refreshIfExpiring(ctx context.Context) error {
+	if !c.expiring() {
+		return nil
+	}
+
+	// Concurrent requests refresh once
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+	if !c.expiring() {
+		return nil
+	}
+
+	_, err := c.Refresh(ctx)
+	return err
+}
+
+func (c *Client) expiring() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return !c.expiresAt.IsZero() && time.Until(c.expiresAt) < refreshBefore
+}
+
+// send sends a request, retrying transient failures, and decodes the data
+// of the response envelope into data and its page cursor into cursor
+func (c *Client) send(ctx context.Context, method, path string, body, data any, cursor *string) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, err := c.request(ctx, method, path, payload, "application/json")
+		if err == nil {
+			err = decodeEnvelope(resp, data, cursor)
+		}
+
+		wait, retry := c.retryAfter(method, attempt, resp, err)
+		if !retry {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (c *Client) request(ctx context.Context, method, path string, payload []byte, accept string) (*http.Response, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", accept)
+	if token := c.Token(); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return c.http.Do(req)
+}
+
+// retryAfter decides whether a failed attempt is retried and after how
+// long. Requests that create something (POST) are only retried when the
+// server refused them before doing any work, other failures could have
+// happened after the work was done.
+func (c *Client) retryAfter(method string, attempt int, resp *http.Response, err error) (time.Duration, bool) {
+	if err == nil || attempt >= c.retries {
+		return 0, false
+	}
+
+	var status int
+	if resp != nil {
+		status = resp.StatusCode
+	}
+	switch {
+	case status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable:
+	case method == http.MethodPost:
+		return 0, false
+	case status == http.StatusBadGateway || status == http.StatusGatewayTimeout:
+	case status == 0 && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded):
+		// The request didn't get a response, e.g. the connection failed
+	default:
+		return 0, false
+	}
+
+	if resp != nil {
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+			return min(time.Duration(seconds)*time.Second, maxBackoff), true
+		}
+	}
+
+	// Exponential backoff with jitter, so clients don't retry in lockstep
+	wait := min(c.backoff<<attempt, maxBackoff)
+	return wait/2 + rand.N(wait/2+1), true
+}
+
+// decodeEnvelope reads a {success, message, data} or {success, error}
+// response and closes its body
+func decodeEnvelope(resp *http.Response, data any, cursor *string) error {
+	defer resp.Body.Close()
+
+	var envelope struct {
+		Success    bool            `json:"success"`
+		Error      *errorBody      `json:"error"`
+		Data       json.RawMessage `json:"data"`
+		NextCursor string          `json:"nextCursor"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return &Error{StatusCode: resp.StatusCode, Message: "unexpected response: " + resp.Status}
+	}
+	if !envelope.Success || resp.StatusCode >= 400 {
+		if envelope.Error == nil {
+			envelope.Error = &errorBody{}
+		}
+		if envelope.Error.Message == "" {
+			envelope.Error.Message = resp.Status
+		}
+		return envelope.Error.toError(resp.StatusCode)
+	}
+
+	if cursor != nil {
+		*cursor = envelope.NextCursor
+	}
+	if data != nil && len(envelope.Data) > 0 && string(envelope.Data) != "null" {
+		return json.Unmarshal(envelope.Data, data)
+	}
+	return nil
+}
+
+// tokenExpiry reads the expiry of a session token without verifying it,
+// the zero time for personal access tokens and tokens it can't read
+func tokenExpiry(token string) time.Time {
+	if token == "" || strings.HasPrefix(token, accessTokenPrefix) {
+		return time.Time{}
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return time.Time{}
+	}
+	return time.Unix(claims.Exp, 0)
+}
@@ -0,0 +1,454 @@
+package client
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// sessionToken returns an unsigned JWT expiring at exp, enough for the
+// client, which reads the expiry without verifying the token
+func sessionToken(name string, exp time.Time) string {
+	encode := func(v any) string {
+		b, _ := json.Marshal(v)
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	return encode(map[string]string{"alg": "HS256", "typ": "JWT"}) + "." +
+		encode(map[string]any{"sub": name, "exp": exp.Unix()}) + ".sig"
+}
+
+func writeData(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{"success": true, "data": data})
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{
+		"success": false,
+		"error":   map[string]string{"code": code, "message": message, "requestId": "req-1"},
+	})
+}
+
+func TestLoginAndRefresh(t *testing.T) {
+	expiring := sessionToken("expiring", time.Now().Add(30*time.Minute))
+	fresh := sessionToken("fresh", time.Now().Add(24*time.Hour))
+
+	var refreshes atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/auth/login", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["email"] != "dev@example.com" || body["password"] != "secret" {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "Invalid credentials")
+			return
+		}
+		writeData(w, http.StatusOK, AuthResponse{Token: expiring, User: User{ID: 1, Email: "dev@example.com"}})
+	})
+	mux.HandleFunc("POST /api/v1/auth/refresh", func(w http.ResponseWriter, r *http.Request) {
+		refreshes.Add(1)
+		if r.Header.Get("Authorization") != "Bearer "+expiring {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "Invalid or expired token")
+			return
+		}
+		writeData(w, http.StatusOK, AuthResponse{Token: fresh, User: User{ID: 1}})
+	})
+	mux.HandleFunc("GET /api/v1/chats", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+fresh {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "Invalid or expired token")
+			return
+		}
+		writeData(w, http.StatusOK, []Chat{{ID: 7, Title: "Parser"}})
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	var mu sync.Mutex
+	var saved []string
+	c := New(srv.URL, WithTokenCallback(func(token string) {
+		mu.Lock()
+		defer mu.Unlock()
+		saved = append(saved, token)
+	}))
+
+	if _, err := c.Login(context.Background(), "dev@example.com", "wrong"); StatusCode(err) != http.StatusUnauthorized {
+		t.Fatalf("Login() with a wrong password: error = %v, want a 401", err)
+	}
+	resp, err := c.Login(context.Background(), "dev@example.com", "secret")
+	if err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	if resp.User.Email != "dev@example.com" || c.Token() != expiring {
+		t.Fatalf("Login() = %+v, token %q", resp, c.Token())
+	}
+
+	// The token expires within refreshBefore, so the next requests refresh
+	// it first, once however many run at the same time
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			list, err := c.ListChats(context.Background(), ListChatsOptions{})
+			if err == nil && (len(list.Chats) != 1 || list.Chats[0].ID != 7) {
+				err = fmt.Errorf("unexpected chats %+v", list.Chats)
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("ListChats() error = %v", err)
+		}
+	}
+
+	if n := refreshes.Load(); n != 1 {
+		t.Errorf("token refreshed %d times, want 1", n)
+	}
+	if c.Token() != fresh {
+		t.Errorf("Token() = %q, want the refreshed token", c.Token())
+	}
+	if len(saved) != 2 || saved[0] != expiring || saved[1] != fresh {
+		t.Errorf("token callback got %q, want the login and refreshed tokens", saved)
+	}
+}
+
+func TestAccessTokensAreNotRefreshed(t *testing.T) {
+	var refreshes atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/v1/auth/refresh", func(w http.ResponseWriter, r *http.Request) {
+		refreshes.Add(1)
+		writeError(w, http.StatusForbidden, "forbidden", "Sessions only")
+	})
+	mux.HandleFunc("GET /api/v1/chats/{id}", func(w http.ResponseWriter, r *http.Request) {
+		writeData(w, http.StatusOK, ChatWithMessages{Chat: Chat{ID: 3}})
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	c := New(srv.URL, WithToken("cgc_pat_abcdef"))
+	if _, err := c.GetChat(context.Background(), 3, ""); err != nil {
+		t.Fatalf("GetChat() error = %v", err)
+	}
+	if n := refreshes.Load(); n != 0 {
+		t.Errorf("access token refreshed %d times, want 0", n)
+	}
+}
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		statuses     []int // returned in turn, then 200
+		wantAttempts int
+		wantStatus   int // status of the returned error, 0 for success
+	}{
+		{"GET retried on 503", http.MethodGet, []int{503, 503}, 3, 0},
+		{"GET retried on 429", http.MethodGet, []int{429}, 2, 0},
+		{"GET retried on 502", http.MethodGet, []int{502}, 2, 0},
+		{"GET retried on 504", http.MethodGet, []int{504}, 2, 0},
+		{"GET gives up after the retries", http.MethodGet, []int{503, 503, 503, 503, 503}, 4, 503},
+		{"GET not retried on 500", http.MethodGet, []int{500}, 1, 500},
+		{"GET not retried on 400", http.MethodGet, []int{400}, 1, 400},
+		{"GET not retried on 401", http.MethodGet, []int{401}, 1, 401},
+		{"GET not retried on 404", http.MethodGet, []int{404}, 1, 404},
+		{"POST retried on 429", http.MethodPost, []int{429}, 2, 0},
+		{"POST retried on 503", http.MethodPost, []int{503, 503}, 3, 0},
+		{"POST not retried on 502", http.MethodPost, []int{502}, 1, 502},
+		{"POST not retried on 504", http.MethodPost, []int{504}, 1, 504},
+		{"POST not retried on 422", http.MethodPost, []int{422}, 1, 422},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var bodies []string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				mu.Lock()
+				attempt := len(bodies)
+				bodies = append(bodies, string(body))
+				mu.Unlock()
+
+				if attempt < len(tt.statuses) {
+					writeError(w, tt.statuses[attempt], "error", http.StatusText(tt.statuses[attempt]))
+					return
+				}
+				if r.Method == http.MethodPost {
+					writeData(w, http.StatusOK, GenerateResponse{ChatID: 1, Code: "ok"})
+				} else {
+					writeData(w, http.StatusOK, ChatWithMessages{Chat: Chat{ID: 1}})
+				}
+			}))
+			defer srv.Close()
+
+			c := New(srv.URL, WithRetries(3, time.Millisecond))
+			var err error
+			if tt.method == http.MethodPost {
+				_, err = c.Generate(context.Background(), GenerateRequest{Prompt: "parse a CSV file", Language: "go"})
+			} else {
+				_, err = c.GetChat(context.Background(), 1, "")
+			}
+
+			if got := StatusCode(err); got != tt.wantStatus {
+				t.Fatalf("error = %v, want status %d", err, tt.wantStatus)
+			}
+			if len(bodies) != tt.wantAttempts {
+				t.Fatalf("%d attempts, want %d", len(bodies), tt.wantAttempts)
+			}
+			// Retried requests send the same body again
+			for i, body := range bodies {
+				if body != bodies[0] {
+					t.Errorf("attempt %d sent %q, the first one %q", i+1, body, bodies[0])
+				}
+			}
+			if tt.method == http.MethodPost && !strings.Contains(bodies[0], `"prompt":"parse a CSV file"`) {
+				t.Errorf("request body = %q", bodies[0])
+			}
+		})
+	}
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "not_found", "Chat not found")
+	}))
+	defer srv.Close()
+
+	_, err := New(srv.URL).GetChat(context.Background(), 9, "")
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("error = %v, want an *Error", err)
+	}
+	if apiErr.StatusCode != 404 || apiErr.Code != "not_found" || apiErr.Message != "Chat not found" || apiErr.RequestID != "req-1" {
+		t.Errorf("error = %+v", apiErr)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	c := New("http://localhost", WithRetries(10, 100*time.Millisecond))
+	unavailable := func(retryAfter string) *http.Response {
+		resp := &http.Response{StatusCode: http.StatusServiceUnavailable, Header: http.Header{}}
+		if retryAfter != "" {
+			resp.Header.Set("Retry-After", retryAfter)
+		}
+		return resp
+	}
+	apiErr := &Error{StatusCode: http.StatusServiceUnavailable}
+
+	// Exponential backoff with jitter: between half and all of the doubled
+	// delay, capped at maxBackoff
+	for attempt := range 10 {
+		full := min(100*time.Millisecond<<attempt, maxBackoff)
+		wait, retry := c.retryAfter(http.MethodGet, attempt, unavailable(""), apiErr)
+		if !retry || wait < full/2 || wait > full {
+			t.Errorf("attempt %d: waits %v (retry %v), want between %v and %v", attempt, wait, retry, full/2, full)
+		}
+	}
+
+	if _, retry := c.retryAfter(http.MethodGet, 10, unavailable(""), apiErr); retry {
+		t.Error("retried after the last attempt")
+	}
+	if wait, _ := c.retryAfter(http.MethodGet, 0, unavailable("2"), apiErr); wait != 2*time.Second {
+		t.Errorf("Retry-After: 2 waits %v, want 2s", wait)
+	}
+	if wait, _ := c.retryAfter(http.MethodGet, 0, unavailable("3600"), apiErr); wait != maxBackoff {
+		t.Errorf("Retry-After: 3600 waits %v, want %v", wait, maxBackoff)
+	}
+
+	// Requests that got no response
+	connErr := errors.New("connection refused")
+	if _, retry := c.retryAfter(http.MethodGet, 0, nil, connErr); !retry {
+		t.Error("GET not retried after a connection error")
+	}
+	if _, retry := c.retryAfter(http.MethodPost, 0, nil, connErr); retry {
+		t.Error("POST retried after a connection error")
+	}
+	if _, retry := c.retryAfter(http.MethodGet, 0, nil, context.Canceled); retry {
+		t.Error("GET retried after being canceled")
+	}
+}
+
+func TestRetryStopsWhenCanceled(t *testing.T) {
+	var attempts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		writeError(w, http.StatusServiceUnavailable, "unavailable", "Try again")
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := New(srv.URL, WithRetries(5, time.Hour)).GetChat(ctx, 1, "")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("error = %v, want the context's", err)
+	}
+	if n := attempts.Load(); n != 1 {
+		t.Errorf("%d attempts, want 1", n)
+	}
+}
+
+// streamServer answers /generate/stream with the given events, written
+// as the server does
+func streamServer(t *testing.T, events ...string) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/generate/stream" || r.Header.Get("Accept") != "text/event-stream" {
+			writeError(w, http.StatusNotFound, "not_found", "Not found")
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, event := range events {
+			io.WriteString(w, event)
+			w.(http.Flusher).Flush()
+		}
+	}))
+}
+
+func TestGenerateStream(t *testing.T) {
+	srv := streamServer(t,
+		": connected\n\n",
+		"event: chunk\ndata: {\"text\":\"func \"}\n\n",
+		"event: chunk\ndata: {\"text\":\"main() {}\"}\n\n",
+		"event: done\ndata: {\"chatId\":4,\"messageId\":12,\"mode\":\"generate\",\"code\":\"func main() {}\"}\n\n",
+	)
+	defer srv.Close()
+
+	var text strings.Builder
+	resp, err := New(srv.URL).GenerateStream(context.Background(), GenerateRequest{Prompt: "an empty main"}, func(chunk string) error {
+		text.WriteString(chunk)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("GenerateStream() error = %v", err)
+	}
+	if text.String() != "func main() {}" {
+		t.Errorf("streamed text = %q", text.String())
+	}
+	if resp.ChatID != 4 || resp.MessageID != 12 || resp.Code != "func main() {}" {
+		t.Errorf("GenerateStream() = %+v", resp)
+	}
+}
+
+func TestGenerateStreamErrors(t *testing.T) {
+	errStop := errors.New("stop")
+	tests := []struct {
+		name       string
+		events     []string
+		onText     func(string) error
+		wantChunks int
+		check      func(t *testing.T, err error)
+	}{
+		{
+			name: "error event after chunks",
+			events: []string{
+				"event: chunk\ndata: {\"text\":\"partial\"}\n\n",
+				"event: error\ndata: {\"status\":502,\"code\":\"provider_error\",\"message\":\"Generation failed\",\"requestId\":\"req-9\"}\n\n",
+			},
+			wantChunks: 1,
+			check: func(t *testing.T, err error) {
+				var apiErr *Error
+				if !errors.As(err, &apiErr) {
+					t.Fatalf("error = %v, want an *Error", err)
+				}
+				if apiErr.StatusCode != 502 || apiErr.Code != "provider_error" || apiErr.Message != "Generation failed" || apiErr.RequestID != "req-9" {
+					t.Errorf("error = %+v", apiErr)
+				}
+			},
+		},
+		{
+			name:       "stream ending without done",
+			events:     []string{"event: chunk\ndata: {\"text\":\"partial\"}\n\n"},
+			wantChunks: 1,
+			check: func(t *testing.T, err error) {
+				if err == nil || StatusCode(err) != 0 {
+					t.Errorf("error = %v, want an incomplete stream error", err)
+				}
+			},
+		},
+		{
+			name: "onText stops the stream",
+			events: []string{
+				"event: chunk\ndata: {\"text\":\"a\"}\n\n",
+				"event: chunk\ndata: {\"text\":\"b\"}\n\n",
+				"event: done\ndata: {\"chatId\":1}\n\n",
+			},
+			onText:     func(string) error { return errStop },
+			wantChunks: 1,
+			check: func(t *testing.T, err error) {
+				if !errors.Is(err, errStop) {
+					t.Errorf("error = %v, want onText's", err)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := streamServer(t, tt.events...)
+			defer srv.Close()
+
+			chunks := 0
+			_, err := New(srv.URL).GenerateStream(context.Background(), GenerateRequest{Prompt: "x"}, func(text string) error {
+				chunks++
+				if tt.onText != nil {
+					return tt.onText(text)
+				}
+				return nil
+			})
+			if chunks != tt.wantChunks {
+				t.Errorf("onText called %d times, want %d", chunks, tt.wantChunks)
+			}
+			tt.check(t, err)
+		})
+	}
+}
+
+func TestGenerateStreamRejected(t *testing.T) {
+	// Errors before the stream starts come in the usual envelope
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusBadRequest, "validation_failed", "Invalid request")
+	}))
+	defer srv.Close()
+
+	_, err := New(srv.URL).GenerateStream(context.Background(), GenerateRequest{}, func(string) error { return nil })
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != 400 || apiErr.Code != "validation_failed" {
+		t.Fatalf("error = %v, want the 400 validation error", err)
+	}
+}
+
+func TestReadEvents(t *testing.T) {
+	stream := "event: chunk\ndata: first line\ndata: second line\n\n" +
+		": comment\n\n" +
+		"data: unnamed\n\n" +
+		"event: done\ndata:{}\n\n"
+
+	type event struct{ name, data string }
+	var got []event
+	err := readEvents(&http.Response{Body: io.NopCloser(strings.NewReader(stream))}, func(name string, data []byte) error {
+		got = append(got, event{name, string(data)})
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("readEvents() error = %v", err)
+	}
+
+	want := []event{{"chunk", "first line\nsecond line"}, {"message", "unnamed"}, {"done", "{}"}}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+}
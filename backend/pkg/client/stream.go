@@ -0,0 +1,116 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// maxEventSize bounds a single server-sent event
+const maxEventSize = 4 << 20
+
+// GenerateStream is Generate with the reply streamed: onText receives its
+// text as the model writes it, and the final response is returned once it
+// is saved. In all modes but generate the streamed text is the model's raw
+// JSON, use the returned response for the parsed result. An error returned
+// by onText stops the stream. Streams are single candidate and not retried.
+func (c *Client) GenerateStream(ctx context.Context, req GenerateRequest, onText func(text string) error) (*GenerateResponse, error) {
+	if err := c.refreshIfExpiring(ctx); err != nil {
+		return nil, err
+	}
+
+	payload, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Canceling stops the server's generation when onText gives up
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	resp, err := c.request(ctx, http.MethodPost, "/generate/stream", payload, "text/event-stream")
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		// Errors before the stream started come in the usual envelope
+		if err := decodeEnvelope(resp, nil, nil); err != nil {
+			return nil, err
+		}
+		return nil, &Error{StatusCode: resp.StatusCode, Message: "expected an event stream"}
+	}
+	defer resp.Body.Close()
+
+	var result *GenerateResponse
+	err = readEvents(resp, func(event string, data []byte) error {
+		switch event {
+		case "chunk":
+			var chunk struct {
+				Text string `json:"text"`
+			}
+			if err := json.Unmarshal(data, &chunk); err != nil {
+				return err
+			}
+			return onText(chunk.Text)
+		case "done":
+			result = &GenerateResponse{}
+			return json.Unmarshal(data, result)
+		case "error":
+			var apiErr struct {
+				Status int `json:"status"`
+				errorBody
+			}
+			if err := json.Unmarshal(data, &apiErr); err != nil {
+				return err
+			}
+			return apiErr.toError(apiErr.Status)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return nil, errors.New("copilot: the stream ended before the response was complete")
+	}
+	return result, nil
+}
+
+// readEvents parses a server-sent event stream, calling fn with the name
+// and data of each event until the stream ends or fn fails
+func readEvents(resp *http.Response, fn func(event string, data []byte) error) error {
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64<<10), maxEventSize)
+
+	event := "message"
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			if len(data) > 0 {
+				if err := fn(event, []byte(strings.Join(data, "\n"))); err != nil {
+					return err
+				}
+			}
+			event, data = "message", nil
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			event = value
+		case "data":
+			data = append(data, value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("copilot: reading stream: %w", err)
+	}
+	return nil
+}
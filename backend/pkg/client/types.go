@@ -0,0 +1,162 @@
+package client
+
+import "encoding/json"
+
+// The types mirror the request and response bodies of the API handlers.
+// Times are RFC 3339 strings, as the API sends them.
+
+type SignupRequest struct {
+	Name     string `json:"name"`
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type User struct {
+	ID        int    `json:"id"`
+	Name      string `json:"name"`
+	Email     string `json:"email"`
+	Role      string `json:"role"`
+	CreatedAt string `json:"createdAt"`
+}
+
+// AuthResponse is returned by signup, login and refresh
+type AuthResponse struct {
+	User  User   `json:"user"`
+	Token string `json:"token"`
+}
+
+// Modes of GenerateRequest
+const (
+	ModeGenerate  = "generate"
+	ModeExplain   = "explain"
+	ModeRefactor  = "refactor"
+	ModeReview    = "review"
+	ModeTests     = "tests"
+	ModeTranslate = "translate"
+	ModeEdit      = "edit"
+)
+
+type GenerateRequest struct {
+	ChatID          *int   `json:"chatId,omitempty"`
+	WorkspaceID     *int   `json:"workspaceId,omitempty"` // workspace for a new chat
+	Mode            string `json:"mode,omitempty"`        // one of the Mode constants, ModeGenerate by default
+	Prompt          string `json:"prompt"`                // description, instruction or question
+	Language        string `json:"language"`
+	Code            string `json:"code,omitempty"`            // code to work on, or context in generate mode
+	SourceMessageID *int   `json:"sourceMessageId,omitempty"` // reply to take the code from instead of code
+	TargetLanguage  string `json:"targetLanguage,omitempty"`  // translate only
+	Candidates      int    `json:"candidates,omitempty"`      // alternative replies to generate, default 1
+	Ephemeral       bool   `json:"ephemeral,omitempty"`       // answer without saving a chat, the IDs in the response are 0
+}
+
+type GenerateResponse struct {
+	ChatID     int             `json:"chatId"`
+	PromptID   int             `json:"promptId"`  // the saved user message
+	MessageID  int             `json:"messageId"` // the saved assistant reply, the first candidate
+	Mode       string          `json:"mode"`
+	Code       string          `json:"code"`                 // the code, or markdown for explain and review
+	Result     json.RawMessage `json:"result,omitempty"`     // structured reply, all modes but generate
+	Candidates []Candidate     `json:"candidates,omitempty"` // set when more than one was requested
+}
+
+type Candidate struct {
+	MessageID int             `json:"messageId"`
+	Code      string          `json:"code"`
+	Result    json.RawMessage `json:"result,omitempty"`
+}
+
+type CompleteRequest struct {
+	Prefix     string   `json:"prefix"`
+	Suffix     string   `json:"suffix,omitempty"`
+	Language   string   `json:"language,omitempty"`
+	FilePath   string   `json:"filePath,omitempty"`
+	Candidates int      `json:"candidates,omitempty"` // completions to return, default 1
+	Stop       []string `json:"stop,omitempty"`       // the completion ends before the first of these
+	MaxTokens  int      `json:"maxTokens,omitempty"`
+}
+
+type CompleteResponse struct {
+	Completions []Completion `json:"completions"` // best first, empty when there is nothing to suggest
+	Model       string       `json:"model,omitempty"`
+	Cached      bool         `json:"cached"`
+}
+
+type Completion struct {
+	Text string `json:"text"` // to be inserted at the cursor
+	Rank int    `json:"rank"` // 1 for the best completion
+}
+
+type CreateChatRequest struct {
+	Title       string `json:"title"`
+	WorkspaceID *int   `json:"workspaceId,omitempty"`
+}
+
+type UpdateChatRequest struct {
+	Title    *string `json:"title,omitempty"`
+	Pinned   *bool   `json:"pinned,omitempty"`
+	Archived *bool   `json:"archived,omitempty"`
+}
+
+type Chat struct {
+	ID              int    `json:"id"`
+	Title           string `json:"title"`
+	UserID          int    `json:"userId,omitempty"`
+	WorkspaceID     *int   `json:"workspaceId,omitempty"`
+	ActiveMessageID *int   `json:"activeMessageId,omitempty"`
+	Pinned          bool   `json:"pinned"`
+	ArchivedAt      string `json:"archivedAt,omitempty"`
+	DeletedAt       string `json:"deletedAt,omitempty"`
+	CreatedAt       string `json:"createdAt"`
+	UpdatedAt       string `json:"updatedAt"`
+}
+
+type Message struct {
+	ID        int             `json:"id"`
+	ChatID    int             `json:"chatId"`
+	ParentID  *int            `json:"parentId,omitempty"`
+	Role      string          `json:"role"`
+	Content   string          `json:"content"`
+	Language  string          `json:"language,omitempty"`
+	Model     string          `json:"model,omitempty"`
+	Mode      string          `json:"mode"`
+	Metadata  json.RawMessage `json:"metadata,omitempty"` // task input of a prompt, structured result of a reply
+	Branch    *BranchInfo     `json:"branch,omitempty"`   // set when the message has alternatives
+	Feedback  *Feedback       `json:"feedback,omitempty"` // the current user's rating
+	CreatedAt string          `json:"createdAt"`
+}
+
+type BranchInfo struct {
+	SiblingIDs []int `json:"siblingIds"` // oldest first, including the message itself
+	Index      int   `json:"index"`      // position of the message in SiblingIDs
+}
+
+type Feedback struct {
+	Rating    string `json:"rating"` // "up" or "down"
+	Category  string `json:"category,omitempty"`
+	Comment   string `json:"comment,omitempty"`
+	UpdatedAt string `json:"updatedAt"`
+}
+
+// ChatWithMessages is a chat with a page of its active branch, oldest first
+type ChatWithMessages struct {
+	Chat       Chat      `json:"chat"`
+	Messages   []Message `json:"messages"`
+	NextCursor string    `json:"nextCursor,omitempty"` // loads older messages
+}
+
+// ChatList is a page of chats, most recently updated first
+type ChatList struct {
+	Chats      []Chat
+	NextCursor string // empty on the last page
+}
+
+// ListChatsOptions filters and pages ListChats. Zero values leave the
+// server's defaults.
+type ListChatsOptions struct {
+	WorkspaceID *int
+	Archived    *bool
+	Pinned      *bool
+	Trashed     bool
+	Limit       int
+	Cursor      string
+}
@@ -0,0 +1,7 @@
+-- AlterTable
+ALTER TABLE "users" ADD COLUMN "role" TEXT NOT NULL DEFAULT 'user',
+ADD COLUMN "disabled_at" TIMESTAMP(3),
+ADD COLUMN "token_version" INTEGER NOT NULL DEFAULT 0;
+
+-- CreateIndex
+CREATE INDEX "users_role_idx" ON "users"("role");
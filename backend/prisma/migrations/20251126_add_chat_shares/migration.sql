@@ -0,0 +1,24 @@
+-- CreateTable
+CREATE TABLE "chat_shares" (
+    "id" SERIAL NOT NULL,
+    "chat_id" INTEGER NOT NULL,
+    "token" TEXT NOT NULL,
+    "created_by" INTEGER NOT NULL,
+    "expires_at" TIMESTAMP(3),
+    "revoked_at" TIMESTAMP(3),
+    "created_at" TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "chat_shares_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateIndex
+CREATE UNIQUE INDEX "chat_shares_token_key" ON "chat_shares"("token");
+
+-- CreateIndex
+CREATE INDEX "chat_shares_chat_id_idx" ON "chat_shares"("chat_id");
+
+-- AddForeignKey
+ALTER TABLE "chat_shares" ADD CONSTRAINT "chat_shares_chat_id_fkey" FOREIGN KEY ("chat_id") REFERENCES "chats"("id") ON DELETE CASCADE ON UPDATE CASCADE;
+
+-- AddForeignKey
+ALTER TABLE "chat_shares" ADD CONSTRAINT "chat_shares_created_by_fkey" FOREIGN KEY ("created_by") REFERENCES "users"("id") ON DELETE CASCADE ON UPDATE CASCADE;
@@ -0,0 +1,7 @@
+-- AlterTable
+ALTER TABLE "chats" ADD COLUMN "pinned" BOOLEAN NOT NULL DEFAULT false,
+ADD COLUMN "archived_at" TIMESTAMP(3),
+ADD COLUMN "deleted_at" TIMESTAMP(3);
+
+-- CreateIndex
+CREATE INDEX "chats_deleted_at_idx" ON "chats"("deleted_at");
@@ -0,0 +1,13 @@
+-- AlterTable
+-- The 'simple' configuration avoids stemming and stop words, which would
+-- mangle identifiers and keywords in code
+ALTER TABLE "messages" ADD COLUMN "search_vector" tsvector GENERATED ALWAYS AS (to_tsvector('simple', "content")) STORED;
+
+-- AlterTable
+ALTER TABLE "chats" ADD COLUMN "search_vector" tsvector GENERATED ALWAYS AS (to_tsvector('simple', "title")) STORED;
+
+-- CreateIndex
+CREATE INDEX "messages_search_vector_idx" ON "messages" USING GIN ("search_vector");
+
+-- CreateIndex
+CREATE INDEX "chats_search_vector_idx" ON "chats" USING GIN ("search_vector");
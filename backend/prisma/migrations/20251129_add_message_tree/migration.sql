@@ -0,0 +1,35 @@
+-- AlterTable
+ALTER TABLE "messages" ADD COLUMN "parent_id" INTEGER;
+
+-- AlterTable
+ALTER TABLE "chats" ADD COLUMN "active_message_id" INTEGER;
+
+-- Backfill: existing chats are linear, so each message's parent is the one before it
+UPDATE "messages" AS m
+SET "parent_id" = p."prev_id"
+FROM (
+    SELECT "id", LAG("id") OVER (PARTITION BY "chat_id" ORDER BY "created_at", "id") AS "prev_id"
+    FROM "messages"
+) AS p
+WHERE m."id" = p."id";
+
+-- Backfill: the active branch ends at the latest message
+UPDATE "chats" AS c
+SET "active_message_id" = (
+    SELECT "id" FROM "messages"
+    WHERE "chat_id" = c."id"
+    ORDER BY "created_at" DESC, "id" DESC
+    LIMIT 1
+);
+
+-- CreateIndex
+CREATE INDEX "messages_parent_id_idx" ON "messages"("parent_id");
+
+-- CreateIndex
+CREATE UNIQUE INDEX "chats_active_message_id_key" ON "chats"("active_message_id");
+
+-- AddForeignKey
+ALTER TABLE "messages" ADD CONSTRAINT "messages_parent_id_fkey" FOREIGN KEY ("parent_id") REFERENCES "messages"("id") ON DELETE CASCADE ON UPDATE CASCADE;
+
+-- AddForeignKey
+ALTER TABLE "chats" ADD CONSTRAINT "chats_active_message_id_fkey" FOREIGN KEY ("active_message_id") REFERENCES "messages"("id") ON DELETE SET NULL ON UPDATE CASCADE;
@@ -0,0 +1,47 @@
+-- CreateTable
+CREATE TABLE "snippets" (
+    "id" SERIAL NOT NULL,
+    "user_id" INTEGER NOT NULL,
+    "message_id" INTEGER,
+    "name" TEXT NOT NULL,
+    "language" TEXT,
+    "tags" TEXT[] NOT NULL DEFAULT ARRAY[]::TEXT[],
+    "current_version" INTEGER NOT NULL DEFAULT 1,
+    "created_at" TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMP(3) NOT NULL,
+
+    CONSTRAINT "snippets_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateTable
+CREATE TABLE "snippet_versions" (
+    "id" SERIAL NOT NULL,
+    "snippet_id" INTEGER NOT NULL,
+    "version" INTEGER NOT NULL,
+    "content" TEXT NOT NULL,
+    "message_id" INTEGER,
+    "created_at" TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "snippet_versions_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateIndex
+CREATE INDEX "snippets_user_id_updated_at_idx" ON "snippets"("user_id", "updated_at");
+
+-- CreateIndex
+CREATE INDEX "snippets_tags_idx" ON "snippets" USING GIN ("tags");
+
+-- CreateIndex
+CREATE UNIQUE INDEX "snippet_versions_snippet_id_version_key" ON "snippet_versions"("snippet_id", "version");
+
+-- AddForeignKey
+ALTER TABLE "snippets" ADD CONSTRAINT "snippets_user_id_fkey" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE ON UPDATE CASCADE;
+
+-- AddForeignKey
+ALTER TABLE "snippets" ADD CONSTRAINT "snippets_message_id_fkey" FOREIGN KEY ("message_id") REFERENCES "messages"("id") ON DELETE SET NULL ON UPDATE CASCADE;
+
+-- AddForeignKey
+ALTER TABLE "snippet_versions" ADD CONSTRAINT "snippet_versions_snippet_id_fkey" FOREIGN KEY ("snippet_id") REFERENCES "snippets"("id") ON DELETE CASCADE ON UPDATE CASCADE;
+
+-- AddForeignKey
+ALTER TABLE "snippet_versions" ADD CONSTRAINT "snippet_versions_message_id_fkey" FOREIGN KEY ("message_id") REFERENCES "messages"("id") ON DELETE SET NULL ON UPDATE CASCADE;
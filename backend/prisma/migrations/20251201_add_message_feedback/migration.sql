@@ -0,0 +1,28 @@
+-- AlterTable
+ALTER TABLE "messages" ADD COLUMN "model" TEXT;
+
+-- CreateTable
+CREATE TABLE "message_feedback" (
+    "id" SERIAL NOT NULL,
+    "message_id" INTEGER NOT NULL,
+    "user_id" INTEGER NOT NULL,
+    "rating" SMALLINT NOT NULL,
+    "category" TEXT,
+    "comment" TEXT,
+    "created_at" TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMP(3) NOT NULL,
+
+    CONSTRAINT "message_feedback_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateIndex
+CREATE UNIQUE INDEX "message_feedback_message_id_user_id_key" ON "message_feedback"("message_id", "user_id");
+
+-- CreateIndex
+CREATE INDEX "message_feedback_created_at_idx" ON "message_feedback"("created_at");
+
+-- AddForeignKey
+ALTER TABLE "message_feedback" ADD CONSTRAINT "message_feedback_message_id_fkey" FOREIGN KEY ("message_id") REFERENCES "messages"("id") ON DELETE CASCADE ON UPDATE CASCADE;
+
+-- AddForeignKey
+ALTER TABLE "message_feedback" ADD CONSTRAINT "message_feedback_user_id_fkey" FOREIGN KEY ("user_id") REFERENCES "users"("id") ON DELETE CASCADE ON UPDATE CASCADE;
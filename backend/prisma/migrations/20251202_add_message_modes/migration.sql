@@ -0,0 +1,3 @@
+-- AlterTable
+ALTER TABLE "messages" ADD COLUMN "mode" TEXT NOT NULL DEFAULT 'generate',
+ADD COLUMN "metadata" JSONB;
@@ -0,0 +1,20 @@
+-- AlterTable
+ALTER TABLE "chat_shares" ADD COLUMN "token_hash" TEXT,
+ADD COLUMN "token_prefix" TEXT;
+
+-- Existing links keep working: their tokens are hashed like new ones
+UPDATE "chat_shares"
+SET "token_hash" = encode(sha256(convert_to("token", 'UTF8')), 'hex'),
+    "token_prefix" = left("token", 6);
+
+ALTER TABLE "chat_shares" ALTER COLUMN "token_hash" SET NOT NULL,
+ALTER COLUMN "token_prefix" SET NOT NULL;
+
+-- DropIndex
+DROP INDEX "chat_shares_token_key";
+
+-- AlterTable
+ALTER TABLE "chat_shares" DROP COLUMN "token";
+
+-- CreateIndex
+CREATE UNIQUE INDEX "chat_shares_token_hash_key" ON "chat_shares"("token_hash");
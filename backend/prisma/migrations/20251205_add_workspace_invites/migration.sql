@@ -0,0 +1,25 @@
+-- CreateTable
+CREATE TABLE "workspace_invites" (
+    "id" SERIAL NOT NULL,
+    "jti" TEXT NOT NULL,
+    "workspace_id" INTEGER NOT NULL,
+    "role" TEXT NOT NULL DEFAULT 'viewer',
+    "email" TEXT,
+    "invited_by" INTEGER NOT NULL,
+    "expires_at" TIMESTAMP(3) NOT NULL,
+    "created_at" TIMESTAMP(3) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "workspace_invites_pkey" PRIMARY KEY ("id")
+);
+
+-- CreateIndex
+CREATE UNIQUE INDEX "workspace_invites_jti_key" ON "workspace_invites"("jti");
+
+-- CreateIndex
+CREATE INDEX "workspace_invites_workspace_id_idx" ON "workspace_invites"("workspace_id");
+
+-- AddForeignKey
+ALTER TABLE "workspace_invites" ADD CONSTRAINT "workspace_invites_workspace_id_fkey" FOREIGN KEY ("workspace_id") REFERENCES "workspaces"("id") ON DELETE CASCADE ON UPDATE CASCADE;
+
+-- AddForeignKey
+ALTER TABLE "workspace_invites" ADD CONSTRAINT "workspace_invites_invited_by_fkey" FOREIGN KEY ("invited_by") REFERENCES "users"("id") ON DELETE CASCADE ON UPDATE CASCADE;
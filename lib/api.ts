@@ -31,6 +31,10 @@ export interface AuthResponse {
 export interface ApiError {
     success: false;
     message: string;
+    code?: string; // machine-readable, e.g. "not_found"
+    details?: unknown;
+    requestId?: string;
+    status?: number;
 }
 
 // API Client Class
@@ -59,11 +63,15 @@ class ApiClient {
             const data = await response.json();
 
             if (!response.ok) {
-                throw {
+                const error: ApiError = {
                     success: false,
-                    message: data.message || 'An error occurred',
+                    message: data.error?.message || 'An error occurred',
+                    code: data.error?.code,
+                    details: data.error?.details,
+                    requestId: data.error?.requestId,
                     status: response.status,
                 };
+                throw error;
             }
 
             return data;